@@ -26,8 +26,7 @@ func (s *Buffer) ReadVar(maxWidth int, lengthStringErr string) (int64, int, erro
 	read := make([]byte, 1)
 
 	for {
-		_, err := s.reader.Read(read)
-		if err != nil {
+		if _, err := io.ReadFull(s.reader, read); err != nil {
 			return -1, numRead, err
 		}
 
@@ -61,8 +60,7 @@ func (s *Buffer) ReadBitMap() (BitMap, error) {
 	}
 
 	data := make([]byte, 1)
-	_, err := s.reader.Read(data)
-	if err != nil {
+	if _, err := io.ReadFull(s.reader, data); err != nil {
 		return BitMap{}, err
 	}
 
@@ -0,0 +1,92 @@
+package irsdk
+
+import (
+	"sync"
+	"time"
+)
+
+// Clock is the time source used for playback, so tests can run on virtual time
+type Clock interface {
+	Now() time.Time
+	After(d time.Duration) <-chan time.Time
+}
+
+type systemClock struct{}
+
+func (systemClock) Now() time.Time {
+	return time.Now()
+}
+
+func (systemClock) After(d time.Duration) <-chan time.Time {
+	return time.After(d)
+}
+
+// SystemClock is the real wall clock
+var SystemClock Clock = systemClock{}
+
+type clockWaiter struct {
+	at time.Time
+	ch chan time.Time
+}
+
+// ManualClock is a Clock that only moves when Advance or Set is called.
+// Channels returned by After fire once the clock has been moved past their deadline.
+type ManualClock struct {
+	mux     sync.Mutex
+	now     time.Time
+	waiters []clockWaiter
+}
+
+// NewManualClock creates a ManualClock starting at now
+func NewManualClock(now time.Time) *ManualClock {
+	return &ManualClock{now: now}
+}
+
+func (c *ManualClock) Now() time.Time {
+	c.mux.Lock()
+	defer c.mux.Unlock()
+	return c.now
+}
+
+func (c *ManualClock) After(d time.Duration) <-chan time.Time {
+	c.mux.Lock()
+	defer c.mux.Unlock()
+
+	ch := make(chan time.Time, 1)
+	if d <= 0 {
+		ch <- c.now
+		return ch
+	}
+
+	c.waiters = append(c.waiters, clockWaiter{at: c.now.Add(d), ch: ch})
+	return ch
+}
+
+// Advance moves the clock forward by d
+func (c *ManualClock) Advance(d time.Duration) {
+	c.mux.Lock()
+	defer c.mux.Unlock()
+	c.set(c.now.Add(d))
+}
+
+// Set moves the clock to t, moving backwards does not fire any waiter
+func (c *ManualClock) Set(t time.Time) {
+	c.mux.Lock()
+	defer c.mux.Unlock()
+	c.set(t)
+}
+
+func (c *ManualClock) set(t time.Time) {
+	c.now = t
+
+	remaining := c.waiters[:0]
+	for _, w := range c.waiters {
+		if w.at.After(t) {
+			remaining = append(remaining, w)
+		} else {
+			w.ch <- t
+		}
+	}
+
+	c.waiters = remaining
+}
@@ -0,0 +1,313 @@
+package irsdk
+
+import (
+	"cmp"
+	"fmt"
+	"math/bits"
+	"slices"
+	"strings"
+)
+
+// Flag is the irsdk_Flags bitfield used by the SessionFlags and CarIdxSessionFlags variables
+type Flag uint32
+
+// global flags
+const (
+	FlagCheckered     Flag = 0x00000001
+	FlagWhite         Flag = 0x00000002
+	FlagGreen         Flag = 0x00000004
+	FlagYellow        Flag = 0x00000008
+	FlagRed           Flag = 0x00000010
+	FlagBlue          Flag = 0x00000020
+	FlagDebris        Flag = 0x00000040
+	FlagCrossed       Flag = 0x00000080
+	FlagYellowWaving  Flag = 0x00000100
+	FlagOneLapToGreen Flag = 0x00000200
+	FlagGreenHeld     Flag = 0x00000400
+	FlagTenToGo       Flag = 0x00000800
+	FlagFiveToGo      Flag = 0x00001000
+	FlagRandomWaving  Flag = 0x00002000
+	FlagCaution       Flag = 0x00004000
+	FlagCautionWaving Flag = 0x00008000
+)
+
+// drivers black flags
+const (
+	FlagBlack      Flag = 0x00010000
+	FlagDisqualify Flag = 0x00020000
+	FlagServicible Flag = 0x00040000 // car is allowed service (not a flag)
+	FlagFurled     Flag = 0x00080000
+	FlagRepair     Flag = 0x00100000 // meatball
+)
+
+// start lights
+const (
+	FlagStartHidden Flag = 0x10000000
+	FlagStartReady  Flag = 0x20000000
+	FlagStartSet    Flag = 0x40000000
+	FlagStartGo     Flag = 0x80000000
+)
+
+// FlagMeatball is the common name for the repair flag
+const FlagMeatball = FlagRepair
+
+// DefaultTrackedFlags are the flags reported by a FlagTracker created with a zero mask
+const DefaultTrackedFlags = FlagGreen | FlagYellow | FlagCaution | FlagCautionWaving | FlagWhite | FlagCheckered |
+	FlagBlue | FlagBlack | FlagRepair | FlagDisqualify | FlagFurled
+
+var flagNames = map[Flag]string{
+	FlagCheckered:     "checkered",
+	FlagWhite:         "white",
+	FlagGreen:         "green",
+	FlagYellow:        "yellow",
+	FlagRed:           "red",
+	FlagBlue:          "blue",
+	FlagDebris:        "debris",
+	FlagCrossed:       "crossed",
+	FlagYellowWaving:  "yellow waving",
+	FlagOneLapToGreen: "one lap to green",
+	FlagGreenHeld:     "green held",
+	FlagTenToGo:       "ten to go",
+	FlagFiveToGo:      "five to go",
+	FlagRandomWaving:  "random waving",
+	FlagCaution:       "caution",
+	FlagCautionWaving: "caution waving",
+	FlagBlack:         "black",
+	FlagDisqualify:    "disqualify",
+	FlagServicible:    "servicible",
+	FlagFurled:        "furled",
+	FlagRepair:        "meatball",
+	FlagStartHidden:   "start hidden",
+	FlagStartReady:    "start ready",
+	FlagStartSet:      "start set",
+	FlagStartGo:       "start go",
+}
+
+// Has reports whether every bit of flag is set
+func (f Flag) Has(flag Flag) bool {
+	return f&flag == flag
+}
+
+// Split returns the individual flags set in f, lowest bit first
+func (f Flag) Split() []Flag {
+	flags := make([]Flag, 0, bits.OnesCount32(uint32(f)))
+	for v := uint32(f); v != 0; v &= v - 1 {
+		flags = append(flags, Flag(v&-v))
+	}
+
+	return flags
+}
+
+func (f Flag) String() string {
+	if f == 0 {
+		return "none"
+	}
+
+	names := make([]string, 0)
+	for _, flag := range f.Split() {
+		if name, ok := flagNames[flag]; ok {
+			names = append(names, name)
+		} else {
+			names = append(names, fmt.Sprintf("0x%08x", uint32(flag)))
+		}
+	}
+
+	return strings.Join(names, "|")
+}
+
+// ParseFlag parses flag names as returned by Flag.String, e.g. "caution|caution waving"
+func ParseFlag(s string) (Flag, error) {
+	var f Flag
+	for _, name := range strings.Split(s, "|") {
+		name = strings.ToLower(strings.TrimSpace(name))
+		if name == "" || name == "none" {
+			continue
+		}
+
+		found := false
+		for flag, flagName := range flagNames {
+			if flagName == name {
+				f |= flag
+				found = true
+				break
+			}
+		}
+
+		if !found && name == "repair" {
+			f |= FlagRepair
+			found = true
+		}
+
+		if !found {
+			return 0, fmt.Errorf("unknown flag: %q", name)
+		}
+	}
+
+	return f, nil
+}
+
+// FlagEvent describes a single flag being shown, either to the whole session or to one car
+type FlagEvent struct {
+	Flag   Flag
+	CarIdx int // -1 for flags taken from SessionFlags
+
+	StartTick int
+	StartTime float64 // SessionTime when the flag was first seen
+
+	EndTick int     // -1 while the flag is still shown
+	EndTime float64 // SessionTime when the flag was cleared
+}
+
+// Active reports whether the flag was still shown when the event was emitted
+func (e FlagEvent) Active() bool {
+	return e.EndTick < 0
+}
+
+func (e FlagEvent) String() string {
+	target := "session"
+	if e.CarIdx >= 0 {
+		target = fmt.Sprintf("car %d", e.CarIdx)
+	}
+
+	if e.Active() {
+		return fmt.Sprintf("%s flag for %s from tick %d (%.3fs)", e.Flag, target, e.StartTick, e.StartTime)
+	}
+
+	return fmt.Sprintf("%s flag for %s from tick %d (%.3fs) to tick %d (%.3fs)", e.Flag, target, e.StartTick, e.StartTime, e.EndTick, e.EndTime)
+}
+
+type flagKey struct {
+	carIdx int
+	flag   Flag
+}
+
+// FlagTracker decodes SessionFlags and CarIdxSessionFlags into a stream of FlagEvent values.
+// Every flag produces one event when it appears (Active) and a second event, with the end
+// tick and time filled in, when it is cleared.
+type FlagTracker struct {
+	mask   Flag
+	active map[flagKey]FlagEvent
+}
+
+// NewFlagTracker creates a tracker for the flags in mask, or DefaultTrackedFlags if mask is zero
+func NewFlagTracker(mask Flag) *FlagTracker {
+	if mask == 0 {
+		mask = DefaultTrackedFlags
+	}
+
+	return &FlagTracker{
+		mask:   mask,
+		active: make(map[flagKey]FlagEvent),
+	}
+}
+
+// Update reads the current flag state from sdk and returns the flag events since the last call.
+// CarIdxSessionFlags is optional; SessionTick and SessionTime default to zero when missing.
+func (t *FlagTracker) Update(sdk SDK) ([]FlagEvent, error) {
+	v, err := sdk.GetVarValue("SessionFlags")
+	if err != nil {
+		return nil, fmt.Errorf("failed to read session flags: %w", err)
+	}
+
+	session, ok := toInt(v)
+	if !ok {
+		return nil, fmt.Errorf("unexpected session flags type %T", v)
+	}
+
+	var cars []Flag
+	if values, err := sdk.GetVarValues("CarIdxSessionFlags"); err == nil {
+		if values, ok := values.([]any); ok {
+			cars = make([]Flag, len(values))
+			for i, value := range values {
+				f, _ := toInt(value)
+				cars[i] = Flag(f)
+			}
+		}
+	}
+
+	var tick int
+	if v, err = sdk.GetVarValue("SessionTick"); err == nil {
+		tick, _ = toInt(v)
+	}
+
+	var sessionTime float64
+	if v, err = sdk.GetVarValue("SessionTime"); err == nil {
+		sessionTime, _ = toFloat64(v)
+	}
+
+	return t.UpdateFlags(tick, sessionTime, Flag(session), cars), nil
+}
+
+// UpdateFlags applies already decoded flag values and returns the resulting events.
+// cars is indexed by CarIdx and may be nil.
+func (t *FlagTracker) UpdateFlags(tick int, sessionTime float64, session Flag, cars []Flag) []FlagEvent {
+	events := make([]FlagEvent, 0)
+	seen := make(map[flagKey]bool)
+
+	observe := func(carIdx int, flags Flag) {
+		for _, flag := range (flags & t.mask).Split() {
+			key := flagKey{carIdx: carIdx, flag: flag}
+			seen[key] = true
+
+			if _, ok := t.active[key]; ok {
+				continue
+			}
+
+			e := FlagEvent{
+				Flag:      flag,
+				CarIdx:    carIdx,
+				StartTick: tick,
+				StartTime: sessionTime,
+				EndTick:   -1,
+			}
+
+			t.active[key] = e
+			events = append(events, e)
+		}
+	}
+
+	observe(-1, session)
+	for carIdx, flags := range cars {
+		observe(carIdx, flags)
+	}
+
+	for key, e := range t.active {
+		if seen[key] {
+			continue
+		}
+
+		e.EndTick = tick
+		e.EndTime = sessionTime
+		delete(t.active, key)
+		events = append(events, e)
+	}
+
+	sortFlagEvents(events)
+	return events
+}
+
+// Active returns the flags currently shown
+func (t *FlagTracker) Active() []FlagEvent {
+	events := make([]FlagEvent, 0, len(t.active))
+	for _, e := range t.active {
+		events = append(events, e)
+	}
+
+	sortFlagEvents(events)
+	return events
+}
+
+// Reset forgets every active flag without emitting end events, e.g. after a disconnect
+func (t *FlagTracker) Reset() {
+	t.active = make(map[flagKey]FlagEvent)
+}
+
+func sortFlagEvents(events []FlagEvent) {
+	slices.SortFunc(events, func(a, b FlagEvent) int {
+		if a.CarIdx != b.CarIdx {
+			return cmp.Compare(a.CarIdx, b.CarIdx)
+		}
+
+		return cmp.Compare(a.Flag, b.Flag)
+	})
+}
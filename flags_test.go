@@ -0,0 +1,75 @@
+package irsdk
+
+import "testing"
+
+func TestFlagTrackerSession(t *testing.T) {
+	tracker := NewFlagTracker(0)
+
+	events := tracker.UpdateFlags(10, 1.5, FlagGreen|FlagStartGo, nil)
+	if len(events) != 1 || events[0].Flag != FlagGreen || !events[0].Active() || events[0].CarIdx != -1 {
+		t.Fatalf("expected green start event, got %v", events)
+	}
+
+	events = tracker.UpdateFlags(11, 1.6, FlagGreen, nil)
+	if len(events) != 0 {
+		t.Fatalf("expected no events, got %v", events)
+	}
+
+	events = tracker.UpdateFlags(20, 2.5, FlagCaution|FlagCautionWaving, nil)
+	if len(events) != 3 {
+		t.Fatalf("expected 3 events, got %v", events)
+	}
+
+	for _, e := range events {
+		if e.Flag == FlagGreen {
+			if e.Active() || e.StartTick != 10 || e.EndTick != 20 || e.EndTime != 2.5 {
+				t.Errorf("unexpected green end event: %v", e)
+			}
+		} else if !e.Active() || e.StartTick != 20 {
+			t.Errorf("unexpected start event: %v", e)
+		}
+	}
+}
+
+func TestFlagTrackerCars(t *testing.T) {
+	tracker := NewFlagTracker(0)
+
+	events := tracker.UpdateFlags(1, 0, 0, []Flag{0, FlagBlue, FlagBlack | FlagRepair})
+	if len(events) != 3 {
+		t.Fatalf("expected 3 events, got %v", events)
+	}
+
+	if events[0].CarIdx != 1 || events[0].Flag != FlagBlue {
+		t.Errorf("expected blue flag for car 1, got %v", events[0])
+	}
+
+	events = tracker.UpdateFlags(2, 0, 0, []Flag{0, 0, FlagRepair})
+	if len(events) != 2 {
+		t.Fatalf("expected 2 events, got %v", events)
+	}
+
+	if len(tracker.Active()) != 1 || tracker.Active()[0].Flag != FlagMeatball {
+		t.Errorf("expected meatball to remain active, got %v", tracker.Active())
+	}
+}
+
+func TestFlagString(t *testing.T) {
+	if s := (FlagYellow | FlagCautionWaving).String(); s != "yellow|caution waving" {
+		t.Errorf("unexpected flag string %q", s)
+	}
+}
+
+func TestParseFlag(t *testing.T) {
+	f, err := ParseFlag("caution | Caution Waving|meatball")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if f != FlagCaution|FlagCautionWaving|FlagRepair {
+		t.Errorf("unexpected flags %v", f)
+	}
+
+	if _, err = ParseFlag("purple"); err == nil {
+		t.Error("expected unknown flag error")
+	}
+}
@@ -3,8 +3,13 @@ module github.com/hfoxy/iracing-sdk
 go 1.24.0
 
 require (
-	github.com/go-yaml/yaml v2.1.0+incompatible // indirect
-	github.com/hidez8891/shm v0.0.0-20200313135933-0ec4df5f28c7 // indirect
-	github.com/klauspost/compress v1.18.0 // indirect
-	golang.org/x/text v0.12.0 // indirect
+	github.com/go-yaml/yaml v2.1.0+incompatible
+	github.com/hidez8891/shm v0.0.0-20200313135933-0ec4df5f28c7
+	github.com/klauspost/compress v1.18.0
+	golang.org/x/text v0.12.0
+)
+
+require (
+	gopkg.in/check.v1 v1.0.0-20201130134442-10cb98267c6c // indirect
+	gopkg.in/yaml.v2 v2.4.0 // indirect
 )
@@ -40,3 +40,16 @@ func readHeader(r reader) (header, error) {
 
 	return h, nil
 }
+
+// sameLayout reports whether both headers describe the same variable and buffer layout
+func (h *header) sameLayout(other *header) bool {
+	return h.numVars == other.numVars &&
+		h.headerOffset == other.headerOffset &&
+		h.numBuf == other.numBuf &&
+		h.bufLen == other.bufLen
+}
+
+// sessionConnected reports whether the status bit is set, a nil header is never connected
+func (h *header) sessionConnected() bool {
+	return h != nil && (h.status&stConnected) > 0
+}
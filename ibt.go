@@ -0,0 +1,164 @@
+package irsdk
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"time"
+
+	"github.com/hfoxy/iracing-sdk/replay"
+)
+
+// offsets of the irsdk_diskSubHeader that follows the header and variable buffers of a telemetry file
+const (
+	diskSubHeaderOffset = 112
+	diskSubHeaderSize   = 32
+)
+
+// IbtReader reads a telemetry file written by the simulator (.ibt) as replay entries, so it can be
+// played back like a recording. Every row becomes one connected entry timestamped from the session
+// start date in the file.
+type IbtReader struct {
+	f    *os.File
+	size int64
+
+	h         header
+	vars      []Variable
+	yaml      string
+	start     time.Time
+	rowOffset int64
+	records   int
+	record    int
+	read      int64
+	row       []byte
+}
+
+// NewIbtReader opens a telemetry file
+func NewIbtReader(fileName string) (*IbtReader, error) {
+	f, err := os.Open(fileName)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open telemetry file: %w", err)
+	}
+
+	r := &IbtReader{f: f}
+	if err = r.init(); err != nil {
+		_ = f.Close()
+		return nil, fmt.Errorf("failed to read telemetry file %s: %w", fileName, err)
+	}
+
+	return r, nil
+}
+
+func (r *IbtReader) init() error {
+	info, err := r.f.Stat()
+	if err != nil {
+		return err
+	}
+
+	r.size = info.Size()
+
+	r.h, err = readHeader(r.f)
+	if err != nil {
+		return err
+	}
+
+	if r.h.tickRate <= 0 || r.h.bufLen <= 0 {
+		return fmt.Errorf("invalid header, tick rate %d and row length %d", r.h.tickRate, r.h.bufLen)
+	}
+
+	sub := make([]byte, diskSubHeaderSize)
+	if _, err = r.f.ReadAt(sub, diskSubHeaderOffset); err != nil {
+		return err
+	}
+
+	startDate := int64(binary.LittleEndian.Uint64(sub[0:8]))
+	startTime := math.Float64frombits(binary.LittleEndian.Uint64(sub[8:16]))
+	r.start = time.Unix(startDate, 0).Add(time.Duration(startTime * float64(time.Second)))
+	r.records = byte4ToInt(sub[28:32])
+
+	vb := make([]byte, 4)
+	if _, err = r.f.ReadAt(vb, 52); err != nil {
+		return err
+	}
+
+	r.rowOffset = int64(byte4ToInt(vb))
+
+	r.vars, err = readVarHeaders(r.f, &r.h)
+	if err != nil {
+		return err
+	}
+
+	r.yaml, err = readSessionData(r.f, &r.h)
+	if err != nil {
+		return err
+	}
+
+	// files that were not closed cleanly have no record count
+	if r.records == 0 {
+		r.records = int((r.size - r.rowOffset) / int64(r.h.bufLen))
+	}
+
+	r.row = make([]byte, r.h.bufLen)
+	r.read = r.rowOffset
+	return nil
+}
+
+// TickRate returns the number of rows per second
+func (r *IbtReader) TickRate() int {
+	return r.h.tickRate
+}
+
+// Variables returns the variable headers of the file, without values
+func (r *IbtReader) Variables() []Variable {
+	return r.vars
+}
+
+func (r *IbtReader) ReadEntry() (*replay.Entry, error) {
+	if r.record >= r.records {
+		return &replay.Entry{}, replay.ErrEndOfFile
+	}
+
+	offset := r.rowOffset + int64(r.record)*int64(r.h.bufLen)
+	if _, err := r.f.ReadAt(r.row, offset); err != nil {
+		if err == io.EOF {
+			return &replay.Entry{}, replay.ErrEndOfFile
+		}
+
+		return nil, fmt.Errorf("failed to read row %d: %w", r.record, err)
+	}
+
+	vars, err := decodeRow(r.row, r.vars)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode row %d: %w", r.record, err)
+	}
+
+	vd, err := EncodeVariables(vars)
+	if err != nil {
+		return nil, err
+	}
+
+	t := r.start.Add(time.Duration(r.record) * time.Second / time.Duration(r.h.tickRate))
+	r.record++
+	r.read = offset + int64(r.h.bufLen)
+
+	return &replay.Entry{
+		Timestamp:    t.UnixMilli(),
+		Connected:    true,
+		YamlData:     r.yaml,
+		VariableData: vd,
+	}, nil
+}
+
+func (r *IbtReader) ReadSize() int64 {
+	return r.read
+}
+
+func (r *IbtReader) Size() int64 {
+	return r.size
+}
+
+func (r *IbtReader) Close() error {
+	return r.f.Close()
+}
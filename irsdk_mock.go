@@ -1,28 +1,38 @@
 package irsdk
 
 import (
-	"bytes"
-	"context"
-	"encoding/base64"
-	"encoding/gob"
 	"errors"
 	"fmt"
 	"github.com/hfoxy/iracing-sdk/replay"
 	"log/slog"
-	"os"
+	"path/filepath"
+	"sync"
 	"time"
 )
 
+// MockSDK plays a replay file back through the SDK interface.
+// WaitForData, RefreshSession and Close must be called from a single goroutine, every other method
+// may be called concurrently with them.
 type MockSDK struct {
 	logger  Logger
 	options MockOptions
+	clock   Clock
 
+	mux sync.RWMutex
+
+	open   func() (replay.Reader, error)
 	replay replay.Reader
+	index  []mockIndexEntry
+	file   int // playlist recording of the next entry
 
+	// playback position is startTime plus the clock time elapsed since openTime scaled by speed
 	openTime  time.Time
 	startTime time.Time
+	speed     float64
+	paused    bool
 
-	ended bool
+	ended   bool
+	pending bool // the current row changed outside WaitForData, e.g. after a seek
 
 	lastEntry     *replay.Entry
 	lastEntryTime time.Time
@@ -32,61 +42,188 @@ type MockSDK struct {
 
 	currentRow *row
 
-	restartAllowedFrom time.Time
+	// tickVersion counts every entry played and never goes backwards, sessionVersion counts YAML changes
+	tickVersion    int
+	sessionVersion int
+	sessionYaml    string
+
+	endedAt   time.Time // clock time the end of the recording was reached
+	notifyEnd bool      // OnEnd has to be called once sdk.mux is released
+}
+
+// ErrEndOfRecording is returned by MockSDK.WaitForData once the recording has been played when
+// MockOptions.EndBehavior is EndError
+var ErrEndOfRecording = errors.New("end of recording")
+
+// EndBehavior decides what MockSDK does once every entry of the recording has been played
+type EndBehavior int
+
+const (
+	EndStop  EndBehavior = iota // keep the last row, WaitForData reports no new data
+	EndLoop                     // disconnect for AutoRestartDelay, then play the recording again
+	EndError                    // WaitForData returns ErrEndOfRecording
+)
+
+func (b EndBehavior) String() string {
+	switch b {
+	case EndStop:
+		return "stop"
+	case EndLoop:
+		return "loop"
+	case EndError:
+		return "error"
+	default:
+		return fmt.Sprintf("EndBehavior(%d)", int(b))
+	}
 }
 
 type MockOptions struct {
 	Logger Logger
 
-	DataSourceName   string
-	AutoRestart      bool
+	// Clock drives playback, defaults to SystemClock. Use a ManualClock for deterministic tests.
+	Clock Clock
+
+	// DataSourceName is the recording to play, a replay file or a telemetry file (.ibt). It may be a
+	// glob pattern, in which case every match is played in name order.
+	DataSourceName string
+
+	// DataSourceNames plays several recordings or glob patterns in order as one continuous stream,
+	// after DataSourceName if both are set
+	DataSourceNames []string
+
+	// PlaylistGap is the time the mock is disconnected between two recordings of a playlist
+	PlaylistGap time.Duration
+
+	// EndBehavior is applied once the recording has been played
+	EndBehavior EndBehavior
+
+	// OnEnd is called from WaitForData or Step every time the end of the recording is reached
+	OnEnd func()
+
+	// AutoRestart selects EndLoop when EndBehavior is EndStop.
+	//
+	// Deprecated: use EndBehavior.
+	AutoRestart bool
+
+	// AutoRestartDelay is the disconnect gap between two loops of the recording
 	AutoRestartDelay time.Duration
-	AutoRestartQuit  bool
+
+	// AutoRestartQuit selects EndError when AutoRestart is set, the mock no longer exits the process.
+	//
+	// Deprecated: use EndBehavior.
+	AutoRestartQuit bool
 }
 
 func NewMock(opts MockOptions) (*MockSDK, error) {
-	if opts.DataSourceName == "" {
+	patterns := opts.DataSourceNames
+	if opts.DataSourceName != "" {
+		patterns = append([]string{opts.DataSourceName}, patterns...)
+	}
+
+	if len(patterns) == 0 {
 		return nil, errors.New("data source name cannot be empty")
 	}
 
+	fileNames, err := replay.Glob(patterns...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to find recordings: %w", err)
+	}
+
 	sdk := &MockSDK{}
 
+	if opts.EndBehavior == EndStop && opts.AutoRestart {
+		if opts.AutoRestartQuit {
+			opts.EndBehavior = EndError
+		} else {
+			opts.EndBehavior = EndLoop
+		}
+	}
+
 	if opts.Logger == nil {
 		opts.Logger = slog.Default()
 	}
 
 	sdk.logger = opts.Logger
 
+	if opts.Clock == nil {
+		opts.Clock = SystemClock
+	}
+
+	sdk.clock = opts.Clock
+
+	sdk.open = func() (replay.Reader, error) {
+		return openRecording(fileNames[0])
+	}
+
+	if len(fileNames) > 1 {
+		sdk.open = func() (replay.Reader, error) {
+			return replay.NewPlaylist(fileNames, replay.PlaylistOptions{
+				Gap:  opts.PlaylistGap,
+				Open: openRecording,
+			})
+		}
+	}
+
+	if err := sdk.rewind(); err != nil {
+		return nil, err
+	}
+
+	sdk.options = opts
+	sdk.speed = 1
+	sdk.startTime = sdk.nextEntryTime
+	sdk.openTime = sdk.clock.Now()
+	return sdk, nil
+}
+
+// rewind reopens the recording so the first entry is the next one to be played.
+// It must be called with sdk.mux held, or before the SDK is shared.
+func (sdk *MockSDK) rewind() error {
+	if sdk.replay != nil {
+		if err := sdk.replay.Close(); err != nil {
+			sdk.logger.Warn("failed to close replay", "error", err)
+		}
+	}
+
 	var err error
-	sdk.replay, err = replay.NewReader(opts.DataSourceName)
+	sdk.replay, err = sdk.open()
 	if err != nil {
-		return nil, fmt.Errorf("failed to open replay: %w", err)
+		return fmt.Errorf("failed to open replay: %w", err)
 	}
 
-	sdk.lastEntry, err = sdk.replay.ReadEntry()
+	sdk.nextEntry, err = sdk.replay.ReadEntry()
 	if err != nil {
-		return nil, fmt.Errorf("failed to read first entry: %w", err)
+		return fmt.Errorf("failed to read first entry: %w", err)
 	}
 
-	sdk.lastEntryTime = time.Unix(0, sdk.lastEntry.Timestamp*int64(time.Millisecond))
+	sdk.nextEntryTime = entryTime(sdk.nextEntry)
+	sdk.lastEntry = nil
+	sdk.lastEntryTime = time.Time{}
+	sdk.currentRow = nil
+	sdk.file = 0
+	sdk.ended = false
+	sdk.endedAt = time.Time{}
+	return nil
+}
 
-	sdk.nextEntry, err = sdk.replay.ReadEntry()
-	if err != nil {
-		return nil, fmt.Errorf("failed to read second entry: %w", err)
+// openRecording opens a replay file, or a telemetry file written by the simulator
+func openRecording(fileName string) (replay.Reader, error) {
+	if filepath.Ext(fileName) == ".ibt" {
+		return NewIbtReader(fileName)
 	}
 
-	sdk.nextEntryTime = time.Unix(0, sdk.nextEntry.Timestamp*int64(time.Millisecond))
+	return replay.NewReader(fileName)
+}
 
-	sdk.startTime = sdk.lastEntryTime
-	sdk.openTime = time.Now().Add(-5 * time.Second)
-	return sdk, nil
+func entryTime(entry *replay.Entry) time.Time {
+	return time.Unix(0, entry.Timestamp*int64(time.Millisecond))
 }
 
+// RefreshSession is a no-op, like the live SDK every WaitForData call already refreshes the session info
 func (sdk *MockSDK) RefreshSession() error {
-	//TODO implement me
-	return ErrNotImplemented
+	return nil
 }
 
+// row is the decoded form of an entry, it is never modified once it becomes the current row
 type row struct {
 	Timestamp    int64
 	Connected    bool
@@ -96,102 +233,223 @@ type row struct {
 	Variables    []Variable
 }
 
+func newRow(entry *replay.Entry) (*row, error) {
+	r := &row{
+		Timestamp:    entry.Timestamp,
+		Connected:    entry.Connected,
+		NotOk:        entry.NotOk,
+		YamlData:     entry.YamlData,
+		VariableData: entry.VariableData,
+	}
+
+	if r.Connected && r.VariableData != "" {
+		var err error
+		r.Variables, err = DecodeVariables(r.VariableData)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return r, nil
+}
+
+// WaitForData blocks for up to timeout until the next entry of the recording is due,
+// returning true if a new connected row was read
 func (sdk *MockSDK) WaitForData(timeout time.Duration) (bool, error) {
-	_, cancel := context.WithTimeout(context.Background(), timeout)
-	defer cancel()
+	deadline := sdk.clock.Now().Add(timeout)
+
+	for {
+		sdk.mux.Lock()
+		ok, updated, err := sdk.advance()
+		if sdk.pending && err == nil {
+			sdk.pending = false
+			ok, updated = sdk.currentRowOk(), true
+		}
+
+		idle := false
+		wait := sdk.nextEntryTime.Sub(sdk.position())
+		switch {
+		case sdk.paused:
+			idle = true
+		case sdk.ended && sdk.options.EndBehavior == EndLoop:
+			wait = sdk.endedAt.Add(sdk.options.AutoRestartDelay).Sub(sdk.clock.Now())
+		case sdk.ended:
+			idle = true
+		case sdk.speed != 1:
+			wait = time.Duration(float64(wait) / sdk.speed)
+		}
 
-	t := sdk.startTime.Add(time.Now().Sub(sdk.openTime))
-	millis := t.UnixMilli()
+		sdk.mux.Unlock()
+		sdk.callOnEnd()
 
-	if millis < sdk.nextEntry.Timestamp {
-		return true, nil
+		if err != nil || updated {
+			return ok, err
+		}
+
+		remaining := deadline.Sub(sdk.clock.Now())
+		if remaining <= 0 {
+			return false, nil
+		}
+
+		if idle || wait > remaining {
+			wait = remaining
+		}
+
+		<-sdk.clock.After(wait)
 	}
+}
 
-	r := row{}
+// Step moves playback forward to the next entry of the recording without waiting for it to be due
+func (sdk *MockSDK) Step() (bool, error) {
+	sdk.mux.Lock()
 
 	if !sdk.ended {
-		end := false
-
-		read := 0
-		for {
-			sdk.lastEntry = sdk.nextEntry
-			sdk.lastEntryTime = sdk.nextEntryTime
-
-			var err error
-			sdk.nextEntry, err = sdk.replay.ReadEntry()
-			if err != nil {
-				if errors.Is(err, replay.ErrEndOfFile) {
-					end = true
-				} else {
-					return false, fmt.Errorf("failed to get data: %w", err)
-				}
-			} else if sdk.nextEntry == nil {
-				sdk.logger.Warn("next entry is nil")
-				end = true
-			}
+		if d := sdk.nextEntryTime.Sub(sdk.position()); d > 0 {
+			sdk.startTime = sdk.startTime.Add(d)
+		}
+	}
+
+	ok, _, err := sdk.advance()
+	sdk.mux.Unlock()
+	sdk.callOnEnd()
+	return ok, err
+}
+
+// callOnEnd calls OnEnd if the end of the recording was reached, sdk.mux must not be held
+func (sdk *MockSDK) callOnEnd() {
+	sdk.mux.Lock()
+	notify := sdk.notifyEnd
+	sdk.notifyEnd = false
+	sdk.mux.Unlock()
+
+	if notify && sdk.options.OnEnd != nil {
+		sdk.options.OnEnd()
+	}
+}
+
+// position returns the current playback position, it must be called with sdk.mux held
+func (sdk *MockSDK) position() time.Time {
+	if sdk.paused {
+		return sdk.startTime
+	}
 
-			sdk.nextEntryTime = time.Unix(0, sdk.nextEntry.Timestamp*int64(time.Millisecond))
-			read++
+	elapsed := sdk.clock.Now().Sub(sdk.openTime)
+	if sdk.speed != 1 {
+		elapsed = time.Duration(float64(elapsed) * sdk.speed)
+	}
+
+	return sdk.startTime.Add(elapsed)
+}
 
-			if sdk.lastEntryTime.Before(t) && sdk.nextEntryTime.After(t) {
-				break
+// rebase anchors the playback position to the current clock time, so speed or pause changes
+// only apply from now on. It must be called with sdk.mux held.
+func (sdk *MockSDK) rebase() {
+	sdk.startTime = sdk.position()
+	sdk.openTime = sdk.clock.Now()
+}
+
+// currentRowOk reports whether the current row holds valid data, it must be called with sdk.mux held
+func (sdk *MockSDK) currentRowOk() bool {
+	return sdk.currentRow != nil && sdk.currentRow.Connected && !sdk.currentRow.NotOk
+}
+
+// advance reads every entry that is due and makes the latest one the current row.
+// It must be called with sdk.mux held.
+func (sdk *MockSDK) advance() (ok bool, updated bool, err error) {
+	t := sdk.position()
+
+	for !sdk.ended && !sdk.nextEntryTime.After(t) {
+		sdk.lastEntry = sdk.nextEntry
+		sdk.lastEntryTime = sdk.nextEntryTime
+		sdk.tickVersion++
+		updated = true
+
+		sdk.nextEntry, err = sdk.replay.ReadEntry()
+		if err != nil {
+			if !errors.Is(err, replay.ErrEndOfFile) {
+				return false, false, fmt.Errorf("failed to get data: %w", err)
 			}
 
-			r.Timestamp = sdk.lastEntry.Timestamp
-			r.Connected = sdk.lastEntry.Connected
-			r.NotOk = sdk.lastEntry.NotOk
-			r.YamlData = sdk.lastEntry.YamlData
-			r.VariableData = sdk.lastEntry.VariableData
+			err = nil
+			sdk.ended = true
+		} else if sdk.nextEntry == nil {
+			sdk.logger.Warn("next entry is nil")
+			sdk.ended = true
+		} else {
+			sdk.nextEntryTime = entryTime(sdk.nextEntry)
+		}
+	}
 
-			if end {
-				break
+	if updated {
+		var r *row
+		r, err = newRow(sdk.lastEntry)
+		if err != nil {
+			return false, false, err
+		}
+
+		sdk.currentRow = r
+		sdk.pending = false
+
+		if p, ok := sdk.replay.(*replay.Playlist); ok {
+			if i, fileName := p.Current(); i != sdk.file {
+				sdk.file = i
+				sdk.logger.Info("playing recording", "index", i, "fileName", fileName)
 			}
 		}
 
-		if end {
-			sdk.ended = true
+		if r.Connected && r.YamlData != sdk.sessionYaml {
+			sdk.sessionYaml = r.YamlData
+			sdk.sessionVersion++
 		}
 	}
 
-	sdk.currentRow = &r
-	if sdk.ended && sdk.restartAllowedFrom.IsZero() {
-		sdk.restartAllowedFrom = time.Now().Add(sdk.options.AutoRestartDelay)
-		sdk.logger.Info("reached end of recording", "restartAllowedFrom", sdk.restartAllowedFrom.Format(time.RFC3339))
+	if !sdk.ended {
+		return updated && sdk.currentRowOk(), updated, nil
 	}
 
-	if sdk.options.AutoRestart && !sdk.restartAllowedFrom.IsZero() && time.Now().After(sdk.restartAllowedFrom) {
-		if sdk.options.AutoRestartQuit {
-			sdk.logger.Info("auto-restart quit enabled - quitting")
-			// shutdown.Shutdown()
-			os.Exit(0)
-			return false, nil
-		}
+	now := sdk.clock.Now()
+	if sdk.endedAt.IsZero() {
+		sdk.endedAt = now
+		sdk.notifyEnd = true
+		sdk.logger.Info("reached end of recording", "behavior", sdk.options.EndBehavior)
+	}
 
-		return false, nil
+	if updated {
+		return sdk.currentRowOk(), updated, nil
 	}
 
-	if r.Connected {
-		if r.VariableData != "" {
-			vd, err := base64.StdEncoding.DecodeString(r.VariableData)
-			if err != nil {
-				return false, fmt.Errorf("failed to decode variable data: %w", err)
-			}
+	switch sdk.options.EndBehavior {
+	case EndLoop:
+		if sdk.currentRow == nil || sdk.currentRow.Connected {
+			// the simulator disconnects between two loops
+			sdk.currentRow = &row{Timestamp: sdk.lastEntryTime.UnixMilli()}
+			updated = true
+		}
 
-			err = gob.NewDecoder(bytes.NewBuffer(vd)).Decode(&r.Variables)
-			if err != nil {
-				return false, fmt.Errorf("failed to decode variables: %w", err)
-			}
+		if now.Before(sdk.endedAt.Add(sdk.options.AutoRestartDelay)) {
+			return false, updated, nil
+		}
 
-			r.Variables = sdk.currentRow.Variables
+		sdk.logger.Info("restarting recording")
+		if err = sdk.rewind(); err != nil {
+			return false, false, err
 		}
 
-		return !r.NotOk, nil
+		sdk.startTime = sdk.nextEntryTime
+		sdk.openTime = now
+		return sdk.advance()
+	case EndError:
+		return false, false, ErrEndOfRecording
 	}
 
-	return false, nil
+	return updated && sdk.currentRowOk(), updated, nil
 }
 
+// GetVars returns the variables of the current row, the slice is shared and must not be modified
 func (sdk *MockSDK) GetVars() ([]Variable, error) {
+	sdk.mux.RLock()
+	defer sdk.mux.RUnlock()
+
 	if sdk.currentRow == nil {
 		return make([]Variable, 0), nil
 	}
@@ -200,9 +458,14 @@ func (sdk *MockSDK) GetVars() ([]Variable, error) {
 }
 
 func (sdk *MockSDK) GetVar(name string) (Variable, error) {
-	for _, variable := range sdk.currentRow.Variables {
-		if variable.Name == name {
-			return variable, nil
+	sdk.mux.RLock()
+	defer sdk.mux.RUnlock()
+
+	if sdk.currentRow != nil {
+		for _, variable := range sdk.currentRow.Variables {
+			if variable.Name == name {
+				return variable, nil
+			}
 		}
 	}
 
@@ -235,16 +498,35 @@ func (sdk *MockSDK) GetVarValues(name string) (interface{}, error) {
 	}
 }
 
+// GetLastVersion returns a tick counter that increases with every entry played, including entries
+// skipped by seeking or fast-forward, and never goes backwards
 func (sdk *MockSDK) GetLastVersion() int {
-	//TODO implement me
-	return -1
+	sdk.mux.RLock()
+	defer sdk.mux.RUnlock()
+
+	if sdk.currentRow == nil || !sdk.currentRow.Connected {
+		return -1
+	}
+
+	return sdk.tickVersion
 }
 
-func (sdk *MockSDK) IsConnected() bool {
-	if sdk.options.AutoRestart && !sdk.restartAllowedFrom.IsZero() && time.Now().After(sdk.restartAllowedFrom) {
-		return false
+// GetSessionInfoVersion returns a counter that increases whenever the recorded YAML changes
+func (sdk *MockSDK) GetSessionInfoVersion() int {
+	sdk.mux.RLock()
+	defer sdk.mux.RUnlock()
+
+	if sdk.currentRow == nil || !sdk.currentRow.Connected {
+		return -1
 	}
 
+	return sdk.sessionVersion
+}
+
+func (sdk *MockSDK) IsConnected() bool {
+	sdk.mux.RLock()
+	defer sdk.mux.RUnlock()
+
 	if sdk.currentRow == nil {
 		return false
 	}
@@ -253,6 +535,9 @@ func (sdk *MockSDK) IsConnected() bool {
 }
 
 func (sdk *MockSDK) GetYaml() string {
+	sdk.mux.RLock()
+	defer sdk.mux.RUnlock()
+
 	if sdk.currentRow == nil {
 		return ""
 	}
@@ -260,12 +545,10 @@ func (sdk *MockSDK) GetYaml() string {
 	return sdk.currentRow.YamlData
 }
 
-func (sdk *MockSDK) BroadcastMsg(msg Msg) error {
-	//TODO implement me
-	return ErrNotImplemented
-}
-
 func (sdk *MockSDK) Close() error {
+	sdk.mux.Lock()
+	defer sdk.mux.Unlock()
+
 	if sdk.replay == nil {
 		return nil
 	}
@@ -0,0 +1,184 @@
+package irsdk
+
+import (
+	"fmt"
+	"sort"
+	"time"
+)
+
+// replayFrameRate is the number of frames per second of an iRacing replay
+const replayFrameRate = 60
+
+// BroadcastMsg moves playback for the replay messages (BroadcastReplaySetPlaySpeed,
+// BroadcastReplaySetPlayPosition, BroadcastReplaySearch and BroadcastReplaySearchSessionTime).
+// Searching by lap, session or incident uses the recorded Lap, SessionNum and PlayerCar*IncidentCount
+// variables. Every other message returns ErrNotImplemented.
+func (sdk *MockSDK) BroadcastMsg(msg Msg) error {
+	switch msg.Cmd {
+	case BroadcastReplaySetPlaySpeed:
+		return sdk.replaySetPlaySpeed(msg.P1, msgParam(msg.P2) != 0)
+	case BroadcastReplaySetPlayPosition:
+		return sdk.replaySetPlayPosition(msg.P1, msgParam(msg.P2))
+	case BroadcastReplaySearch:
+		return sdk.replaySearch(msg.P1)
+	case BroadcastReplaySearchSessionTime:
+		return sdk.SeekToSessionTime(msg.P1, time.Duration(msgParam(msg.P2))*time.Millisecond)
+	default:
+		return ErrNotImplemented
+	}
+}
+
+func msgParam(p any) int {
+	v, _ := toInt(p)
+	return v
+}
+
+// replaySetPlaySpeed pauses at speed 0, in slow motion speed n plays at 1/(n+1)
+func (sdk *MockSDK) replaySetPlaySpeed(speed int, slowMotion bool) error {
+	if speed < 0 {
+		return fmt.Errorf("reverse playback is not supported: %d", speed)
+	}
+
+	if speed == 0 {
+		sdk.Pause()
+		return nil
+	}
+
+	x := float64(speed)
+	if slowMotion {
+		x = 1 / float64(speed+1)
+	}
+
+	if err := sdk.SetSpeed(x); err != nil {
+		return err
+	}
+
+	sdk.Resume()
+	return nil
+}
+
+func (sdk *MockSDK) replaySetPlayPosition(mode int, frame int) error {
+	sdk.mux.Lock()
+	defer sdk.mux.Unlock()
+
+	index, err := sdk.loadIndex()
+	if err != nil {
+		return err
+	}
+
+	if len(index) == 0 {
+		return fmt.Errorf("recording is empty")
+	}
+
+	offset := time.Duration(frame) * time.Second / replayFrameRate
+
+	var t time.Time
+	switch mode {
+	case ReplayPositionBegin:
+		t = time.UnixMilli(index[0].Timestamp).Add(offset)
+	case ReplayPositionCurrent:
+		t = sdk.position().Add(offset)
+	case ReplayPositionEnd:
+		t = time.UnixMilli(index[len(index)-1].Timestamp).Add(-offset)
+	default:
+		return fmt.Errorf("unknown replay position mode: %d", mode)
+	}
+
+	return sdk.seek(t)
+}
+
+func (sdk *MockSDK) replaySearch(mode int) error {
+	sdk.mux.Lock()
+	defer sdk.mux.Unlock()
+
+	index, err := sdk.loadIndex()
+	if err != nil {
+		return err
+	}
+
+	if len(index) == 0 {
+		return fmt.Errorf("recording is empty")
+	}
+
+	// current is the index entry being played, -1 before the first entry
+	pos := sdk.position().UnixMilli()
+	current := sort.Search(len(index), func(i int) bool {
+		return index[i].Timestamp > pos
+	}) - 1
+
+	target := -1
+	switch mode {
+	case ReplaySearchToStart:
+		target = 0
+	case ReplaySearchToEnd:
+		target = len(index) - 1
+	case ReplaySearchNextFrame:
+		target = min(current+1, len(index)-1)
+	case ReplaySearchPrevFrame:
+		target = max(current-1, 0)
+	case ReplaySearchNextSession, ReplaySearchNextLap:
+		key := sessionKey
+		if mode == ReplaySearchNextLap {
+			key = lapKey
+		}
+
+		for i := max(current, 0) + 1; i < len(index); i++ {
+			if index[i].Connected && (current < 0 || key(index[i]) != key(index[current])) {
+				target = i
+				break
+			}
+		}
+	case ReplaySearchPrevSession, ReplaySearchPrevLap:
+		key := sessionKey
+		if mode == ReplaySearchPrevLap {
+			key = lapKey
+		}
+
+		// find the start of the current run, then the start of the run before it
+		start := runStart(index, max(current, 0), key)
+		if start > 0 {
+			target = runStart(index, start-1, key)
+		} else {
+			target = 0
+		}
+	case ReplaySearchNextIncident:
+		for i := max(current, 0) + 1; i < len(index); i++ {
+			if index[i].Incidents > index[i-1].Incidents {
+				target = i
+				break
+			}
+		}
+	case ReplaySearchPrevIncident:
+		for i := current - 1; i > 0; i-- {
+			if index[i].Incidents > index[i-1].Incidents {
+				target = i
+				break
+			}
+		}
+	default:
+		return fmt.Errorf("unknown replay search mode: %d", mode)
+	}
+
+	if target < 0 {
+		return fmt.Errorf("replay search %d found nothing", mode)
+	}
+
+	return sdk.seek(time.UnixMilli(index[target].Timestamp))
+}
+
+func sessionKey(e mockIndexEntry) int {
+	return e.SessionNum
+}
+
+func lapKey(e mockIndexEntry) int {
+	return e.SessionNum<<16 | e.Lap
+}
+
+// runStart returns the first index of the run of entries sharing key with index[i]
+func runStart(index []mockIndexEntry, i int, key func(mockIndexEntry) int) int {
+	for i > 0 && key(index[i-1]) == key(index[i]) {
+		i--
+	}
+
+	return i
+}
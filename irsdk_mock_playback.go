@@ -0,0 +1,230 @@
+package irsdk
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/hfoxy/iracing-sdk/replay"
+)
+
+// Pause stops playback at the current position
+func (sdk *MockSDK) Pause() {
+	sdk.mux.Lock()
+	defer sdk.mux.Unlock()
+
+	if !sdk.paused {
+		sdk.rebase()
+		sdk.paused = true
+	}
+}
+
+// Resume continues playback from the position it was paused at
+func (sdk *MockSDK) Resume() {
+	sdk.mux.Lock()
+	defer sdk.mux.Unlock()
+
+	if sdk.paused {
+		sdk.paused = false
+		sdk.openTime = sdk.clock.Now()
+	}
+}
+
+// Paused reports whether playback is paused
+func (sdk *MockSDK) Paused() bool {
+	sdk.mux.RLock()
+	defer sdk.mux.RUnlock()
+	return sdk.paused
+}
+
+// SetSpeed changes the playback speed, 1 is real time, 0.25 quarter speed slow motion and 4 fast-forward
+func (sdk *MockSDK) SetSpeed(speed float64) error {
+	if speed <= 0 {
+		return fmt.Errorf("invalid playback speed: %v", speed)
+	}
+
+	sdk.mux.Lock()
+	defer sdk.mux.Unlock()
+
+	sdk.rebase()
+	sdk.speed = speed
+	return nil
+}
+
+// Speed returns the playback speed
+func (sdk *MockSDK) Speed() float64 {
+	sdk.mux.RLock()
+	defer sdk.mux.RUnlock()
+	return sdk.speed
+}
+
+// Position returns the current playback position as a recording timestamp
+func (sdk *MockSDK) Position() time.Time {
+	sdk.mux.RLock()
+	defer sdk.mux.RUnlock()
+	return sdk.position()
+}
+
+// Seek moves playback to the recording timestamp t. The entry at t becomes the current row and is
+// reported by the next WaitForData call. Seeking backwards reopens the recording.
+func (sdk *MockSDK) Seek(t time.Time) error {
+	sdk.mux.Lock()
+	defer sdk.mux.Unlock()
+	return sdk.seek(t)
+}
+
+// seek must be called with sdk.mux held
+func (sdk *MockSDK) seek(t time.Time) error {
+	if s, ok := sdk.replay.(replay.Seeker); ok {
+		// indexed recordings jump straight to the block holding t
+		if err := sdk.seekIndexed(s, t); err != nil {
+			return err
+		}
+	} else if sdk.ended || sdk.lastEntry == nil || t.Before(sdk.lastEntryTime) {
+		if err := sdk.rewind(); err != nil {
+			return err
+		}
+	}
+
+	sdk.startTime = t
+	sdk.openTime = sdk.clock.Now()
+
+	_, updated, err := sdk.advance()
+	if err != nil {
+		return err
+	}
+
+	sdk.pending = updated
+	return nil
+}
+
+// seekIndexed positions the reader on the last entry at or before t
+func (sdk *MockSDK) seekIndexed(s replay.Seeker, t time.Time) error {
+	if err := s.SeekTimestamp(t.UnixMilli()); err != nil {
+		return fmt.Errorf("failed to seek replay: %w", err)
+	}
+
+	var err error
+	sdk.nextEntry, err = sdk.replay.ReadEntry()
+	if err != nil {
+		return fmt.Errorf("failed to read entry: %w", err)
+	}
+
+	sdk.nextEntryTime = entryTime(sdk.nextEntry)
+	sdk.lastEntry = nil
+	sdk.lastEntryTime = time.Time{}
+	sdk.ended = false
+	sdk.endedAt = time.Time{}
+	return nil
+}
+
+// SeekToSessionTime moves playback to the first entry of session sessionNum whose SessionTime is at
+// least sessionTime, or to the last entry of that session. The whole recording is indexed on first use.
+func (sdk *MockSDK) SeekToSessionTime(sessionNum int, sessionTime time.Duration) error {
+	sdk.mux.Lock()
+	defer sdk.mux.Unlock()
+
+	index, err := sdk.loadIndex()
+	if err != nil {
+		return err
+	}
+
+	target := -1
+	for i, e := range index {
+		if !e.Connected || e.SessionNum != sessionNum {
+			continue
+		}
+
+		target = i
+		if e.SessionTime >= sessionTime.Seconds() {
+			break
+		}
+	}
+
+	if target < 0 {
+		return fmt.Errorf("session %d not found in recording", sessionNum)
+	}
+
+	return sdk.seek(time.UnixMilli(index[target].Timestamp))
+}
+
+// mockIndexEntry holds the variables needed to search a recording without decoding it again
+type mockIndexEntry struct {
+	Timestamp   int64
+	Connected   bool
+	SessionNum  int
+	SessionTime float64
+	Lap         int
+	Incidents   int // highest of the player incident counters
+}
+
+// loadIndex builds the index on first use, it must be called with sdk.mux held
+func (sdk *MockSDK) loadIndex() ([]mockIndexEntry, error) {
+	if sdk.index != nil {
+		return sdk.index, nil
+	}
+
+	r, err := sdk.open()
+	if err != nil {
+		return nil, fmt.Errorf("failed to open replay: %w", err)
+	}
+
+	defer r.Close()
+
+	index, err := buildMockIndex(r)
+	if err != nil {
+		return nil, fmt.Errorf("failed to index replay: %w", err)
+	}
+
+	sdk.index = index
+	return index, nil
+}
+
+func buildMockIndex(r replay.Reader) ([]mockIndexEntry, error) {
+	index := make([]mockIndexEntry, 0)
+	for {
+		entry, err := r.ReadEntry()
+		if err != nil {
+			if errors.Is(err, replay.ErrEndOfFile) {
+				break
+			}
+
+			return nil, err
+		}
+
+		e := mockIndexEntry{
+			Timestamp: entry.Timestamp,
+			Connected: entry.Connected,
+		}
+
+		if entry.Connected && entry.VariableData != "" {
+			vars, err := DecodeVariables(entry.VariableData)
+			if err != nil {
+				return nil, err
+			}
+
+			for _, v := range vars {
+				if len(v.Values) == 0 {
+					continue
+				}
+
+				switch v.Name {
+				case "SessionNum":
+					e.SessionNum, _ = toInt(v.Values[0])
+				case "SessionTime":
+					e.SessionTime, _ = toFloat64(v.Values[0])
+				case "Lap":
+					e.Lap, _ = toInt(v.Values[0])
+				case "PlayerCarMyIncidentCount", "PlayerCarDriverIncidentCount", "PlayerCarTeamIncidentCount":
+					if n, _ := toInt(v.Values[0]); n > e.Incidents {
+						e.Incidents = n
+					}
+				}
+			}
+		}
+
+		index = append(index, e)
+	}
+
+	return index, nil
+}
@@ -0,0 +1,579 @@
+package irsdk
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/hfoxy/iracing-sdk/replay"
+)
+
+const testYaml = "WeekendInfo:\n TrackName: spa\n"
+
+// writeTestReplay writes n connected entries, interval apart, with a "Tick" variable holding the entry index.
+// The first half of the entries is session 0 and the second half session 1, every lap is two entries
+// and an incident is recorded every third entry.
+func writeTestReplay(t *testing.T, n int, interval time.Duration) string {
+	t.Helper()
+	return writeTestReplayYaml(t, n, interval, func(int) string { return testYaml })
+}
+
+// writeTestReplayYaml is writeTestReplay with the session info of entry i returned by yaml
+func writeTestReplayYaml(t *testing.T, n int, interval time.Duration, yaml func(i int) string) string {
+	t.Helper()
+
+	fileName := filepath.Join(t.TempDir(), "test.zsitrpy")
+	w, err := replay.NewWriter(fileName)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	start := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	for i := 0; i < n; i++ {
+		vd, err := EncodeVariables([]Variable{
+			{VarType: VarTypeInt, Count: 1, Name: "Tick", Values: []any{i}},
+			{VarType: VarTypeInt, Count: 1, Name: "SessionNum", Values: []any{i * 2 / n}},
+			{VarType: VarTypeInt, Count: 1, Name: "Lap", Values: []any{i / 2}},
+			{VarType: VarTypeInt, Count: 1, Name: "PlayerCarMyIncidentCount", Values: []any{i / 3}},
+			{VarType: VarTypeDouble, Count: 1, Name: "SessionTime", Unit: "s", Values: []any{(time.Duration(i) * interval).Seconds()}},
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		err = w.WriteEntry(&replay.Entry{
+			Timestamp:    start.Add(time.Duration(i) * interval).UnixMilli(),
+			Connected:    true,
+			YamlData:     yaml(i),
+			VariableData: vd,
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err = w.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	return fileName
+}
+
+func TestMockFirstEntry(t *testing.T) {
+	sdk, err := NewMock(MockOptions{DataSourceName: writeTestReplay(t, 3, 10*time.Second)})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer sdk.Close()
+
+	ok, err := sdk.WaitForData(0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !ok || !sdk.IsConnected() {
+		t.Fatalf("expected data, got ok=%v connected=%v", ok, sdk.IsConnected())
+	}
+
+	v, err := sdk.GetVarValue("Tick")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if v != 0 {
+		t.Errorf("expected tick 0, got %v", v)
+	}
+
+	if sdk.GetYaml() != testYaml {
+		t.Errorf("unexpected yaml %q", sdk.GetYaml())
+	}
+}
+
+func TestMockConcurrentReaders(t *testing.T) {
+	sdk, err := NewMock(MockOptions{DataSourceName: writeTestReplay(t, 200, time.Millisecond)})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer sdk.Close()
+
+	done := make(chan struct{})
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				select {
+				case <-done:
+					return
+				default:
+				}
+
+				_, _ = sdk.GetVars()
+				_, _ = sdk.GetVarValue("Tick")
+				_, _ = sdk.GetVarValues("SessionTime")
+				_ = sdk.IsConnected()
+				_ = sdk.GetYaml()
+				_ = sdk.GetLastVersion()
+			}
+		}()
+	}
+
+	deadline := time.Now().Add(50 * time.Millisecond)
+	for time.Now().Before(deadline) {
+		if _, err = sdk.WaitForData(time.Millisecond); err != nil {
+			t.Error(err)
+			break
+		}
+	}
+
+	close(done)
+	wg.Wait()
+}
+
+func TestMockManualClock(t *testing.T) {
+	clock := NewManualClock(time.Unix(0, 0))
+	sdk, err := NewMock(MockOptions{DataSourceName: writeTestReplay(t, 3, time.Second), Clock: clock})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer sdk.Close()
+
+	if ok, err := sdk.WaitForData(0); err != nil || !ok {
+		t.Fatalf("expected first entry to be due, got ok=%v err=%v", ok, err)
+	}
+
+	if ok, err := sdk.WaitForData(0); err != nil || ok {
+		t.Fatalf("expected no new data, got ok=%v err=%v", ok, err)
+	}
+
+	result := make(chan bool)
+	go func() {
+		ok, err := sdk.WaitForData(time.Hour)
+		if err != nil {
+			t.Error(err)
+		}
+
+		result <- ok
+	}()
+
+	clock.Advance(500 * time.Millisecond)
+	clock.Advance(500 * time.Millisecond)
+
+	if ok := <-result; !ok {
+		t.Fatal("expected WaitForData to return the second entry")
+	}
+
+	if v, _ := sdk.GetVarValue("Tick"); v != 1 {
+		t.Errorf("expected tick 1, got %v", v)
+	}
+
+	if ok, err := sdk.Step(); err != nil || !ok {
+		t.Fatalf("expected step to read the third entry, got ok=%v err=%v", ok, err)
+	}
+
+	if v, _ := sdk.GetVarValue("Tick"); v != 2 {
+		t.Errorf("expected tick 2, got %v", v)
+	}
+}
+
+func TestMockTransport(t *testing.T) {
+	clock := NewManualClock(time.Unix(0, 0))
+	sdk, err := NewMock(MockOptions{DataSourceName: writeTestReplay(t, 10, time.Second), Clock: clock})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer sdk.Close()
+
+	tick := func() any {
+		t.Helper()
+		if _, err := sdk.WaitForData(0); err != nil {
+			t.Fatal(err)
+		}
+
+		v, _ := sdk.GetVarValue("Tick")
+		return v
+	}
+
+	if v := tick(); v != 0 {
+		t.Fatalf("expected tick 0, got %v", v)
+	}
+
+	if err = sdk.SetSpeed(4); err != nil {
+		t.Fatal(err)
+	}
+
+	clock.Advance(time.Second)
+	if v := tick(); v != 4 {
+		t.Errorf("expected tick 4 at 4x speed, got %v", v)
+	}
+
+	sdk.Pause()
+	clock.Advance(time.Minute)
+	if v := tick(); v != 4 {
+		t.Errorf("expected tick 4 while paused, got %v", v)
+	}
+
+	sdk.Resume()
+	if err = sdk.SetSpeed(0.5); err != nil {
+		t.Fatal(err)
+	}
+
+	clock.Advance(2 * time.Second)
+	if v := tick(); v != 5 {
+		t.Errorf("expected tick 5 at half speed, got %v", v)
+	}
+
+	if err = sdk.Seek(sdk.Position().Add(-4 * time.Second)); err != nil {
+		t.Fatal(err)
+	}
+
+	if v := tick(); v != 1 {
+		t.Errorf("expected tick 1 after seeking back, got %v", v)
+	}
+
+	if err = sdk.SeekToSessionTime(1, 7*time.Second); err != nil {
+		t.Fatal(err)
+	}
+
+	if v := tick(); v != 7 {
+		t.Errorf("expected tick 7 after seeking to session time, got %v", v)
+	}
+
+	if err = sdk.SeekToSessionTime(3, 0); err == nil {
+		t.Error("expected missing session error")
+	}
+
+	if err = sdk.SetSpeed(0); err == nil {
+		t.Error("expected invalid speed error")
+	}
+}
+
+func TestMockReplayBroadcast(t *testing.T) {
+	clock := NewManualClock(time.Unix(0, 0))
+	sdk, err := NewMock(MockOptions{DataSourceName: writeTestReplay(t, 10, time.Second), Clock: clock})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer sdk.Close()
+
+	steps := []struct {
+		msg  Msg
+		tick int
+	}{
+		{Msg{Cmd: BroadcastReplaySearch, P1: ReplaySearchNextLap}, 2},
+		{Msg{Cmd: BroadcastReplaySearch, P1: ReplaySearchNextLap}, 4},
+		{Msg{Cmd: BroadcastReplaySearch, P1: ReplaySearchPrevLap}, 2},
+		{Msg{Cmd: BroadcastReplaySearch, P1: ReplaySearchNextIncident}, 3},
+		{Msg{Cmd: BroadcastReplaySearch, P1: ReplaySearchNextIncident}, 6},
+		{Msg{Cmd: BroadcastReplaySearch, P1: ReplaySearchPrevIncident}, 3},
+		{Msg{Cmd: BroadcastReplaySearch, P1: ReplaySearchNextSession}, 5},
+		{Msg{Cmd: BroadcastReplaySearch, P1: ReplaySearchPrevFrame}, 4},
+		{Msg{Cmd: BroadcastReplaySearch, P1: ReplaySearchToEnd}, 9},
+		{Msg{Cmd: BroadcastReplaySearch, P1: ReplaySearchPrevSession}, 0},
+		{Msg{Cmd: BroadcastReplaySetPlayPosition, P1: ReplayPositionBegin, P2: 120}, 2},
+		{Msg{Cmd: BroadcastReplaySetPlayPosition, P1: ReplayPositionCurrent, P2: 60}, 3},
+		{Msg{Cmd: BroadcastReplaySetPlayPosition, P1: ReplayPositionEnd, P2: 60}, 8},
+		{Msg{Cmd: BroadcastReplaySearchSessionTime, P1: 1, P2: 6000}, 6},
+	}
+
+	for _, step := range steps {
+		if err = sdk.BroadcastMsg(step.msg); err != nil {
+			t.Fatalf("broadcast %+v: %v", step.msg, err)
+		}
+
+		if ok, err := sdk.WaitForData(0); err != nil || !ok {
+			t.Fatalf("broadcast %+v: expected data, got ok=%v err=%v", step.msg, ok, err)
+		}
+
+		if v, _ := sdk.GetVarValue("Tick"); v != step.tick {
+			t.Errorf("broadcast %+v: expected tick %d, got %v", step.msg, step.tick, v)
+		}
+	}
+
+	if err = sdk.BroadcastMsg(Msg{Cmd: BroadcastReplaySetPlaySpeed, P1: 0}); err != nil || !sdk.Paused() {
+		t.Errorf("expected speed 0 to pause, got err=%v paused=%v", err, sdk.Paused())
+	}
+
+	if err = sdk.BroadcastMsg(Msg{Cmd: BroadcastReplaySetPlaySpeed, P1: 3, P2: 1}); err != nil || sdk.Paused() || sdk.Speed() != 0.25 {
+		t.Errorf("expected quarter speed slow motion, got err=%v paused=%v speed=%v", err, sdk.Paused(), sdk.Speed())
+	}
+}
+
+func TestMockEndLoop(t *testing.T) {
+	clock := NewManualClock(time.Unix(0, 0))
+	ends := 0
+	sdk, err := NewMock(MockOptions{
+		DataSourceName:   writeTestReplay(t, 2, time.Second),
+		Clock:            clock,
+		EndBehavior:      EndLoop,
+		AutoRestartDelay: 5 * time.Second,
+		OnEnd:            func() { ends++ },
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer sdk.Close()
+
+	if ok, err := sdk.Step(); err != nil || !ok {
+		t.Fatalf("expected first entry, got ok=%v err=%v", ok, err)
+	}
+
+	if ok, err := sdk.Step(); err != nil || !ok {
+		t.Fatalf("expected last entry, got ok=%v err=%v", ok, err)
+	}
+
+	if ends != 1 {
+		t.Errorf("expected OnEnd to be called once, got %d", ends)
+	}
+
+	clock.Advance(time.Second)
+	if _, err = sdk.WaitForData(0); err != nil {
+		t.Fatal(err)
+	}
+
+	if sdk.IsConnected() {
+		t.Error("expected the mock to be disconnected between loops")
+	}
+
+	clock.Advance(5 * time.Second)
+	if ok, err := sdk.WaitForData(0); err != nil || !ok || !sdk.IsConnected() {
+		t.Fatalf("expected the recording to restart, got ok=%v err=%v", ok, err)
+	}
+
+	if v, _ := sdk.GetVarValue("Tick"); v != 0 {
+		t.Errorf("expected tick 0 after restart, got %v", v)
+	}
+}
+
+func TestMockEndError(t *testing.T) {
+	clock := NewManualClock(time.Unix(0, 0))
+	sdk, err := NewMock(MockOptions{
+		DataSourceName: writeTestReplay(t, 2, time.Second),
+		Clock:          clock,
+		EndBehavior:    EndError,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer sdk.Close()
+
+	clock.Advance(time.Second)
+	if ok, err := sdk.WaitForData(0); err != nil || !ok {
+		t.Fatalf("expected last entry, got ok=%v err=%v", ok, err)
+	}
+
+	if _, err = sdk.WaitForData(time.Second); !errors.Is(err, ErrEndOfRecording) {
+		t.Errorf("expected end of recording error, got %v", err)
+	}
+
+	if err = sdk.Seek(sdk.Position().Add(-time.Second)); err != nil {
+		t.Fatal(err)
+	}
+
+	if ok, err := sdk.WaitForData(0); err != nil || !ok {
+		t.Errorf("expected data after seeking back, got ok=%v err=%v", ok, err)
+	}
+}
+
+func TestMockVersions(t *testing.T) {
+	clock := NewManualClock(time.Unix(0, 0))
+	fileName := writeTestReplayYaml(t, 4, time.Second, func(i int) string {
+		return testYaml + fmt.Sprintf("SessionInfo:\n Revision: %d\n", i/2)
+	})
+
+	sdk, err := NewMock(MockOptions{DataSourceName: fileName, Clock: clock})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer sdk.Close()
+
+	if v := sdk.GetLastVersion(); v != -1 {
+		t.Errorf("expected version -1 before the first entry, got %d", v)
+	}
+
+	versions := make([][2]int, 0)
+	for i := 0; i < 4; i++ {
+		if _, err = sdk.Step(); err != nil {
+			t.Fatal(err)
+		}
+
+		versions = append(versions, [2]int{sdk.GetLastVersion(), sdk.GetSessionInfoVersion()})
+	}
+
+	expected := [][2]int{{1, 1}, {2, 1}, {3, 2}, {4, 2}}
+	for i := range expected {
+		if versions[i] != expected[i] {
+			t.Errorf("entry %d: expected tick and session versions %v, got %v", i, expected[i], versions[i])
+		}
+	}
+
+	if err = sdk.Seek(sdk.Position().Add(-3 * time.Second)); err != nil {
+		t.Fatal(err)
+	}
+
+	if v := sdk.GetLastVersion(); v <= 4 {
+		t.Errorf("expected version to keep increasing after seeking back, got %d", v)
+	}
+
+	if err = sdk.RefreshSession(); err != nil {
+		t.Error(err)
+	}
+}
+
+// writeTestIbt writes a telemetry file with n rows at 60Hz holding SessionTime, Lap and CarIdxLap,
+// where the second car has not started a lap
+func writeTestIbt(t *testing.T, n int) string {
+	t.Helper()
+
+	vars := []Variable{
+		{VarType: VarTypeDouble, Offset: 0, Count: 1, Name: "SessionTime", Unit: "s"},
+		{VarType: VarTypeInt, Offset: 8, Count: 1, Name: "Lap"},
+		{VarType: VarTypeInt, Offset: 12, Count: 2, Name: "CarIdxLap"},
+	}
+
+	const bufLen = 20
+	yamlOffset := diskSubHeaderOffset + diskSubHeaderSize + len(vars)*varHeaderSize
+	rowOffset := yamlOffset + len(testYaml)
+
+	data := make([]byte, rowOffset+n*bufLen)
+	put := func(offset, v int) {
+		binary.LittleEndian.PutUint32(data[offset:], uint32(int32(v)))
+	}
+
+	put(0, 2)  // version
+	put(4, 1)  // status
+	put(8, 60) // tick rate
+	put(16, len(testYaml))
+	put(20, yamlOffset)
+	put(24, len(vars))
+	put(28, diskSubHeaderOffset+diskSubHeaderSize)
+	put(32, 1) // numBuf
+	put(36, bufLen)
+	put(52, rowOffset)
+
+	binary.LittleEndian.PutUint64(data[diskSubHeaderOffset:], uint64(time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC).Unix()))
+	put(diskSubHeaderOffset+28, n)
+
+	for i, v := range vars {
+		h := diskSubHeaderOffset + diskSubHeaderSize + i*varHeaderSize
+		put(h, int(v.VarType))
+		put(h+4, v.Offset)
+		put(h+8, v.Count)
+		copy(data[h+16:], v.Name)
+		copy(data[h+112:], v.Unit)
+	}
+
+	copy(data[yamlOffset:], testYaml)
+
+	for i := 0; i < n; i++ {
+		row := rowOffset + i*bufLen
+		binary.LittleEndian.PutUint64(data[row:], math.Float64bits(float64(i)/60))
+		put(row+8, i/30)
+		put(row+12, i/30)
+		put(row+16, -1)
+	}
+
+	fileName := filepath.Join(t.TempDir(), "test.ibt")
+	if err := os.WriteFile(fileName, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	return fileName
+}
+
+func TestMockIbt(t *testing.T) {
+	sdk, err := NewMock(MockOptions{DataSourceName: writeTestIbt(t, 90), Clock: NewManualClock(time.Unix(0, 0))})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer sdk.Close()
+
+	for i := 0; i < 61; i++ {
+		if ok, err := sdk.Step(); err != nil || !ok {
+			t.Fatalf("row %d: expected data, got ok=%v err=%v", i, ok, err)
+		}
+	}
+
+	if v, _ := sdk.GetVarValue("SessionTime"); v != 1.0 {
+		t.Errorf("expected session time 1s, got %v", v)
+	}
+
+	values, err := sdk.GetVarValues("CarIdxLap")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if laps := values.([]any); laps[0] != 2 || laps[1] != -1 {
+		t.Errorf("unexpected lap values %v", laps)
+	}
+
+	if sdk.GetYaml() != testYaml {
+		t.Errorf("unexpected yaml %q", sdk.GetYaml())
+	}
+}
+
+func TestMockPlaylist(t *testing.T) {
+	clock := NewManualClock(time.Unix(0, 0))
+	first := writeTestReplay(t, 3, time.Second)
+	second := writeTestReplayYaml(t, 3, time.Second, func(int) string { return testYaml + "SessionInfo:\n Revision: 2\n" })
+
+	sdk, err := NewMock(MockOptions{
+		DataSourceNames: []string{first, second, writeTestIbt(t, 2)},
+		PlaylistGap:     5 * time.Second,
+		Clock:           clock,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer sdk.Close()
+
+	type step struct {
+		connected bool
+		tick      any
+		session   int
+	}
+
+	steps := make([]step, 0)
+	for !sdk.ended {
+		if _, err = sdk.Step(); err != nil {
+			t.Fatal(err)
+		}
+
+		tick, _ := sdk.GetVarValue("Tick")
+		steps = append(steps, step{sdk.IsConnected(), tick, sdk.GetSessionInfoVersion()})
+	}
+
+	expected := []step{
+		{true, 0, 1}, {true, 1, 1}, {true, 2, 1},
+		{false, nil, -1},
+		{true, 0, 2}, {true, 1, 2}, {true, 2, 2},
+		{false, nil, -1},
+		{true, nil, 3}, {true, nil, 3},
+	}
+
+	if fmt.Sprint(steps) != fmt.Sprint(expected) {
+		t.Errorf("expected %v, got %v", expected, steps)
+	}
+
+	// the playlist is one continuous stream, the gaps are the only time between the recordings
+	if d := sdk.Position().Sub(time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)); d != 14*time.Second+16*time.Millisecond {
+		t.Errorf("unexpected playlist length %v", d)
+	}
+}
@@ -9,13 +9,20 @@ import (
 
 // New creates SDK instance to operate with
 func New() (SDK, error) {
-	r, err := shm.Open(fileMapName, fileMapSize)
+	return NewWithOptions(Options{})
+}
+
+// NewWithOptions creates SDK instance using the given shared memory, event and logging options
+func NewWithOptions(opts Options) (SDK, error) {
+	opts = opts.withDefaults()
+
+	r, err := shm.Open(opts.MapName, opts.MapSize)
 	if err != nil {
 		return nil, err
 	}
 
-	sdk := &IRSDK{r: r, lastValidData: 0}
-	winevents.OpenEvent(dataValidEventName)
+	sdk := &IRSDK{r: r, logger: opts.Logger, options: opts}
+	winevents.OpenEvent(opts.EventName)
 	err = sdk.init()
 	if err != nil {
 		return nil, err
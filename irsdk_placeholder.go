@@ -13,6 +13,10 @@ func New() (SDK, error) {
 	return &IRSDK{}, nil
 }
 
+func NewWithOptions(opts Options) (SDK, error) {
+	return &IRSDK{}, nil
+}
+
 func (sdk *IRSDK) RefreshSession() error {
 	//TODO implement me
 	return ErrNotImplemented
@@ -43,6 +47,10 @@ func (sdk *IRSDK) GetLastVersion() int {
 	return -1
 }
 
+func (sdk *IRSDK) GetSessionInfoVersion() int {
+	return -1
+}
+
 func (sdk *IRSDK) IsConnected() bool {
 	return false
 }
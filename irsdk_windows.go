@@ -5,17 +5,26 @@ package irsdk
 import (
 	"fmt"
 	"github.com/hfoxy/iracing-sdk/winevents"
+	"sync"
 	"time"
 )
 
-// IRSDK is the main SDK object clients must use
+// IRSDK is the main SDK object clients must use.
+// WaitForData, RefreshSession and Close must be called from a single goroutine, every other method
+// may be called concurrently with them.
 type IRSDK struct {
 	SDK
-	r             reader
+	logger  Logger
+	options Options
+	r       reader
+
+	mux           sync.RWMutex // guards the fields below
 	h             *header
 	s             string
+	sVersion      int // sessionInfoUpdate of the header s was read with
 	tVars         *TelemetryVars
-	lastValidData int64
+	lastValidData time.Time
+	connected     bool
 }
 
 func (sdk *IRSDK) init() error {
@@ -24,13 +33,18 @@ func (sdk *IRSDK) init() error {
 		return err
 	}
 
+	sdk.mux.Lock()
+	if sdk.h != nil && !sdk.h.sameLayout(&h) {
+		sdk.logger.Info("telemetry layout changed", "numVars", h.numVars, "bufLen", h.bufLen, "numBuf", h.numBuf)
+	}
+
 	sdk.h = &h
 	sdk.s = ""
-	if sdk.tVars != nil {
-		sdk.tVars.vars = nil
-	}
+	sdk.sVersion = -1
+	sdk.tVars = nil
+	sdk.mux.Unlock()
 
-	if sdk.sessionStatusOK() {
+	if h.sessionConnected() {
 		err = sdk.RefreshSession()
 		if err != nil {
 			return err
@@ -42,87 +56,140 @@ func (sdk *IRSDK) init() error {
 			return err
 		}
 
+		sdk.mux.Lock()
 		sdk.tVars = tVars
+		sdk.mux.Unlock()
 
 		_, err = sdk.readVariableValues()
 		if err != nil {
+			sdk.logger.Error("failed to decode telemetry", "error", err)
 			return err
 		}
+
+		sdk.mux.Lock()
+		defer sdk.mux.Unlock()
+
+		if !sdk.connected && sdk.isConnected() {
+			sdk.connected = true
+			sdk.logger.Info("connected to iRacing", "version", h.version, "tickRate", h.tickRate, "numVars", h.numVars)
+		}
 	}
 
 	return nil
 }
 
 func (sdk *IRSDK) RefreshSession() error {
-	if sdk.sessionStatusOK() {
-		sRaw, err := readSessionData(sdk.r, sdk.h)
+	sdk.mux.RLock()
+	h := sdk.h
+	sdk.mux.RUnlock()
+
+	if h.sessionConnected() {
+		sRaw, err := readSessionData(sdk.r, h)
 		if err != nil {
 			return err
 		}
 
+		sdk.mux.Lock()
 		sdk.s = sRaw
+		sdk.sVersion = h.sessionInfoUpdate
+		sdk.mux.Unlock()
 	}
 
 	return nil
 }
 
-func (sdk *IRSDK) sessionStatusOK() bool {
-	return (sdk.h.status & stConnected) > 0
+// state returns the header and variables, or nil variables if the session is not active
+func (sdk *IRSDK) state() (*header, *TelemetryVars) {
+	sdk.mux.RLock()
+	defer sdk.mux.RUnlock()
+
+	if !sdk.h.sessionConnected() {
+		return sdk.h, nil
+	}
+
+	return sdk.h, sdk.tVars
 }
 
 func (sdk *IRSDK) WaitForData(timeout time.Duration) (bool, error) {
 	if !sdk.IsConnected() {
+		sdk.mux.Lock()
+		if sdk.connected {
+			sdk.connected = false
+			sdk.logger.Info("disconnected from iRacing", "lastValidData", sdk.lastValidData.Format(time.RFC3339))
+		}
+		sdk.mux.Unlock()
+
 		return false, sdk.init()
 	}
 
 	if winevents.WaitForSingleObject(timeout) {
-		err := sdk.RefreshSession()
+		h, err := readHeader(sdk.r)
 		if err != nil {
 			return false, err
 		}
 
-		return sdk.readVariableValues()
+		sdk.mux.Lock()
+		if !sdk.h.sameLayout(&h) {
+			sdk.mux.Unlock()
+			return false, sdk.init()
+		}
+
+		sdk.h = &h
+		refresh := h.sessionInfoUpdate != sdk.sVersion
+		sdk.mux.Unlock()
+
+		if refresh {
+			err = sdk.RefreshSession()
+			if err != nil {
+				sdk.logger.Error("failed to read session info", "error", err)
+				return false, err
+			}
+		}
+
+		ok, err := sdk.readVariableValues()
+		if err != nil {
+			sdk.logger.Error("failed to decode telemetry", "error", err)
+		}
+
+		return ok, err
 	}
 
 	return false, nil
 }
 
 func (sdk *IRSDK) GetVars() ([]Variable, error) {
-	if !sdk.sessionStatusOK() {
+	_, tVars := sdk.state()
+	if tVars == nil {
 		return make([]Variable, 0), fmt.Errorf("session is not active")
 	}
 
-	results := make([]Variable, len(sdk.tVars.vars))
+	tVars.mux.RLock()
+	defer tVars.mux.RUnlock()
 
-	sdk.tVars.mux.Lock()
-	defer sdk.tVars.mux.Unlock()
-
-	idx := 0
-	for _, variable := range sdk.tVars.vars {
-		results[idx] = variable
-		idx++
+	results := make([]Variable, 0, len(tVars.vars))
+	for _, variable := range tVars.vars {
+		results = append(results, variable)
 	}
 
 	return results, nil
 }
 
 func (sdk *IRSDK) GetVar(name string) (Variable, error) {
-	if !sdk.sessionStatusOK() {
+	_, tVars := sdk.state()
+	if tVars == nil {
 		return Variable{}, fmt.Errorf("session is not active")
 	}
 
-	sdk.tVars.mux.Lock()
-	defer sdk.tVars.mux.Unlock()
+	tVars.mux.RLock()
+	defer tVars.mux.RUnlock()
 
-	if v, ok := sdk.tVars.vars[name]; ok {
+	if v, ok := tVars.vars[name]; ok {
 		return v, nil
 	}
 
 	return Variable{}, fmt.Errorf("telemetry variable %q not found", name)
 }
 
-var ErrNoValue = fmt.Errorf("no value")
-
 func (sdk *IRSDK) GetVarValue(name string) (any, error) {
 	var r Variable
 	var err error
@@ -150,26 +217,41 @@ func (sdk *IRSDK) GetVarValues(name string) (interface{}, error) {
 }
 
 func (sdk *IRSDK) GetLastVersion() int {
-	if !sdk.sessionStatusOK() {
+	_, tVars := sdk.state()
+	if tVars == nil {
 		return -1
 	}
-	sdk.tVars.mux.Lock()
-	defer sdk.tVars.mux.Unlock()
-	last := sdk.tVars.lastVersion
-	return last
+
+	tVars.mux.RLock()
+	defer tVars.mux.RUnlock()
+	return tVars.lastVersion
 }
 
-func (sdk *IRSDK) IsConnected() bool {
-	if sdk.h != nil {
-		if sdk.sessionStatusOK() && (sdk.lastValidData+connTimeout > time.Now().Unix()) {
-			return true
-		}
+func (sdk *IRSDK) GetSessionInfoVersion() int {
+	sdk.mux.RLock()
+	defer sdk.mux.RUnlock()
+
+	if !sdk.h.sessionConnected() {
+		return -1
 	}
 
-	return false
+	return sdk.sVersion
+}
+
+func (sdk *IRSDK) IsConnected() bool {
+	sdk.mux.RLock()
+	defer sdk.mux.RUnlock()
+	return sdk.isConnected()
+}
+
+// isConnected must be called with sdk.mux held
+func (sdk *IRSDK) isConnected() bool {
+	return sdk.h.sessionConnected() && time.Since(sdk.lastValidData) < sdk.options.ConnectionTimeout
 }
 
 func (sdk *IRSDK) GetYaml() string {
+	sdk.mux.RLock()
+	defer sdk.mux.RUnlock()
 	return sdk.s
 }
 
@@ -178,7 +260,7 @@ func (sdk *IRSDK) BroadcastMsg(msg Msg) error {
 		msg.P2 = 0
 	}
 
-	_, err := winevents.BroadcastMsg(broadcastMsgName, msg.Cmd, msg.P1, msg.P2, msg.P3)
+	_, err := winevents.BroadcastMsg(sdk.options.BroadcastMsgName, msg.Cmd, msg.P1, msg.P2, msg.P3)
 	return err
 }
 
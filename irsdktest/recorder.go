@@ -0,0 +1,220 @@
+// Package irsdktest provides helpers for testing code that drives an irsdk.SDK
+package irsdktest
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/hfoxy/iracing-sdk"
+)
+
+// Call is a single BroadcastMsg call seen by a Recorder
+type Call struct {
+	Time    time.Time
+	Msg     irsdk.Msg
+	Command string // irsdk.DescribeMsg of Msg
+	Err     error  // error returned by the wrapped SDK
+}
+
+func (c Call) String() string {
+	return fmt.Sprintf("%s %s", c.Time.Format("15:04:05.000"), c.Command)
+}
+
+// Recorder wraps an SDK and records every BroadcastMsg call. Messages are still forwarded to the
+// wrapped SDK, so a MockSDK keeps reacting to replay messages, but irsdk.ErrNotImplemented is
+// swallowed so pit, camera and chat commands succeed as they would against the simulator.
+// The wrapped SDK may be nil, in which case the Recorder is only a sink for messages and behaves as
+// an SDK that is never connected.
+type Recorder struct {
+	irsdk.SDK
+	clock irsdk.Clock
+
+	mux   sync.Mutex
+	calls []Call
+}
+
+// NewRecorder wraps sdk, timestamping calls with the system clock
+func NewRecorder(sdk irsdk.SDK) *Recorder {
+	return NewRecorderWithClock(sdk, irsdk.SystemClock)
+}
+
+// NewRecorderWithClock wraps sdk, timestamping calls with clock
+func NewRecorderWithClock(sdk irsdk.SDK, clock irsdk.Clock) *Recorder {
+	if sdk == nil {
+		sdk = disconnectedSDK{}
+	}
+
+	return &Recorder{SDK: sdk, clock: clock}
+}
+
+// Unwrap returns the wrapped SDK, nil when the Recorder was created without one
+func (r *Recorder) Unwrap() irsdk.SDK {
+	if _, ok := r.SDK.(disconnectedSDK); ok {
+		return nil
+	}
+
+	return r.SDK
+}
+
+func (r *Recorder) BroadcastMsg(msg irsdk.Msg) error {
+	err := r.SDK.BroadcastMsg(msg)
+	if errors.Is(err, irsdk.ErrNotImplemented) {
+		err = nil
+	}
+
+	r.mux.Lock()
+	defer r.mux.Unlock()
+
+	r.calls = append(r.calls, Call{
+		Time:    r.clock.Now(),
+		Msg:     msg,
+		Command: irsdk.DescribeMsg(msg),
+		Err:     err,
+	})
+
+	return err
+}
+
+// Calls returns every recorded call in order
+func (r *Recorder) Calls() []Call {
+	r.mux.Lock()
+	defer r.mux.Unlock()
+	return append([]Call(nil), r.calls...)
+}
+
+// Commands returns the description of every recorded call in order
+func (r *Recorder) Commands() []string {
+	calls := r.Calls()
+	commands := make([]string, len(calls))
+	for i, c := range calls {
+		commands[i] = c.Command
+	}
+
+	return commands
+}
+
+// CallsFor returns the recorded calls of one broadcast type, e.g. irsdk.BroadcastPitCommand
+func (r *Recorder) CallsFor(cmd int) []Call {
+	calls := make([]Call, 0)
+	for _, c := range r.Calls() {
+		if c.Msg.Cmd == cmd {
+			calls = append(calls, c)
+		}
+	}
+
+	return calls
+}
+
+// Reset forgets every recorded call
+func (r *Recorder) Reset() {
+	r.mux.Lock()
+	defer r.mux.Unlock()
+	r.calls = nil
+}
+
+func (r *Recorder) count(command string) int {
+	n := 0
+	for _, c := range r.Calls() {
+		if c.Command == command {
+			n++
+		}
+	}
+
+	return n
+}
+
+func (r *Recorder) dump() string {
+	calls := r.Calls()
+	if len(calls) == 0 {
+		return "no calls recorded"
+	}
+
+	lines := make([]string, len(calls))
+	for i, c := range calls {
+		lines[i] = "  " + c.String()
+	}
+
+	return "recorded calls:\n" + strings.Join(lines, "\n")
+}
+
+// AssertSent fails t unless command was sent at least once
+func (r *Recorder) AssertSent(t testing.TB, command string) {
+	t.Helper()
+	if r.count(command) == 0 {
+		t.Errorf("expected %q to be sent, %s", command, r.dump())
+	}
+}
+
+// AssertNotSent fails t if command was sent
+func (r *Recorder) AssertNotSent(t testing.TB, command string) {
+	t.Helper()
+	if r.count(command) != 0 {
+		t.Errorf("expected %q not to be sent, %s", command, r.dump())
+	}
+}
+
+// AssertSentCount fails t unless command was sent exactly n times
+func (r *Recorder) AssertSentCount(t testing.TB, command string, n int) {
+	t.Helper()
+	if c := r.count(command); c != n {
+		t.Errorf("expected %q to be sent %d times, got %d, %s", command, n, c, r.dump())
+	}
+}
+
+// AssertSequence fails t unless commands were sent in this order, other calls may be interleaved
+func (r *Recorder) AssertSequence(t testing.TB, commands ...string) {
+	t.Helper()
+
+	i := 0
+	for _, c := range r.Calls() {
+		if i < len(commands) && c.Command == commands[i] {
+			i++
+		}
+	}
+
+	if i < len(commands) {
+		t.Errorf("expected sequence %q, missing %q, %s", commands, commands[i], r.dump())
+	}
+}
+
+// AssertNoCalls fails t if any message was sent
+func (r *Recorder) AssertNoCalls(t testing.TB) {
+	t.Helper()
+	if len(r.Calls()) != 0 {
+		t.Errorf("expected no calls, %s", r.dump())
+	}
+}
+
+// disconnectedSDK stands in for a nil SDK, it never has data and accepts every message
+type disconnectedSDK struct{}
+
+func (disconnectedSDK) WaitForData(timeout time.Duration) (bool, error) {
+	return false, nil
+}
+
+func (disconnectedSDK) GetVars() ([]irsdk.Variable, error) {
+	return nil, nil
+}
+
+func (disconnectedSDK) GetVar(name string) (irsdk.Variable, error) {
+	return irsdk.Variable{}, fmt.Errorf("variable not found: %s", name)
+}
+
+func (disconnectedSDK) GetVarValue(name string) (interface{}, error) {
+	return nil, irsdk.ErrNoValue
+}
+
+func (disconnectedSDK) GetVarValues(name string) (interface{}, error) {
+	return nil, irsdk.ErrNoValue
+}
+
+func (disconnectedSDK) RefreshSession() error        { return nil }
+func (disconnectedSDK) GetLastVersion() int          { return -1 }
+func (disconnectedSDK) IsConnected() bool            { return false }
+func (disconnectedSDK) GetYaml() string              { return "" }
+func (disconnectedSDK) BroadcastMsg(irsdk.Msg) error { return nil }
+func (disconnectedSDK) Close() error                 { return nil }
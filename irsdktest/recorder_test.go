@@ -0,0 +1,63 @@
+package irsdktest
+
+import (
+	"testing"
+	"time"
+
+	"github.com/hfoxy/iracing-sdk"
+)
+
+func TestRecorder(t *testing.T) {
+	clock := irsdk.NewManualClock(time.Unix(100, 0))
+	r := NewRecorderWithClock(nil, clock)
+	if ok, err := r.WaitForData(time.Second); ok || err != nil || r.IsConnected() || r.Unwrap() != nil {
+		t.Errorf("expected a recorder without sdk to be disconnected, got %v %v", ok, err)
+	}
+
+	msgs := []irsdk.Msg{
+		{Cmd: irsdk.BroadcastPitCommand, P1: irsdk.PitCommandClear},
+		{Cmd: irsdk.BroadcastPitCommand, P1: irsdk.PitCommandFuel, P2: 20},
+		{Cmd: irsdk.BroadcastPitCommand, P1: irsdk.PitCommandLF, P2: 180},
+		{Cmd: irsdk.BroadcastCameraSwitchNum, P1: 42, P2: 3, P3: 1},
+		{Cmd: irsdk.BroadcastCameraSwitchPos, P1: irsdk.CameraSwitchFocusAtLeader, P2: 2},
+		{Cmd: irsdk.BroadcastReplaySearch, P1: irsdk.ReplaySearchNextIncident},
+		{Cmd: irsdk.BroadcastFFBCommand, P1: irsdk.FFBCommandMaxForce, P2: 12.5},
+	}
+
+	for _, msg := range msgs {
+		if err := r.BroadcastMsg(msg); err != nil {
+			t.Fatal(err)
+		}
+
+		clock.Advance(time.Second)
+	}
+
+	expected := []string{
+		"pit clear",
+		"pit fuel 20 litres",
+		"pit change left front tire 180 kPa",
+		"camera switch to car #42 group 3 camera 1",
+		"camera switch to leader group 2 camera 0",
+		"replay search next incident",
+		"ffb max force 12.5 Nm",
+	}
+
+	commands := r.Commands()
+	for i := range expected {
+		if commands[i] != expected[i] {
+			t.Errorf("call %d: expected %q, got %q", i, expected[i], commands[i])
+		}
+	}
+
+	r.AssertSent(t, "pit fuel 20 litres")
+	r.AssertNotSent(t, "pit fast repair")
+	r.AssertSentCount(t, "pit clear", 1)
+	r.AssertSequence(t, "pit clear", "pit fuel 20 litres", "replay search next incident")
+
+	if calls := r.CallsFor(irsdk.BroadcastPitCommand); len(calls) != 3 || !calls[1].Time.Equal(time.Unix(101, 0)) {
+		t.Errorf("unexpected pit calls %v", calls)
+	}
+
+	r.Reset()
+	r.AssertNoCalls(t)
+}
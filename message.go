@@ -1,5 +1,7 @@
 package irsdk
 
+import "fmt"
+
 type Msg struct {
 	Cmd int
 	P1  int
@@ -100,3 +102,148 @@ const (
 	CameraSwitchFocusAtExiting  int = -1
 	CameraSwitchFocusAtDriver   int = 0 // ctFocusAtDriver + car number...
 )
+
+// DescribeMsg returns a human readable description of a broadcast message, e.g. "pit fuel 20 litres"
+// or "camera switch to car #42 group 3 camera 1"
+func DescribeMsg(msg Msg) string {
+	p2, _ := toInt(msg.P2)
+
+	switch msg.Cmd {
+	case BroadcastCameraSwitchPos:
+		return fmt.Sprintf("camera switch to %s group %d camera %d", describeCameraFocus(msg.P1, "position %d"), p2, msg.P3)
+	case BroadcastCameraSwitchNum:
+		return fmt.Sprintf("camera switch to %s group %d camera %d", describeCameraFocus(msg.P1, "car #%d"), p2, msg.P3)
+	case BroadcastCameraSetState:
+		return fmt.Sprintf("camera set state 0x%04x", msg.P1)
+	case BroadcastReplaySetPlaySpeed:
+		if p2 != 0 {
+			return fmt.Sprintf("replay play speed %d slow motion", msg.P1)
+		}
+
+		return fmt.Sprintf("replay play speed %d", msg.P1)
+	case BroadcastReplaySetPlayPosition:
+		return fmt.Sprintf("replay position %s frame %d", lookup(replayPositionNames, msg.P1), p2)
+	case BroadcastReplaySearch:
+		return fmt.Sprintf("replay search %s", lookup(replaySearchNames, msg.P1))
+	case BroadcastReplaySetState:
+		if msg.P1 == ReplayStateEraseTape {
+			return "replay erase tape"
+		}
+
+		return fmt.Sprintf("replay state %d", msg.P1)
+	case BroadcastReloadTextures:
+		if msg.P1 == ReloadTexturesCarIdx {
+			return fmt.Sprintf("reload textures for car %d", p2)
+		}
+
+		return "reload all textures"
+	case BroadcastChatCommand:
+		if msg.P1 == ChatCommandMacro {
+			return fmt.Sprintf("chat macro %d", p2)
+		}
+
+		return fmt.Sprintf("chat %s", lookup(chatCommandNames, msg.P1))
+	case BroadcastPitCommand:
+		return describePitCommand(msg.P1, p2)
+	case BroadcastTelemetryCommand:
+		return fmt.Sprintf("telemetry %s", lookup(telemetryCommandNames, msg.P1))
+	case BroadcastFFBCommand:
+		if msg.P1 == FFBCommandMaxForce {
+			force, _ := toFloat64(msg.P2)
+			return fmt.Sprintf("ffb max force %g Nm", force)
+		}
+
+		return fmt.Sprintf("ffb command %d", msg.P1)
+	case BroadcastReplaySearchSessionTime:
+		return fmt.Sprintf("replay search session %d time %.3fs", msg.P1, float64(p2)/1000)
+	default:
+		return fmt.Sprintf("broadcast %d (%d, %v, %d)", msg.Cmd, msg.P1, msg.P2, msg.P3)
+	}
+}
+
+func describeCameraFocus(p1 int, format string) string {
+	switch p1 {
+	case CameraSwitchFocusAtIncident:
+		return "incident"
+	case CameraSwitchFocusAtLeader:
+		return "leader"
+	case CameraSwitchFocusAtExiting:
+		return "exiting car"
+	default:
+		return fmt.Sprintf(format, p1)
+	}
+}
+
+func describePitCommand(cmd int, p int) string {
+	switch cmd {
+	case PitCommandFuel:
+		if p == 0 {
+			return "pit fuel"
+		}
+
+		return fmt.Sprintf("pit fuel %d litres", p)
+	case PitCommandLF, PitCommandRF, PitCommandLR, PitCommandRR:
+		if p == 0 {
+			return fmt.Sprintf("pit change %s tire", lookup(pitCommandNames, cmd))
+		}
+
+		return fmt.Sprintf("pit change %s tire %d kPa", lookup(pitCommandNames, cmd), p)
+	default:
+		return fmt.Sprintf("pit %s", lookup(pitCommandNames, cmd))
+	}
+}
+
+func lookup(names map[int]string, v int) string {
+	if name, ok := names[v]; ok {
+		return name
+	}
+
+	return fmt.Sprintf("%d", v)
+}
+
+var replayPositionNames = map[int]string{
+	ReplayPositionBegin:   "begin",
+	ReplayPositionCurrent: "current",
+	ReplayPositionEnd:     "end",
+}
+
+var replaySearchNames = map[int]string{
+	ReplaySearchToStart:      "to start",
+	ReplaySearchToEnd:        "to end",
+	ReplaySearchPrevSession:  "previous session",
+	ReplaySearchNextSession:  "next session",
+	ReplaySearchPrevLap:      "previous lap",
+	ReplaySearchNextLap:      "next lap",
+	ReplaySearchPrevFrame:    "previous frame",
+	ReplaySearchNextFrame:    "next frame",
+	ReplaySearchPrevIncident: "previous incident",
+	ReplaySearchNextIncident: "next incident",
+}
+
+var chatCommandNames = map[int]string{
+	ChatCommandMacro:     "macro",
+	ChatCommandBeginChat: "begin",
+	ChatCommandReply:     "reply",
+	ChatCommandCancel:    "cancel",
+}
+
+var pitCommandNames = map[int]string{
+	PitCommandClear:      "clear",
+	PitCommandWS:         "windshield",
+	PitCommandFuel:       "fuel",
+	PitCommandLF:         "left front",
+	PitCommandRF:         "right front",
+	PitCommandLR:         "left rear",
+	PitCommandRR:         "right rear",
+	PitCommandClearTires: "clear tires",
+	PitCommandFR:         "fast repair",
+	PitCommandClearWS:    "clear windshield",
+	PitCommandClearFR:    "clear fast repair",
+	PitCommandClearFuel:  "clear fuel",
+}
+
+var telemetryCommandNames = map[int]string{
+	TelemetryCommandStop:    "stop",
+	TelemetryCommandStart:   "start",
+	TelemetryCommandRestart: "restart",
+}
@@ -0,0 +1,157 @@
+package middleware
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/hfoxy/iracing-sdk"
+)
+
+// CachingSDK caches variables and session info between WaitForData calls, so repeated
+// lookups during one tick do not go back to the wrapped SDK. Cached values are also dropped
+// when the tick or session info version of the wrapped SDK changes.
+type CachingSDK struct {
+	irsdk.SDK
+
+	mux         sync.RWMutex
+	gen         uint64 // bumped on every invalidation so stale loads are not stored
+	vars        []irsdk.Variable
+	varsVersion int
+	byName      map[string]int
+	yaml        *string
+	yamlVersion int
+}
+
+// NewCachingSDK wraps sdk with a per-tick cache
+func NewCachingSDK(sdk irsdk.SDK) *CachingSDK {
+	return &CachingSDK{SDK: sdk}
+}
+
+// WithCaching returns a Middleware creating a CachingSDK
+func WithCaching() Middleware {
+	return func(sdk irsdk.SDK) irsdk.SDK {
+		return NewCachingSDK(sdk)
+	}
+}
+
+func (c *CachingSDK) Unwrap() irsdk.SDK {
+	return c.SDK
+}
+
+func (c *CachingSDK) invalidate() {
+	c.mux.Lock()
+	defer c.mux.Unlock()
+
+	c.gen++
+	c.vars = nil
+	c.byName = nil
+	c.yaml = nil
+}
+
+func (c *CachingSDK) WaitForData(timeout time.Duration) (bool, error) {
+	defer c.invalidate()
+	return c.SDK.WaitForData(timeout)
+}
+
+func (c *CachingSDK) RefreshSession() error {
+	defer c.invalidate()
+	return c.SDK.RefreshSession()
+}
+
+func (c *CachingSDK) load() ([]irsdk.Variable, map[string]int, error) {
+	version := c.SDK.GetLastVersion()
+
+	c.mux.RLock()
+	vars, byName, gen := c.vars, c.byName, c.gen
+	cached := vars != nil && c.varsVersion == version
+	c.mux.RUnlock()
+
+	if cached {
+		return vars, byName, nil
+	}
+
+	vars, err := c.SDK.GetVars()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	byName = make(map[string]int, len(vars))
+	for i, v := range vars {
+		byName[v.Name] = i
+	}
+
+	c.mux.Lock()
+	if c.gen == gen {
+		c.vars = vars
+		c.varsVersion = version
+		c.byName = byName
+	}
+	c.mux.Unlock()
+
+	return vars, byName, nil
+}
+
+func (c *CachingSDK) GetVars() ([]irsdk.Variable, error) {
+	vars, _, err := c.load()
+	return vars, err
+}
+
+func (c *CachingSDK) GetVar(name string) (irsdk.Variable, error) {
+	vars, byName, err := c.load()
+	if err != nil {
+		return irsdk.Variable{}, err
+	}
+
+	if i, ok := byName[name]; ok {
+		return vars[i], nil
+	}
+
+	return irsdk.Variable{}, fmt.Errorf("variable not found: %s", name)
+}
+
+func (c *CachingSDK) GetVarValue(name string) (interface{}, error) {
+	v, err := c.GetVar(name)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(v.Values) > 0 {
+		return v.Values[0], nil
+	}
+
+	return nil, irsdk.ErrNoValue
+}
+
+func (c *CachingSDK) GetVarValues(name string) (interface{}, error) {
+	v, err := c.GetVar(name)
+	if err != nil {
+		return nil, err
+	}
+
+	return v.Values, nil
+}
+
+func (c *CachingSDK) GetYaml() string {
+	version, _ := SessionInfoVersion(c.SDK)
+
+	c.mux.RLock()
+	yaml, gen := c.yaml, c.gen
+	cached := yaml != nil && c.yamlVersion == version
+	c.mux.RUnlock()
+
+	if cached {
+		return *yaml
+	}
+
+	s := c.SDK.GetYaml()
+
+	c.mux.Lock()
+	if c.gen == gen {
+		c.yaml = &s
+		c.yamlVersion = version
+	}
+	c.mux.Unlock()
+
+	return s
+}
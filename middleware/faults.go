@@ -0,0 +1,450 @@
+package middleware
+
+import (
+	"fmt"
+	"log/slog"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/hfoxy/iracing-sdk"
+)
+
+// Fault is a failure a FaultSDK can inject
+type Fault int
+
+const (
+	// FaultDisconnect makes the SDK report no session, as if the simulator was closed
+	FaultDisconnect Fault = iota
+	// FaultStale keeps WaitForData succeeding while the tick, variables and session info stop advancing,
+	// as when the simulator hangs while loading
+	FaultStale
+	// FaultDropTicks skips FaultSpec.Drop ticks on every WaitForData, as when a consumer falls behind
+	FaultDropTicks
+	// FaultMissingVar removes FaultSpec.Variable from the telemetry
+	FaultMissingVar
+	// FaultLayoutChange reorders the telemetry variables with new offsets and fails the first
+	// WaitForData after it starts, as when the simulator rewrites the header mid-session
+	FaultLayoutChange
+	// FaultBadYaml truncates the session info so it no longer parses and bumps its version
+	FaultBadYaml
+	// FaultSlowWait delays every WaitForData by FaultSpec.Delay before waiting for data
+	FaultSlowWait
+)
+
+var faultNames = map[Fault]string{
+	FaultDisconnect:   "disconnect",
+	FaultStale:        "stale",
+	FaultDropTicks:    "drop ticks",
+	FaultMissingVar:   "missing variable",
+	FaultLayoutChange: "layout change",
+	FaultBadYaml:      "bad yaml",
+	FaultSlowWait:     "slow wait",
+}
+
+func (f Fault) String() string {
+	if name, ok := faultNames[f]; ok {
+		return name
+	}
+
+	return fmt.Sprintf("Fault(%d)", int(f))
+}
+
+// FaultSpec schedules a fault
+type FaultSpec struct {
+	Fault Fault
+
+	Start    time.Duration // delay before the fault starts
+	Duration time.Duration // zero lasts until Clear is called
+
+	Drop     int           // FaultDropTicks: ticks skipped per WaitForData, defaults to 1
+	Variable string        // FaultMissingVar: name of the variable to remove
+	Delay    time.Duration // FaultSlowWait: added to every WaitForData
+}
+
+// FaultOptions configures a FaultSDK
+type FaultOptions struct {
+	Logger irsdk.Logger
+	Clock  irsdk.Clock
+
+	// Faults are scheduled relative to the creation of the FaultSDK
+	Faults []FaultSpec
+}
+
+type scheduledFault struct {
+	FaultSpec
+	start  time.Time
+	end    time.Time // zero for faults that last until cleared
+	active bool      // last state logged
+}
+
+func (s *scheduledFault) activeAt(now time.Time) bool {
+	return !now.Before(s.start) && (s.end.IsZero() || now.Before(s.end))
+}
+
+type staleData struct {
+	vars     []irsdk.Variable
+	version  int
+	sVersion int
+	yaml     string
+}
+
+// FaultInjectingSDK injects failures into the wrapped SDK, to test how consumers cope with disconnects,
+// stale or missing data, layout changes, broken session info and slow reads
+type FaultInjectingSDK struct {
+	irsdk.SDK
+	logger irsdk.Logger
+	clock  irsdk.Clock
+
+	mux      sync.RWMutex
+	faults   []*scheduledFault
+	stale    *staleData
+	relayout bool // a layout change started and WaitForData has not failed for it yet
+}
+
+// NewFaultInjectingSDK wraps sdk, scheduling opts.Faults from now
+func NewFaultInjectingSDK(sdk irsdk.SDK, opts FaultOptions) *FaultInjectingSDK {
+	if opts.Logger == nil {
+		opts.Logger = slog.Default()
+	}
+
+	if opts.Clock == nil {
+		opts.Clock = irsdk.SystemClock
+	}
+
+	f := &FaultInjectingSDK{
+		SDK:    sdk,
+		logger: opts.Logger,
+		clock:  opts.Clock,
+	}
+
+	for _, spec := range opts.Faults {
+		f.Inject(spec)
+	}
+
+	return f
+}
+
+// WithFaults returns a Middleware creating a FaultInjectingSDK
+func WithFaults(opts FaultOptions) Middleware {
+	return func(sdk irsdk.SDK) irsdk.SDK {
+		return NewFaultInjectingSDK(sdk, opts)
+	}
+}
+
+func (f *FaultInjectingSDK) Unwrap() irsdk.SDK {
+	return f.SDK
+}
+
+// Inject schedules a fault, spec.Start is relative to now
+func (f *FaultInjectingSDK) Inject(spec FaultSpec) {
+	if spec.Fault == FaultDropTicks && spec.Drop <= 0 {
+		spec.Drop = 1
+	}
+
+	s := &scheduledFault{FaultSpec: spec, start: f.clock.Now().Add(spec.Start)}
+	if spec.Duration > 0 {
+		s.end = s.start.Add(spec.Duration)
+	}
+
+	f.mux.Lock()
+	defer f.mux.Unlock()
+	f.faults = append(f.faults, s)
+}
+
+// Clear removes every scheduled and active fault
+func (f *FaultInjectingSDK) Clear() {
+	f.mux.Lock()
+	defer f.mux.Unlock()
+
+	for _, s := range f.faults {
+		if s.active {
+			f.logger.Info("fault cleared", "fault", s.Fault)
+		}
+	}
+
+	f.faults = nil
+	f.stale = nil
+	f.relayout = false
+}
+
+// Active returns the faults currently injected
+func (f *FaultInjectingSDK) Active() []Fault {
+	f.mux.RLock()
+	defer f.mux.RUnlock()
+
+	now := f.clock.Now()
+	faults := make([]Fault, 0)
+	for _, s := range f.faults {
+		if s.activeAt(now) && !slices.Contains(faults, s.Fault) {
+			faults = append(faults, s.Fault)
+		}
+	}
+
+	return faults
+}
+
+// active returns the first active fault of kind, it must be called with f.mux held
+func (f *FaultInjectingSDK) active(kind Fault) *scheduledFault {
+	now := f.clock.Now()
+	for _, s := range f.faults {
+		if s.Fault == kind && s.activeAt(now) {
+			return s
+		}
+	}
+
+	return nil
+}
+
+func (f *FaultInjectingSDK) is(kind Fault) bool {
+	f.mux.RLock()
+	defer f.mux.RUnlock()
+	return f.active(kind) != nil
+}
+
+// update logs fault transitions, drops expired faults and takes the stale snapshot
+func (f *FaultInjectingSDK) update() {
+	f.mux.Lock()
+	defer f.mux.Unlock()
+
+	now := f.clock.Now()
+	faults := f.faults[:0]
+	for _, s := range f.faults {
+		active := s.activeAt(now)
+		if active && !s.active {
+			f.logger.Info("injecting fault", "fault", s.Fault, "duration", s.Duration)
+			if s.Fault == FaultLayoutChange {
+				f.relayout = true
+			}
+		} else if !active && s.active {
+			f.logger.Info("fault cleared", "fault", s.Fault)
+		}
+
+		s.active = active
+		if active || now.Before(s.start) {
+			faults = append(faults, s)
+		}
+	}
+
+	f.faults = faults
+
+	if f.active(FaultStale) == nil {
+		f.stale = nil
+	} else if f.stale == nil {
+		vars, _ := f.SDK.GetVars()
+		sVersion, _ := SessionInfoVersion(f.SDK)
+		f.stale = &staleData{
+			vars:     slices.Clone(vars),
+			version:  f.SDK.GetLastVersion(),
+			sVersion: sVersion,
+			yaml:     f.SDK.GetYaml(),
+		}
+	}
+}
+
+// wait blocks on the clock for d, or until the next fault starts or ends
+func (f *FaultInjectingSDK) wait(d time.Duration) {
+	f.mux.RLock()
+	now := f.clock.Now()
+	for _, s := range f.faults {
+		for _, t := range []time.Time{s.start, s.end} {
+			if t.After(now) && t.Sub(now) < d {
+				d = t.Sub(now)
+			}
+		}
+	}
+	f.mux.RUnlock()
+
+	if d > 0 {
+		<-f.clock.After(d)
+	}
+}
+
+func (f *FaultInjectingSDK) WaitForData(timeout time.Duration) (bool, error) {
+	f.update()
+
+	f.mux.RLock()
+	slow := f.active(FaultSlowWait)
+	f.mux.RUnlock()
+	if slow != nil {
+		<-f.clock.After(slow.Delay)
+	}
+
+	if f.is(FaultDisconnect) {
+		f.wait(timeout)
+		return false, nil
+	}
+
+	f.mux.Lock()
+	relayout := f.relayout
+	f.relayout = false
+	drop := 0
+	if s := f.active(FaultDropTicks); s != nil {
+		drop = s.Drop
+	}
+	f.mux.Unlock()
+
+	if relayout {
+		return false, nil
+	}
+
+	for i := 0; i < drop; i++ {
+		if _, err := f.SDK.WaitForData(timeout); err != nil {
+			return false, err
+		}
+	}
+
+	return f.SDK.WaitForData(timeout)
+}
+
+// snapshot returns the stale data while FaultStale is active
+func (f *FaultInjectingSDK) snapshot() *staleData {
+	f.mux.RLock()
+	defer f.mux.RUnlock()
+
+	if f.active(FaultStale) == nil {
+		return nil
+	}
+
+	return f.stale
+}
+
+func (f *FaultInjectingSDK) GetVars() ([]irsdk.Variable, error) {
+	if f.is(FaultDisconnect) {
+		return make([]irsdk.Variable, 0), fmt.Errorf("session is not active")
+	}
+
+	var vars []irsdk.Variable
+	if stale := f.snapshot(); stale != nil {
+		vars = stale.vars
+	} else {
+		var err error
+		if vars, err = f.SDK.GetVars(); err != nil {
+			return vars, err
+		}
+	}
+
+	f.mux.RLock()
+	missing := f.active(FaultMissingVar)
+	relayout := f.active(FaultLayoutChange) != nil
+	f.mux.RUnlock()
+
+	if missing != nil {
+		vars = slices.DeleteFunc(slices.Clone(vars), func(v irsdk.Variable) bool {
+			return v.Name == missing.Variable
+		})
+	}
+
+	if relayout {
+		vars = relayoutVars(vars)
+	}
+
+	return vars, nil
+}
+
+// relayoutVars returns the variables in reverse order with offsets for the new order
+func relayoutVars(vars []irsdk.Variable) []irsdk.Variable {
+	out := make([]irsdk.Variable, len(vars))
+	offset := 0
+	for i := range vars {
+		v := vars[len(vars)-1-i]
+		v.Offset = offset
+		offset += v.VarType.Size() * v.Count
+		out[i] = v
+	}
+
+	return out
+}
+
+func (f *FaultInjectingSDK) GetVar(name string) (irsdk.Variable, error) {
+	vars, err := f.GetVars()
+	if err != nil {
+		return irsdk.Variable{}, err
+	}
+
+	for _, v := range vars {
+		if v.Name == name {
+			return v, nil
+		}
+	}
+
+	return irsdk.Variable{}, fmt.Errorf("telemetry variable %q not found", name)
+}
+
+func (f *FaultInjectingSDK) GetVarValue(name string) (interface{}, error) {
+	v, err := f.GetVar(name)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(v.Values) > 0 {
+		return v.Values[0], nil
+	}
+
+	return nil, irsdk.ErrNoValue
+}
+
+func (f *FaultInjectingSDK) GetVarValues(name string) (interface{}, error) {
+	v, err := f.GetVar(name)
+	if err != nil {
+		return nil, err
+	}
+
+	return v.Values, nil
+}
+
+func (f *FaultInjectingSDK) GetLastVersion() int {
+	if f.is(FaultDisconnect) {
+		return -1
+	}
+
+	if stale := f.snapshot(); stale != nil {
+		return stale.version
+	}
+
+	return f.SDK.GetLastVersion()
+}
+
+// GetSessionInfoVersion returns -1 when the wrapped SDK does not implement irsdk.SessionInfoVersioner
+func (f *FaultInjectingSDK) GetSessionInfoVersion() int {
+	version, ok := SessionInfoVersion(f.SDK)
+	if !ok || f.is(FaultDisconnect) {
+		return -1
+	}
+
+	if stale := f.snapshot(); stale != nil {
+		version = stale.sVersion
+	}
+
+	if f.is(FaultBadYaml) {
+		version++
+	}
+
+	return version
+}
+
+func (f *FaultInjectingSDK) IsConnected() bool {
+	if f.is(FaultDisconnect) {
+		return false
+	}
+
+	return f.SDK.IsConnected()
+}
+
+func (f *FaultInjectingSDK) GetYaml() string {
+	if f.is(FaultDisconnect) {
+		return ""
+	}
+
+	yaml := f.SDK.GetYaml()
+	if stale := f.snapshot(); stale != nil {
+		yaml = stale.yaml
+	}
+
+	if f.is(FaultBadYaml) {
+		// cut the document short and leave an unterminated flow sequence behind
+		yaml = yaml[:len(yaml)/2] + "\n\t: [broken\n"
+	}
+
+	return yaml
+}
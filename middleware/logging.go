@@ -0,0 +1,122 @@
+package middleware
+
+import (
+	"time"
+
+	"github.com/hfoxy/iracing-sdk"
+)
+
+// LoggingSDK logs calls to the wrapped SDK. WaitForData and BroadcastMsg are logged at debug
+// level, errors at error level and connection changes at info level.
+type LoggingSDK struct {
+	irsdk.SDK
+	logger irsdk.Logger
+
+	connected bool
+}
+
+// NewLoggingSDK wraps sdk, writing to logger
+func NewLoggingSDK(sdk irsdk.SDK, logger irsdk.Logger) *LoggingSDK {
+	return &LoggingSDK{SDK: sdk, logger: logger}
+}
+
+// WithLogging returns a Middleware creating a LoggingSDK
+func WithLogging(logger irsdk.Logger) Middleware {
+	return func(sdk irsdk.SDK) irsdk.SDK {
+		return NewLoggingSDK(sdk, logger)
+	}
+}
+
+func (l *LoggingSDK) Unwrap() irsdk.SDK {
+	return l.SDK
+}
+
+func (l *LoggingSDK) WaitForData(timeout time.Duration) (bool, error) {
+	start := time.Now()
+	ok, err := l.SDK.WaitForData(timeout)
+	if err != nil {
+		l.logger.Error("wait for data failed", "error", err, "duration", time.Since(start))
+		return ok, err
+	}
+
+	l.logger.Debug("wait for data", "ok", ok, "duration", time.Since(start))
+
+	connected := l.SDK.IsConnected()
+	if connected != l.connected {
+		l.connected = connected
+		if connected {
+			l.logger.Info("sdk connected")
+		} else {
+			l.logger.Info("sdk disconnected")
+		}
+	}
+
+	return ok, nil
+}
+
+func (l *LoggingSDK) GetVars() ([]irsdk.Variable, error) {
+	vars, err := l.SDK.GetVars()
+	if err != nil {
+		l.logger.Error("failed to get variables", "error", err)
+	}
+
+	return vars, err
+}
+
+func (l *LoggingSDK) GetVar(name string) (irsdk.Variable, error) {
+	v, err := l.SDK.GetVar(name)
+	if err != nil {
+		l.logger.Debug("failed to get variable", "name", name, "error", err)
+	}
+
+	return v, err
+}
+
+func (l *LoggingSDK) GetVarValue(name string) (interface{}, error) {
+	v, err := l.SDK.GetVarValue(name)
+	if err != nil {
+		l.logger.Debug("failed to get variable value", "name", name, "error", err)
+	}
+
+	return v, err
+}
+
+func (l *LoggingSDK) GetVarValues(name string) (interface{}, error) {
+	v, err := l.SDK.GetVarValues(name)
+	if err != nil {
+		l.logger.Debug("failed to get variable values", "name", name, "error", err)
+	}
+
+	return v, err
+}
+
+func (l *LoggingSDK) RefreshSession() error {
+	err := l.SDK.RefreshSession()
+	if err != nil {
+		l.logger.Error("failed to refresh session", "error", err)
+	}
+
+	return err
+}
+
+func (l *LoggingSDK) BroadcastMsg(msg irsdk.Msg) error {
+	err := l.SDK.BroadcastMsg(msg)
+	if err != nil {
+		l.logger.Error("failed to broadcast message", "cmd", msg.Cmd, "p1", msg.P1, "p2", msg.P2, "p3", msg.P3, "error", err)
+	} else {
+		l.logger.Debug("broadcast message", "cmd", msg.Cmd, "p1", msg.P1, "p2", msg.P2, "p3", msg.P3)
+	}
+
+	return err
+}
+
+func (l *LoggingSDK) Close() error {
+	err := l.SDK.Close()
+	if err != nil {
+		l.logger.Error("failed to close sdk", "error", err)
+	} else {
+		l.logger.Info("sdk closed")
+	}
+
+	return err
+}
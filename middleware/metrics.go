@@ -0,0 +1,190 @@
+package middleware
+
+import (
+	"sync"
+	"time"
+
+	"github.com/hfoxy/iracing-sdk"
+)
+
+// Metrics is a snapshot of the counters collected by a MetricsSDK
+type Metrics struct {
+	Calls  map[string]int64 // calls per SDK method
+	Errors map[string]int64 // errors per SDK method
+
+	WaitForDataOk      int64 // WaitForData calls that returned new data
+	WaitForDataTotal   time.Duration
+	WaitForDataMin     time.Duration
+	WaitForDataMax     time.Duration
+	WaitForDataLastErr error
+}
+
+// WaitForDataAverage returns the mean WaitForData latency
+func (m Metrics) WaitForDataAverage() time.Duration {
+	n := m.Calls["WaitForData"]
+	if n == 0 {
+		return 0
+	}
+
+	return m.WaitForDataTotal / time.Duration(n)
+}
+
+// MetricsSDK counts calls and errors per method and measures WaitForData latency
+type MetricsSDK struct {
+	irsdk.SDK
+
+	mux     sync.Mutex
+	metrics Metrics
+}
+
+// NewMetricsSDK wraps sdk with call counters
+func NewMetricsSDK(sdk irsdk.SDK) *MetricsSDK {
+	return &MetricsSDK{
+		SDK: sdk,
+		metrics: Metrics{
+			Calls:  make(map[string]int64),
+			Errors: make(map[string]int64),
+		},
+	}
+}
+
+// WithMetrics returns a Middleware creating a MetricsSDK, stored in *dst so the caller can read it
+func WithMetrics(dst **MetricsSDK) Middleware {
+	return func(sdk irsdk.SDK) irsdk.SDK {
+		m := NewMetricsSDK(sdk)
+		if dst != nil {
+			*dst = m
+		}
+
+		return m
+	}
+}
+
+func (m *MetricsSDK) Unwrap() irsdk.SDK {
+	return m.SDK
+}
+
+// Metrics returns a copy of the current counters
+func (m *MetricsSDK) Metrics() Metrics {
+	m.mux.Lock()
+	defer m.mux.Unlock()
+
+	snapshot := m.metrics
+	snapshot.Calls = make(map[string]int64, len(m.metrics.Calls))
+	for k, v := range m.metrics.Calls {
+		snapshot.Calls[k] = v
+	}
+
+	snapshot.Errors = make(map[string]int64, len(m.metrics.Errors))
+	for k, v := range m.metrics.Errors {
+		snapshot.Errors[k] = v
+	}
+
+	return snapshot
+}
+
+// Reset clears every counter
+func (m *MetricsSDK) Reset() {
+	m.mux.Lock()
+	defer m.mux.Unlock()
+
+	m.metrics = Metrics{
+		Calls:  make(map[string]int64),
+		Errors: make(map[string]int64),
+	}
+}
+
+func (m *MetricsSDK) count(method string, err error) {
+	m.mux.Lock()
+	defer m.mux.Unlock()
+
+	m.metrics.Calls[method]++
+	if err != nil {
+		m.metrics.Errors[method]++
+	}
+}
+
+func (m *MetricsSDK) WaitForData(timeout time.Duration) (bool, error) {
+	start := time.Now()
+	ok, err := m.SDK.WaitForData(timeout)
+	d := time.Since(start)
+
+	m.mux.Lock()
+	defer m.mux.Unlock()
+
+	m.metrics.Calls["WaitForData"]++
+	m.metrics.WaitForDataTotal += d
+	if m.metrics.WaitForDataMin == 0 || d < m.metrics.WaitForDataMin {
+		m.metrics.WaitForDataMin = d
+	}
+
+	if d > m.metrics.WaitForDataMax {
+		m.metrics.WaitForDataMax = d
+	}
+
+	if err != nil {
+		m.metrics.Errors["WaitForData"]++
+		m.metrics.WaitForDataLastErr = err
+	} else if ok {
+		m.metrics.WaitForDataOk++
+	}
+
+	return ok, err
+}
+
+func (m *MetricsSDK) GetVars() ([]irsdk.Variable, error) {
+	vars, err := m.SDK.GetVars()
+	m.count("GetVars", err)
+	return vars, err
+}
+
+func (m *MetricsSDK) GetVar(name string) (irsdk.Variable, error) {
+	v, err := m.SDK.GetVar(name)
+	m.count("GetVar", err)
+	return v, err
+}
+
+func (m *MetricsSDK) GetVarValue(name string) (interface{}, error) {
+	v, err := m.SDK.GetVarValue(name)
+	m.count("GetVarValue", err)
+	return v, err
+}
+
+func (m *MetricsSDK) GetVarValues(name string) (interface{}, error) {
+	v, err := m.SDK.GetVarValues(name)
+	m.count("GetVarValues", err)
+	return v, err
+}
+
+func (m *MetricsSDK) RefreshSession() error {
+	err := m.SDK.RefreshSession()
+	m.count("RefreshSession", err)
+	return err
+}
+
+func (m *MetricsSDK) GetLastVersion() int {
+	m.count("GetLastVersion", nil)
+	return m.SDK.GetLastVersion()
+}
+
+func (m *MetricsSDK) IsConnected() bool {
+	m.count("IsConnected", nil)
+	return m.SDK.IsConnected()
+}
+
+func (m *MetricsSDK) GetYaml() string {
+	m.count("GetYaml", nil)
+	return m.SDK.GetYaml()
+}
+
+func (m *MetricsSDK) BroadcastMsg(msg irsdk.Msg) error {
+	err := m.SDK.BroadcastMsg(msg)
+	m.count("BroadcastMsg", err)
+	return err
+}
+
+func (m *MetricsSDK) Close() error {
+	err := m.SDK.Close()
+	m.count("Close", err)
+	return err
+}
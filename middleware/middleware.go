@@ -0,0 +1,42 @@
+// Package middleware provides decorators that wrap an irsdk.SDK and still satisfy the interface,
+// so behaviour such as caching, logging or recording can be stacked around any implementation.
+package middleware
+
+import (
+	"github.com/hfoxy/iracing-sdk"
+)
+
+// Middleware wraps an SDK with additional behaviour
+type Middleware func(sdk irsdk.SDK) irsdk.SDK
+
+// Chain wraps sdk with every middleware, the first middleware becomes the outermost layer
+func Chain(sdk irsdk.SDK, middlewares ...Middleware) irsdk.SDK {
+	for i := len(middlewares) - 1; i >= 0; i-- {
+		sdk = middlewares[i](sdk)
+	}
+
+	return sdk
+}
+
+// Unwrap returns the SDK wrapped by sdk, or nil if sdk is not a wrapper
+func Unwrap(sdk irsdk.SDK) irsdk.SDK {
+	if w, ok := sdk.(interface{ Unwrap() irsdk.SDK }); ok {
+		return w.Unwrap()
+	}
+
+	return nil
+}
+
+// SessionInfoVersion returns the session info version of the first SDK implementing
+// irsdk.SessionInfoVersioner, looking through the wrappers around it. ok is false when none does.
+func SessionInfoVersion(sdk irsdk.SDK) (version int, ok bool) {
+	for sdk != nil {
+		if v, ok := sdk.(irsdk.SessionInfoVersioner); ok {
+			return v.GetSessionInfoVersion(), true
+		}
+
+		sdk = Unwrap(sdk)
+	}
+
+	return -1, false
+}
@@ -0,0 +1,440 @@
+package middleware
+
+import (
+	"errors"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/go-yaml/yaml"
+	"github.com/hfoxy/iracing-sdk"
+	"github.com/hfoxy/iracing-sdk/replay"
+)
+
+type stubSDK struct {
+	vars           []irsdk.Variable
+	yaml           string
+	sessionVersion int
+	getVars        int
+	waits          int
+	timeout        bool  // WaitForData times out
+	err            error // returned by RefreshSession
+	broadcast      []irsdk.Msg
+}
+
+func (s *stubSDK) WaitForData(timeout time.Duration) (bool, error) {
+	s.waits++
+	return !s.timeout, nil
+}
+func (s *stubSDK) GetVars() ([]irsdk.Variable, error) {
+	s.getVars++
+	return s.vars, nil
+}
+func (s *stubSDK) GetVar(name string) (irsdk.Variable, error) {
+	for _, v := range s.vars {
+		if v.Name == name {
+			return v, nil
+		}
+	}
+
+	return irsdk.Variable{}, errors.New("not found")
+}
+func (s *stubSDK) GetVarValue(name string) (interface{}, error) {
+	v, err := s.GetVar(name)
+	if err != nil {
+		return nil, err
+	}
+
+	return v.Values[0], nil
+}
+func (s *stubSDK) GetVarValues(name string) (interface{}, error) {
+	v, err := s.GetVar(name)
+	return v.Values, err
+}
+func (s *stubSDK) RefreshSession() error      { return s.err }
+func (s *stubSDK) GetLastVersion() int        { return s.waits }
+func (s *stubSDK) GetSessionInfoVersion() int { return s.sessionVersion }
+func (s *stubSDK) IsConnected() bool          { return true }
+func (s *stubSDK) GetYaml() string            { return s.yaml }
+func (s *stubSDK) BroadcastMsg(msg irsdk.Msg) error {
+	s.broadcast = append(s.broadcast, msg)
+	return nil
+}
+func (s *stubSDK) Close() error { return nil }
+
+func newStub() *stubSDK {
+	return &stubSDK{
+		vars: []irsdk.Variable{
+			{VarType: irsdk.VarTypeFloat, Count: 1, Name: "Speed", Unit: "m/s", Values: []any{float32(42.5)}},
+			{VarType: irsdk.VarTypeInt, Count: 1, Name: "Gear", Values: []any{3}},
+		},
+		yaml:           "WeekendInfo:\n TrackName: spa\n",
+		sessionVersion: 1,
+	}
+}
+
+type logEntry struct {
+	level string
+	msg   string
+}
+
+type testLogger struct {
+	entries []logEntry
+}
+
+func (l *testLogger) log(level, msg string) {
+	l.entries = append(l.entries, logEntry{level: level, msg: msg})
+}
+
+func (l *testLogger) Debug(msg string, args ...interface{}) { l.log("debug", msg) }
+func (l *testLogger) Info(msg string, args ...interface{})  { l.log("info", msg) }
+func (l *testLogger) Warn(msg string, args ...interface{})  { l.log("warn", msg) }
+func (l *testLogger) Error(msg string, args ...interface{}) { l.log("error", msg) }
+
+func TestChain(t *testing.T) {
+	stub := newStub()
+
+	var metrics *MetricsSDK
+	sdk := Chain(stub, WithReadOnly(), WithMetrics(&metrics), WithCaching())
+
+	if _, ok := sdk.(*ReadOnlySDK); !ok {
+		t.Fatalf("expected read-only sdk to be outermost, got %T", sdk)
+	}
+
+	if Unwrap(Unwrap(Unwrap(sdk))) != stub {
+		t.Fatal("expected three layers around the stub")
+	}
+
+	if v, ok := SessionInfoVersion(sdk); !ok || v != 1 {
+		t.Errorf("expected session info version 1 from the stub, got %d", v)
+	}
+
+	if _, ok := SessionInfoVersion(NewMetricsSDK(struct{ irsdk.SDK }{stub})); ok {
+		t.Error("expected no session info version when the wrapped sdk has none")
+	}
+
+	if _, err := sdk.WaitForData(time.Millisecond); err != nil {
+		t.Fatal(err)
+	}
+
+	for i := 0; i < 3; i++ {
+		v, err := sdk.GetVarValue("Gear")
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if v != 3 {
+			t.Errorf("expected gear 3, got %v", v)
+		}
+	}
+
+	if stub.getVars != 1 {
+		t.Errorf("expected cached variables to be loaded once, got %d", stub.getVars)
+	}
+
+	if err := sdk.BroadcastMsg(irsdk.Msg{Cmd: irsdk.BroadcastPitCommand}); !errors.Is(err, ErrReadOnly) {
+		t.Errorf("expected read-only error, got %v", err)
+	}
+
+	if len(stub.broadcast) != 0 {
+		t.Error("broadcast reached the wrapped sdk")
+	}
+
+	m := metrics.Metrics()
+	if m.Calls["WaitForData"] != 1 || m.Calls["GetVarValue"] != 3 || m.WaitForDataOk != 1 {
+		t.Errorf("unexpected metrics: %+v", m)
+	}
+}
+
+func TestCaching(t *testing.T) {
+	stub := newStub()
+	sdk := NewCachingSDK(stub)
+
+	gear := func() any {
+		t.Helper()
+		v, err := sdk.GetVarValue("Gear")
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		return v
+	}
+
+	gear()
+	gear()
+	if stub.getVars != 1 {
+		t.Errorf("expected variables to be loaded once, got %d", stub.getVars)
+	}
+
+	// a tick read past the cache, e.g. by another wrapper, changes the last version
+	stub.vars[1].Values = []any{4}
+	if _, err := stub.WaitForData(0); err != nil {
+		t.Fatal(err)
+	}
+
+	if v := gear(); v != 4 || stub.getVars != 2 {
+		t.Errorf("expected gear 4 after a new tick, got %v with %d loads", v, stub.getVars)
+	}
+
+	yaml := sdk.GetYaml()
+	stub.yaml = "WeekendInfo:\n TrackName: monza\n"
+	if sdk.GetYaml() != yaml {
+		t.Errorf("expected the cached session info while its version is unchanged")
+	}
+
+	stub.sessionVersion++
+	if sdk.GetYaml() != stub.yaml {
+		t.Errorf("expected the new session info after a version change, got %q", sdk.GetYaml())
+	}
+}
+
+func TestLogging(t *testing.T) {
+	stub := newStub()
+	logger := &testLogger{}
+	sdk := NewLoggingSDK(stub, logger)
+
+	if _, err := sdk.WaitForData(time.Millisecond); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := sdk.GetVar("Missing"); err == nil {
+		t.Error("expected a missing variable")
+	}
+
+	stub.err = errors.New("refresh failed")
+	if err := sdk.RefreshSession(); err != stub.err {
+		t.Errorf("expected the wrapped error, got %v", err)
+	}
+
+	if err := sdk.BroadcastMsg(irsdk.Msg{Cmd: irsdk.BroadcastPitCommand}); err != nil {
+		t.Fatal(err)
+	}
+
+	want := []logEntry{
+		{"debug", "wait for data"},
+		{"info", "sdk connected"},
+		{"debug", "failed to get variable"},
+		{"error", "failed to refresh session"},
+		{"debug", "broadcast message"},
+	}
+
+	if !reflect.DeepEqual(logger.entries, want) {
+		t.Errorf("expected %v, got %v", want, logger.entries)
+	}
+
+	// the connection state is only logged when it changes
+	logger.entries = nil
+	if _, err := sdk.WaitForData(time.Millisecond); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(logger.entries) != 1 {
+		t.Errorf("expected a single debug entry, got %v", logger.entries)
+	}
+}
+
+func TestMetrics(t *testing.T) {
+	stub := newStub()
+	sdk := NewMetricsSDK(stub)
+
+	for i := 0; i < 2; i++ {
+		if _, err := sdk.WaitForData(time.Millisecond); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	stub.timeout = true
+	if _, err := sdk.WaitForData(time.Millisecond); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := sdk.GetVar("Missing"); err == nil {
+		t.Error("expected a missing variable")
+	}
+
+	stub.err = errors.New("refresh failed")
+	_ = sdk.RefreshSession()
+	sdk.GetYaml()
+
+	m := sdk.Metrics()
+	if m.Calls["WaitForData"] != 3 || m.WaitForDataOk != 2 || m.WaitForDataMin > m.WaitForDataMax {
+		t.Errorf("unexpected wait for data metrics: %+v", m)
+	}
+
+	if m.Calls["GetVar"] != 1 || m.Errors["GetVar"] != 1 || m.Errors["RefreshSession"] != 1 || m.Calls["GetYaml"] != 1 {
+		t.Errorf("unexpected call metrics: %+v", m)
+	}
+
+	if m.WaitForDataAverage() != m.WaitForDataTotal/3 {
+		t.Errorf("expected an average of %s, got %s", m.WaitForDataTotal/3, m.WaitForDataAverage())
+	}
+
+	sdk.Reset()
+	if m = sdk.Metrics(); len(m.Calls) != 0 || m.WaitForDataAverage() != 0 {
+		t.Errorf("expected no metrics after a reset, got %+v", m)
+	}
+}
+
+func TestReadOnly(t *testing.T) {
+	stub := newStub()
+	sdk := NewReadOnlySDK(stub)
+
+	if err := sdk.BroadcastMsg(irsdk.Msg{Cmd: irsdk.BroadcastReplaySetPlaySpeed, P1: 1}); !errors.Is(err, ErrReadOnly) {
+		t.Errorf("expected read-only error, got %v", err)
+	}
+
+	if len(stub.broadcast) != 0 {
+		t.Error("broadcast reached the wrapped sdk")
+	}
+
+	// everything else goes to the wrapped sdk
+	if v, err := sdk.GetVarValue("Gear"); err != nil || v != 3 {
+		t.Errorf("expected gear 3, got %v (%v)", v, err)
+	}
+}
+
+func TestRecording(t *testing.T) {
+	fileName := filepath.Join(t.TempDir(), "recording.zsitrpy")
+	w, err := replay.NewWriter(fileName)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	stub := newStub()
+	sdk := NewRecordingSDK(stub, w)
+	for i := 0; i < 2; i++ {
+		if _, err = sdk.WaitForData(time.Millisecond); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// timed out polls are not recorded while the connection state stays the same
+	stub.timeout = true
+	for i := 0; i < 3; i++ {
+		if _, err = sdk.WaitForData(time.Millisecond); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err = w.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	r, err := replay.NewReader(fileName)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer r.Close()
+
+	for i := 0; i < 2; i++ {
+		entry, err := r.ReadEntry()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if !entry.Connected || entry.NotOk || entry.YamlData != newStub().yaml {
+			t.Errorf("unexpected entry %+v", entry)
+		}
+
+		vars, err := irsdk.DecodeVariables(entry.VariableData)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if len(vars) != 2 || vars[0].Values[0] != float32(42.5) {
+			t.Errorf("unexpected variables %+v", vars)
+		}
+	}
+
+	if _, err = r.ReadEntry(); !errors.Is(err, replay.ErrEndOfFile) {
+		t.Errorf("expected end of file, got %v", err)
+	}
+}
+
+func TestFaults(t *testing.T) {
+	clock := irsdk.NewManualClock(time.Unix(0, 0))
+	stub := newStub()
+	sdk := NewFaultInjectingSDK(stub, FaultOptions{
+		Clock: clock,
+		Faults: []FaultSpec{
+			{Fault: FaultDisconnect, Start: time.Second, Duration: 2 * time.Second},
+			{Fault: FaultStale, Start: 4 * time.Second, Duration: time.Second},
+			{Fault: FaultDropTicks, Start: 6 * time.Second, Duration: time.Second, Drop: 2},
+			{Fault: FaultMissingVar, Start: 8 * time.Second, Duration: time.Second, Variable: "Gear"},
+			{Fault: FaultBadYaml, Start: 10 * time.Second, Duration: time.Second},
+			{Fault: FaultLayoutChange, Start: 12 * time.Second},
+		},
+	})
+
+	wait := func() bool {
+		t.Helper()
+		ok, err := sdk.WaitForData(0)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		return ok
+	}
+
+	clock.Advance(time.Second)
+	if wait() || sdk.IsConnected() || sdk.GetLastVersion() != -1 {
+		t.Errorf("expected a disconnect")
+	}
+
+	clock.Advance(3 * time.Second)
+	wait()
+	version := sdk.GetLastVersion()
+	wait()
+	if !sdk.IsConnected() || sdk.GetLastVersion() != version {
+		t.Errorf("expected a connected sdk with a stale tick, got version %d after %d", sdk.GetLastVersion(), version)
+	}
+
+	clock.Advance(2 * time.Second)
+	before := stub.waits
+	wait()
+	if stub.waits-before != 3 {
+		t.Errorf("expected two dropped ticks, got %d waits", stub.waits-before)
+	}
+
+	clock.Advance(2 * time.Second)
+	wait()
+	if _, err := sdk.GetVarValue("Gear"); err == nil {
+		t.Errorf("expected Gear to be missing")
+	}
+
+	clock.Advance(2 * time.Second)
+	wait()
+	var v any
+	if err := yaml.Unmarshal([]byte(sdk.GetYaml()), &v); err == nil {
+		t.Errorf("expected the session info to fail to parse")
+	}
+
+	clock.Advance(2 * time.Second)
+	if wait() {
+		t.Errorf("expected the first wait after a layout change to fail")
+	}
+
+	if !wait() {
+		t.Errorf("expected data after the layout change")
+	}
+
+	vars, err := sdk.GetVars()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if vars[0].Name != "Gear" || vars[0].Offset != 0 || vars[1].Offset != 4 {
+		t.Errorf("unexpected layout %+v", vars)
+	}
+
+	if _, err = sdk.GetVarValue("Gear"); err != nil {
+		t.Errorf("expected Gear to be back, got %v", err)
+	}
+
+	sdk.Clear()
+	if len(sdk.Active()) != 0 {
+		t.Errorf("expected no active faults, got %v", sdk.Active())
+	}
+}
@@ -0,0 +1,34 @@
+package middleware
+
+import (
+	"fmt"
+
+	"github.com/hfoxy/iracing-sdk"
+)
+
+var ErrReadOnly = fmt.Errorf("sdk is read-only")
+
+// ReadOnlySDK rejects every BroadcastMsg so the wrapped SDK can never control the simulator
+type ReadOnlySDK struct {
+	irsdk.SDK
+}
+
+// NewReadOnlySDK wraps sdk, blocking BroadcastMsg
+func NewReadOnlySDK(sdk irsdk.SDK) *ReadOnlySDK {
+	return &ReadOnlySDK{SDK: sdk}
+}
+
+// WithReadOnly returns a Middleware creating a ReadOnlySDK
+func WithReadOnly() Middleware {
+	return func(sdk irsdk.SDK) irsdk.SDK {
+		return NewReadOnlySDK(sdk)
+	}
+}
+
+func (r *ReadOnlySDK) Unwrap() irsdk.SDK {
+	return r.SDK
+}
+
+func (r *ReadOnlySDK) BroadcastMsg(msg irsdk.Msg) error {
+	return fmt.Errorf("%w: broadcast %d rejected", ErrReadOnly, msg.Cmd)
+}
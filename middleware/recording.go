@@ -0,0 +1,72 @@
+package middleware
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/hfoxy/iracing-sdk"
+	"github.com/hfoxy/iracing-sdk/replay"
+)
+
+// RecordingSDK tees the WaitForData results of the wrapped SDK into a replay.Writer. Timed out
+// polls are only recorded when the connection state changed, so an idle loop does not fill the replay.
+// The writer is not closed by Close, it is owned by the caller.
+type RecordingSDK struct {
+	irsdk.SDK
+	writer    replay.Writer
+	connected bool // connection state of the last entry
+}
+
+// NewRecordingSDK wraps sdk, writing an entry per WaitForData call returning data to w
+func NewRecordingSDK(sdk irsdk.SDK, w replay.Writer) *RecordingSDK {
+	return &RecordingSDK{SDK: sdk, writer: w}
+}
+
+// WithRecording returns a Middleware creating a RecordingSDK
+func WithRecording(w replay.Writer) Middleware {
+	return func(sdk irsdk.SDK) irsdk.SDK {
+		return NewRecordingSDK(sdk, w)
+	}
+}
+
+func (r *RecordingSDK) Unwrap() irsdk.SDK {
+	return r.SDK
+}
+
+func (r *RecordingSDK) WaitForData(timeout time.Duration) (bool, error) {
+	ok, err := r.SDK.WaitForData(timeout)
+	if err != nil {
+		return ok, err
+	}
+
+	connected := r.SDK.IsConnected()
+	if !ok && connected == r.connected {
+		return ok, nil
+	}
+
+	r.connected = connected
+	entry := &replay.Entry{
+		Timestamp: time.Now().UnixMilli(),
+		Connected: connected,
+		NotOk:     !ok,
+		YamlData:  r.SDK.GetYaml(),
+	}
+
+	if entry.Connected {
+		vars, err := r.SDK.GetVars()
+		if err != nil {
+			return ok, fmt.Errorf("failed to get variables for recording: %w", err)
+		}
+
+		entry.VariableData, err = irsdk.EncodeVariables(vars)
+		if err != nil {
+			return ok, err
+		}
+	}
+
+	if err = r.writer.WriteEntry(entry); err != nil {
+		return ok, fmt.Errorf("failed to record entry: %w", err)
+	}
+
+	return ok, nil
+}
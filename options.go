@@ -0,0 +1,47 @@
+package irsdk
+
+import (
+	"log/slog"
+	"time"
+)
+
+// Options configures the live SDK created by NewWithOptions, zero values fall back to the iRacing defaults
+type Options struct {
+	Logger Logger
+
+	// ConnectionTimeout is how long the SDK reports connected without receiving new data
+	ConnectionTimeout time.Duration
+
+	MapName          string // shared memory file name
+	MapSize          int32  // shared memory file size in bytes
+	EventName        string // data valid event name
+	BroadcastMsgName string // window message used by BroadcastMsg
+}
+
+func (o Options) withDefaults() Options {
+	if o.Logger == nil {
+		o.Logger = slog.Default()
+	}
+
+	if o.ConnectionTimeout <= 0 {
+		o.ConnectionTimeout = connTimeout
+	}
+
+	if o.MapName == "" {
+		o.MapName = fileMapName
+	}
+
+	if o.MapSize <= 0 {
+		o.MapSize = fileMapSize
+	}
+
+	if o.EventName == "" {
+		o.EventName = dataValidEventName
+	}
+
+	if o.BroadcastMsgName == "" {
+		o.BroadcastMsgName = broadcastMsgName
+	}
+
+	return o
+}
@@ -0,0 +1,386 @@
+package replay
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+
+	"github.com/hfoxy/iracing-sdk/buf"
+)
+
+// OverflowPolicy is what an AsyncWriter does with an entry when its queue is full
+type OverflowPolicy int
+
+const (
+	// OverflowBlock makes WriteEntry wait for room in the queue
+	OverflowBlock OverflowPolicy = iota
+	// OverflowDrop discards the entry
+	OverflowDrop
+	// OverflowSpill appends the entry, and every entry after it until they are written, to a temporary file
+	OverflowSpill
+)
+
+func (p OverflowPolicy) String() string {
+	switch p {
+	case OverflowBlock:
+		return "block"
+	case OverflowDrop:
+		return "drop"
+	case OverflowSpill:
+		return "spill"
+	default:
+		return fmt.Sprintf("OverflowPolicy(%d)", int(p))
+	}
+}
+
+// DefaultQueueSize is the number of entries an AsyncWriter queues by default, ten seconds at 60Hz
+const DefaultQueueSize = 600
+
+// AsyncOptions configures an AsyncWriter
+type AsyncOptions struct {
+	QueueSize int // entries held in memory, DefaultQueueSize when zero
+	Overflow  OverflowPolicy
+	SpillDir  string // directory of the spill file, os.TempDir when empty
+}
+
+// AsyncStats reports the state of an AsyncWriter
+type AsyncStats struct {
+	Depth    int // entries waiting to be written, in the queue and the spill file
+	MaxDepth int
+	Written  uint64
+	Dropped  uint64
+	Spilled  uint64 // entries that went through the spill file
+	Blocked  uint64 // calls to WriteEntry that waited for room in the queue
+}
+
+// AsyncWriter writes entries to a Writer on its own goroutine, so a slow disk does not stall the
+// telemetry loop. Entries are written in order; errors of the wrapped writer are returned by the
+// following WriteEntry calls and by Close. WriteEntry and Close must be called from a single goroutine,
+// Stats may be called from any.
+type AsyncWriter struct {
+	w       Writer
+	options AsyncOptions
+	queue   chan Entry
+	done    chan struct{}
+
+	mux     sync.Mutex // guards the fields below
+	stats   AsyncStats
+	err     error
+	closed  bool
+	spill   *spillFile
+	pending int // entries in the spill file not yet written
+}
+
+// NewAsyncWriter starts writing entries queued by WriteEntry to w
+func NewAsyncWriter(w Writer, opts AsyncOptions) *AsyncWriter {
+	if opts.QueueSize <= 0 {
+		opts.QueueSize = DefaultQueueSize
+	}
+
+	a := &AsyncWriter{
+		w:       w,
+		options: opts,
+		queue:   make(chan Entry, opts.QueueSize),
+		done:    make(chan struct{}),
+	}
+
+	go a.run()
+	return a
+}
+
+// WriteEntry queues a copy of entry, it returns the first error of the wrapped writer, if any
+func (a *AsyncWriter) WriteEntry(entry *Entry) error {
+	a.mux.Lock()
+	if a.closed {
+		a.mux.Unlock()
+		return fmt.Errorf("writer is closed")
+	}
+
+	if a.err != nil {
+		err := a.err
+		a.mux.Unlock()
+		return err
+	}
+
+	if a.pending > 0 {
+		// entries follow the ones already spilled to stay in order
+		err := a.spillEntry(entry)
+		a.mux.Unlock()
+		return err
+	}
+
+	a.mux.Unlock()
+
+	select {
+	case a.queue <- *entry:
+		a.queued()
+		return nil
+	default:
+	}
+
+	switch a.options.Overflow {
+	case OverflowDrop:
+		a.mux.Lock()
+		a.stats.Dropped++
+		a.mux.Unlock()
+		return nil
+	case OverflowSpill:
+		a.mux.Lock()
+		defer a.mux.Unlock()
+		return a.spillEntry(entry)
+	default:
+		a.mux.Lock()
+		a.stats.Blocked++
+		a.mux.Unlock()
+
+		a.queue <- *entry
+		a.queued()
+		return nil
+	}
+}
+
+func (a *AsyncWriter) queued() {
+	a.mux.Lock()
+	defer a.mux.Unlock()
+	a.stats.MaxDepth = max(a.stats.MaxDepth, len(a.queue)+a.pending)
+}
+
+// spillEntry must be called with a.mux held
+func (a *AsyncWriter) spillEntry(entry *Entry) error {
+	if a.spill == nil {
+		s, err := newSpillFile(a.options.SpillDir)
+		if err != nil {
+			return err
+		}
+
+		a.spill = s
+	}
+
+	if err := a.spill.write(entry); err != nil {
+		return fmt.Errorf("failed to spill entry: %w", err)
+	}
+
+	a.pending++
+	a.stats.Spilled++
+	a.stats.MaxDepth = max(a.stats.MaxDepth, len(a.queue)+a.pending)
+	return nil
+}
+
+// nextSpilled returns the next spilled entry, or nil when there is none
+func (a *AsyncWriter) nextSpilled() (*Entry, error) {
+	a.mux.Lock()
+	defer a.mux.Unlock()
+
+	if a.pending == 0 {
+		return nil, nil
+	}
+
+	entry, err := a.spill.read()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read spilled entry: %w", err)
+	}
+
+	a.pending--
+	if a.pending == 0 {
+		err = a.spill.reset()
+	}
+
+	return entry, err
+}
+
+func (a *AsyncWriter) run() {
+	defer close(a.done)
+
+	write := func(entry *Entry) {
+		err := a.w.WriteEntry(entry)
+
+		a.mux.Lock()
+		defer a.mux.Unlock()
+		if err != nil && a.err == nil {
+			a.err = err
+		}
+
+		a.stats.Written++
+	}
+
+	for {
+		select {
+		case entry, ok := <-a.queue:
+			if !ok {
+				a.drainSpill(write)
+				return
+			}
+
+			write(&entry)
+			continue
+		default:
+		}
+
+		// queued entries are older than spilled ones
+		entry, err := a.nextSpilled()
+		if err != nil {
+			a.fail(err)
+			continue
+		}
+
+		if entry != nil {
+			write(entry)
+			continue
+		}
+
+		queued, ok := <-a.queue
+		if !ok {
+			a.drainSpill(write)
+			return
+		}
+
+		write(&queued)
+	}
+}
+
+func (a *AsyncWriter) drainSpill(write func(entry *Entry)) {
+	for {
+		entry, err := a.nextSpilled()
+		if err != nil {
+			a.fail(err)
+			return
+		}
+
+		if entry == nil {
+			return
+		}
+
+		write(entry)
+	}
+}
+
+func (a *AsyncWriter) fail(err error) {
+	a.mux.Lock()
+	defer a.mux.Unlock()
+
+	if a.err == nil {
+		a.err = err
+	}
+
+	// spilled entries can no longer be read
+	a.stats.Dropped += uint64(a.pending)
+	a.pending = 0
+	if a.spill != nil {
+		if rerr := a.spill.reset(); rerr != nil {
+			a.err = errors.Join(a.err, fmt.Errorf("failed to reset spill file: %w", rerr))
+		}
+	}
+}
+
+// Stats returns the queue depth and entry counters
+func (a *AsyncWriter) Stats() AsyncStats {
+	a.mux.Lock()
+	defer a.mux.Unlock()
+
+	stats := a.stats
+	stats.Depth = len(a.queue) + a.pending
+	return stats
+}
+
+// Close writes every queued and spilled entry, then closes the wrapped writer
+func (a *AsyncWriter) Close() error {
+	a.mux.Lock()
+	if a.closed {
+		a.mux.Unlock()
+		return nil
+	}
+
+	a.closed = true
+	a.mux.Unlock()
+
+	close(a.queue)
+	<-a.done
+
+	a.mux.Lock()
+	err := a.err
+	if a.spill != nil {
+		if cerr := a.spill.close(); err == nil {
+			err = cerr
+		}
+	}
+
+	a.mux.Unlock()
+
+	if cerr := a.w.Close(); err == nil {
+		err = cerr
+	}
+
+	return err
+}
+
+// spillFile holds entries that did not fit in the queue, each one as a length followed by the entry
+type spillFile struct {
+	f           *os.File
+	writeOffset int64
+	readOffset  int64
+	encoder     entryEncoder
+	decoder     entryDecoder
+	data        bytes.Buffer
+}
+
+func newSpillFile(dir string) (*spillFile, error) {
+	f, err := os.CreateTemp(dir, "replay-spill-*")
+	if err != nil {
+		return nil, fmt.Errorf("failed to create spill file: %w", err)
+	}
+
+	return &spillFile{f: f}, nil
+}
+
+func (s *spillFile) write(entry *Entry) error {
+	s.data.Reset()
+	s.data.Write(make([]byte, 4))
+	if err := s.encoder.encode(buf.NewWriter(&s.data), entry); err != nil {
+		return err
+	}
+
+	data := s.data.Bytes()
+	binary.LittleEndian.PutUint32(data, uint32(len(data)-4))
+	if _, err := s.f.WriteAt(data, s.writeOffset); err != nil {
+		return err
+	}
+
+	s.writeOffset += int64(len(data))
+	return nil
+}
+
+func (s *spillFile) read() (*Entry, error) {
+	l := make([]byte, 4)
+	if _, err := s.f.ReadAt(l, s.readOffset); err != nil {
+		return nil, err
+	}
+
+	data := make([]byte, binary.LittleEndian.Uint32(l))
+	if _, err := s.f.ReadAt(data, s.readOffset+4); err != nil {
+		return nil, err
+	}
+
+	s.readOffset += int64(len(data)) + 4
+	return s.decoder.decode(buf.NewReader(bytes.NewReader(data), nil))
+}
+
+// reset empties the file once every entry was read
+func (s *spillFile) reset() error {
+	s.writeOffset = 0
+	s.readOffset = 0
+	s.encoder.reset()
+	s.decoder.reset()
+	return s.f.Truncate(0)
+}
+
+func (s *spillFile) close() error {
+	err := s.f.Close()
+	if rerr := os.Remove(s.f.Name()); err == nil && rerr != nil && !os.IsNotExist(rerr) {
+		err = rerr
+	}
+
+	return err
+}
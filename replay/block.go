@@ -0,0 +1,692 @@
+package replay
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"math"
+	"sort"
+
+	"github.com/hfoxy/iracing-sdk/buf"
+	"github.com/klauspost/compress/zstd"
+)
+
+// From format version 2 the header is followed by blocks of entries and an index:
+//
+//	block:  "ITBK" | first timestamp int64 | entries uint32 | length uint32 | crc uint32 | compressed entries
+//	index:  "ITIX" | (offset int64 | first timestamp int64 | entries uint32 | length uint32)...
+//	footer: index offset int64 | blocks uint32 | "ITIX"
+//
+// Every block starts with a keyframe holding the full YAML and variable data, so it can be
+// decompressed and decoded on its own. From version 4 the block header ends with a CRC-32C of the
+// header and the compressed entries, the block magic doubles as a sync marker to find the next block
+// after a corrupt one. Integers are little endian.
+const (
+	blockMagic        = "ITBK"
+	indexMagic        = "ITIX"
+	blockHeaderSize   = 24
+	blockHeaderSizeV2 = 20 // blocks of format versions 2 and 3 have no checksum
+	indexEntrySize    = 24
+	footerSize        = 16
+
+	// maxBlockSize is the size of the entries at which a block is written before it is full
+	maxBlockSize = 16 << 20
+	// maxBlockLength bounds the compressed length of a block, longer lengths are corrupt headers
+	maxBlockLength = 4 * maxBlockSize
+)
+
+var crcTable = crc32.MakeTable(crc32.Castagnoli)
+
+// DefaultKeyframeInterval is the number of entries per block
+const DefaultKeyframeInterval = 600
+
+// Seeker is implemented by readers that can jump to a timestamp without decoding the entries before it
+type Seeker interface {
+	// SeekTimestamp moves the reader so the next entry read is the last entry at or before timestamp, or the
+	// first entry if timestamp is before it
+	SeekTimestamp(timestamp int64) error
+}
+
+// Block describes a block of entries in a file
+type Block struct {
+	Offset         int64 // file offset of the block header
+	FirstTimestamp int64
+	Entries        int
+	Length         int  // compressed length, without the block header
+	Columnar       bool // set when read from the block header, see ReadChannel
+
+	headerSize int64
+	crc        uint32
+}
+
+func (b *Block) body() int64 {
+	return b.Offset + b.headerSize
+}
+
+func (b *Block) end() int64 {
+	return b.Offset + b.headerSize + int64(b.Length)
+}
+
+// putBlockHeader writes the header of a block holding body
+func putBlockHeader(dst []byte, b *Block, body []byte) {
+	if b.Columnar {
+		copy(dst, columnarMagic)
+	} else {
+		copy(dst, blockMagic)
+	}
+
+	binary.LittleEndian.PutUint64(dst[4:], uint64(b.FirstTimestamp))
+	binary.LittleEndian.PutUint32(dst[12:], uint32(b.Entries))
+	binary.LittleEndian.PutUint32(dst[16:], uint32(b.Length))
+	crc := crc32.Update(crc32.Checksum(dst[:blockHeaderSizeV2], crcTable), crcTable, body)
+	binary.LittleEndian.PutUint32(dst[20:], crc)
+}
+
+// blockCodec compresses and decompresses blocks
+type blockCodec struct {
+	codec     Codec
+	gzipLevel int
+	enc       *zstd.Encoder
+	dec       *zstd.Decoder
+}
+
+// newBlockCodec creates a codec, compression settings are taken from opts which is nil for readers
+func newBlockCodec(codec Codec, opts *WriterOptions) (*blockCodec, error) {
+	if opts == nil {
+		opts = &WriterOptions{}
+	}
+
+	c := &blockCodec{codec: codec, gzipLevel: gzip.DefaultCompression}
+	switch codec {
+	case CodecNone:
+	case CodecGzip:
+		if opts.GzipLevel != 0 {
+			c.gzipLevel = opts.GzipLevel
+		}
+
+		if _, err := gzip.NewWriterLevel(io.Discard, c.gzipLevel); err != nil {
+			return nil, fmt.Errorf("invalid gzip level: %w", err)
+		}
+	case CodecZstd:
+		encOpts := []zstd.EOption{zstd.WithEncoderLevel(zstd.EncoderLevelFromZstd(opts.ZstdLevel))}
+		if opts.ZstdLevel == 0 {
+			encOpts[0] = zstd.WithEncoderLevel(zstd.SpeedDefault)
+		}
+
+		if opts.WindowSize != 0 {
+			encOpts = append(encOpts, zstd.WithWindowSize(opts.WindowSize))
+		}
+
+		if opts.Concurrency > 0 {
+			encOpts = append(encOpts, zstd.WithEncoderConcurrency(opts.Concurrency))
+		}
+
+		var err error
+		if c.enc, err = zstd.NewWriter(nil, encOpts...); err != nil {
+			return nil, fmt.Errorf("failed to create zstd encoder: %w", err)
+		}
+
+		if c.dec, err = zstd.NewReader(nil); err != nil {
+			return nil, fmt.Errorf("failed to create zstd decoder: %w", err)
+		}
+	default:
+		return nil, fmt.Errorf("unsupported codec: %s", codec)
+	}
+
+	return c, nil
+}
+
+func (c *blockCodec) compress(data []byte) ([]byte, error) {
+	switch c.codec {
+	case CodecZstd:
+		return c.enc.EncodeAll(data, nil), nil
+	case CodecGzip:
+		var b bytes.Buffer
+		w, err := gzip.NewWriterLevel(&b, c.gzipLevel)
+		if err != nil {
+			return nil, err
+		}
+
+		if _, err := w.Write(data); err != nil {
+			return nil, err
+		}
+
+		if err := w.Close(); err != nil {
+			return nil, err
+		}
+
+		return b.Bytes(), nil
+	default:
+		return data, nil
+	}
+}
+
+func (c *blockCodec) decompress(data []byte) ([]byte, error) {
+	switch c.codec {
+	case CodecZstd:
+		return c.dec.DecodeAll(data, nil)
+	case CodecGzip:
+		r, err := gzip.NewReader(bytes.NewReader(data))
+		if err != nil {
+			return nil, err
+		}
+
+		defer r.Close()
+		return io.ReadAll(r)
+	default:
+		return data, nil
+	}
+}
+
+func (c *blockCodec) close() {
+	if c.enc != nil {
+		_ = c.enc.Close()
+	}
+
+	if c.dec != nil {
+		c.dec.Close()
+	}
+}
+
+// writeIndex writes the index and footer after the last block at offset
+func writeIndex(w io.Writer, offset int64, blocks []Block) error {
+	data := make([]byte, 0, len(indexMagic)+len(blocks)*indexEntrySize+footerSize)
+	data = append(data, indexMagic...)
+	for _, b := range blocks {
+		data = binary.LittleEndian.AppendUint64(data, uint64(b.Offset))
+		data = binary.LittleEndian.AppendUint64(data, uint64(b.FirstTimestamp))
+		data = binary.LittleEndian.AppendUint32(data, uint32(b.Entries))
+		data = binary.LittleEndian.AppendUint32(data, uint32(b.Length))
+	}
+
+	data = binary.LittleEndian.AppendUint64(data, uint64(offset))
+	data = binary.LittleEndian.AppendUint32(data, uint32(len(blocks)))
+	data = append(data, indexMagic...)
+
+	if _, err := w.Write(data); err != nil {
+		return fmt.Errorf("failed to write index: %w", err)
+	}
+
+	return nil
+}
+
+// CorruptRange is a range of a file skipped by a BlockReader
+type CorruptRange struct {
+	Start int64 // file offset of the first corrupt byte
+	End   int64 // file offset of the next valid block, or the end of the blocks
+	Err   error
+}
+
+func (c CorruptRange) String() string {
+	return fmt.Sprintf("%d-%d: %v", c.Start, c.End, c.Err)
+}
+
+// BlockReader reads files from format version 2, it can seek using the index in the footer. Corrupt
+// blocks are skipped, reading continues at the next valid block, see Corrupt.
+type BlockReader struct {
+	f          io.ReaderAt
+	closer     io.Closer // closes f, nil when there is nothing to close
+	fileSize   int64
+	stream     bool // f is a stream read forward only, its size is unknown
+	metadata   *Metadata
+	codec      *blockCodec
+	headerSize int64 // size of the block headers
+
+	dataOffset int64 // offset of the first block
+	dataEnd    int64 // offset of the index, or the file size when there is none; zero until known
+	next       int64 // offset of the next block to load
+	read       int64
+
+	block     *buf.Buffer // entries of the loaded block
+	loaded    Block
+	remaining int // entries left in the loaded block
+	decoder   entryDecoder
+	pending   []*Entry // entries decoded at once, returned before the block continues
+
+	index   []Block
+	corrupt []CorruptRange
+}
+
+// newBlockReader reads blocks from f, fileSize is negative when f is a stream of unknown size
+func newBlockReader(f io.ReaderAt, closer io.Closer, fileSize int64, meta *Metadata, headerSize int64) (*BlockReader, error) {
+	codec, err := newBlockCodec(meta.Codec, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	r := &BlockReader{
+		f:          f,
+		closer:     closer,
+		fileSize:   fileSize,
+		metadata:   meta,
+		codec:      codec,
+		headerSize: blockHeaderSize,
+		dataOffset: headerSize,
+		next:       headerSize,
+		read:       headerSize,
+	}
+
+	if meta.FormatVersion < 4 {
+		r.headerSize = blockHeaderSizeV2
+	}
+
+	if fileSize < 0 {
+		// streams are read until the index or their end
+		r.stream = true
+		r.fileSize = math.MaxInt64
+	}
+
+	return r, nil
+}
+
+// Metadata returns the metadata from the file header
+func (r *BlockReader) Metadata() *Metadata {
+	return r.metadata
+}
+
+// Corrupt returns the ranges of the file skipped so far because they could not be read
+func (r *BlockReader) Corrupt() []CorruptRange {
+	return r.corrupt
+}
+
+var errCorruptBlock = errors.New("corrupt block")
+
+// readBlockHeader reads the header of the block at offset. It returns io.EOF at the index or at the
+// end of a file that was not closed.
+func (r *BlockReader) readBlockHeader(offset int64) (Block, error) {
+	h := make([]byte, r.headerSize)
+	n, err := r.f.ReadAt(h, offset)
+	if n >= len(indexMagic) && string(h[:len(indexMagic)]) == indexMagic {
+		return Block{}, io.EOF
+	}
+
+	if n < len(h) {
+		if err == nil || errors.Is(err, io.EOF) {
+			return Block{}, io.EOF
+		}
+
+		return Block{}, err
+	}
+
+	magic := string(h[:len(blockMagic)])
+	if magic != blockMagic && magic != columnarMagic {
+		return Block{}, fmt.Errorf("%w: no block header at offset %d", errCorruptBlock, offset)
+	}
+
+	b := Block{
+		Offset:         offset,
+		FirstTimestamp: int64(binary.LittleEndian.Uint64(h[4:])),
+		Entries:        int(binary.LittleEndian.Uint32(h[12:])),
+		Length:         int(binary.LittleEndian.Uint32(h[16:])),
+		Columnar:       magic == columnarMagic,
+		headerSize:     r.headerSize,
+	}
+
+	if b.Length > maxBlockLength {
+		return Block{}, fmt.Errorf("%w: block length %d at offset %d", errCorruptBlock, b.Length, offset)
+	}
+
+	if r.headerSize == blockHeaderSize {
+		// the checksum covers the body too, it is verified by readBody
+		b.crc = binary.LittleEndian.Uint32(h[20:])
+	}
+
+	return b, nil
+}
+
+// readBody reads the compressed body of b and verifies its checksum
+func (r *BlockReader) readBody(b Block) ([]byte, error) {
+	if b.end() > r.fileSize {
+		return nil, io.ErrUnexpectedEOF
+	}
+
+	// the header is read again as the checksum covers it
+	data := make([]byte, b.end()-b.Offset)
+	if _, err := r.f.ReadAt(data, b.Offset); err != nil {
+		if errors.Is(err, io.EOF) {
+			// a stream ending within the block
+			return nil, io.ErrUnexpectedEOF
+		}
+
+		return nil, fmt.Errorf("failed to read block at offset %d: %w", b.Offset, err)
+	}
+
+	if b.headerSize == blockHeaderSize {
+		if crc32.Update(crc32.Checksum(data[:blockHeaderSizeV2], crcTable), crcTable, data[b.headerSize:]) != b.crc {
+			return nil, fmt.Errorf("%w: checksum mismatch at offset %d", errCorruptBlock, b.Offset)
+		}
+	}
+
+	return data[b.headerSize:], nil
+}
+
+// load reads the block at offset. Entries of row blocks are decoded as they are read, columnar
+// blocks are decoded at once into pending.
+func (r *BlockReader) load(offset int64) error {
+	b, err := r.readBlockHeader(offset)
+	if err != nil {
+		return err
+	}
+
+	data, err := r.readBody(b)
+	if err != nil {
+		return err
+	}
+
+	r.pending = nil
+	r.remaining = 0
+	if b.Columnar {
+		c, err := r.openColumnar(b, &bodyReader{data: data, offset: b.body()})
+		if err != nil {
+			return err
+		}
+
+		if r.pending, err = c.entries(); err != nil {
+			return fmt.Errorf("%w: failed to decode block at offset %d: %v", errCorruptBlock, offset, err)
+		}
+	} else {
+		if data, err = r.codec.decompress(data); err != nil {
+			return fmt.Errorf("%w: failed to decompress block at offset %d: %v", errCorruptBlock, offset, err)
+		}
+
+		r.block = buf.NewReader(bytes.NewReader(data), nil)
+		r.remaining = b.Entries
+		r.decoder.reset()
+	}
+
+	r.loaded = b
+	r.next = b.end()
+	r.read = b.end()
+	return nil
+}
+
+// bodyReader reads a block body held in memory at its file offsets
+type bodyReader struct {
+	data   []byte
+	offset int64
+}
+
+func (b *bodyReader) ReadAt(p []byte, off int64) (int, error) {
+	off -= b.offset
+	if off < 0 || off > int64(len(b.data)) {
+		return 0, io.EOF
+	}
+
+	n := copy(p, b.data[off:])
+	if n < len(p) {
+		return n, io.EOF
+	}
+
+	return n, nil
+}
+
+func (r *BlockReader) ReadEntry() (*Entry, error) {
+	for {
+		if len(r.pending) > 0 {
+			entry := r.pending[0]
+			r.pending = r.pending[1:]
+			return entry, nil
+		}
+
+		if r.remaining > 0 {
+			entry, err := r.decoder.decode(r.block)
+			if err == nil {
+				r.remaining--
+				return entry, nil
+			}
+
+			// blocks without a checksum may only turn out corrupt once decoded
+			r.remaining = 0
+			r.corrupt = append(r.corrupt, CorruptRange{Start: r.loaded.Offset, End: r.loaded.end(), Err: fmt.Errorf("failed to decode entry: %w", err)})
+			continue
+		}
+
+		err := r.load(r.next)
+		if errors.Is(err, io.EOF) {
+			return &Entry{}, ErrEndOfFile
+		}
+
+		if err != nil {
+			if !errors.Is(err, errCorruptBlock) && !errors.Is(err, io.ErrUnexpectedEOF) {
+				return nil, err
+			}
+
+			if !r.skip(r.next, err) {
+				return &Entry{}, ErrEndOfFile
+			}
+		}
+	}
+}
+
+// skip records the block at offset as corrupt and moves to the next valid block, it reports whether
+// there is one
+func (r *BlockReader) skip(offset int64, cause error) bool {
+	next, ok := r.resync(offset + 1)
+	r.corrupt = append(r.corrupt, CorruptRange{Start: offset, End: next, Err: cause})
+	r.next = next
+	return ok
+}
+
+// resync returns the offset of the first valid block at or after offset, or the end of the blocks
+func (r *BlockReader) resync(offset int64) (int64, bool) {
+	end := r.blocksEnd()
+	chunk := make([]byte, 64*1024)
+	for offset < end {
+		n, err := r.f.ReadAt(chunk[:min(int64(len(chunk)), end-offset)], offset)
+		if n == 0 && err != nil {
+			break
+		}
+
+		for i := 0; i+len(blockMagic) <= n; i++ {
+			magic := string(chunk[i : i+len(blockMagic)])
+			if magic != blockMagic && magic != columnarMagic {
+				continue
+			}
+
+			b, err := r.readBlockHeader(offset + int64(i))
+			if err != nil || b.end() > end {
+				continue
+			}
+
+			if _, err = r.readBody(b); err == nil {
+				return b.Offset, true
+			}
+		}
+
+		// a magic may straddle two chunks
+		offset += int64(max(n-len(blockMagic)+1, 1))
+	}
+
+	return end, false
+}
+
+// blocksEnd returns the offset where the blocks end, the index offset or the file size
+func (r *BlockReader) blocksEnd() int64 {
+	if r.dataEnd == 0 {
+		r.dataEnd = r.fileSize
+		if r.stream {
+			return r.dataEnd
+		}
+
+		if offset, _, err := r.readFooter(); err == nil {
+			r.dataEnd = offset
+		}
+	}
+
+	return r.dataEnd
+}
+
+// Index returns the blocks of the file, read from the footer or, for files that were not closed,
+// from the block headers. Streams have no index.
+func (r *BlockReader) Index() ([]Block, error) {
+	if r.index != nil {
+		return r.index, nil
+	}
+
+	if r.stream {
+		return nil, ErrNotSeekable
+	}
+
+	index, err := r.readIndex()
+	if err != nil {
+		index, err = r.scanIndex()
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	r.index = index
+	return index, nil
+}
+
+// readFooter returns the offset of the index and the number of blocks
+func (r *BlockReader) readFooter() (int64, int, error) {
+	footer := make([]byte, footerSize)
+	if r.fileSize < r.dataOffset+footerSize {
+		return 0, 0, errors.New("file has no footer")
+	}
+
+	if _, err := r.f.ReadAt(footer, r.fileSize-footerSize); err != nil {
+		return 0, 0, err
+	}
+
+	if string(footer[12:]) != indexMagic {
+		return 0, 0, errors.New("file has no footer")
+	}
+
+	offset := int64(binary.LittleEndian.Uint64(footer))
+	count := int(binary.LittleEndian.Uint32(footer[8:]))
+	if offset < r.dataOffset || offset+int64(len(indexMagic)+count*indexEntrySize) != r.fileSize-footerSize {
+		return 0, 0, errors.New("invalid footer")
+	}
+
+	return offset, count, nil
+}
+
+func (r *BlockReader) readIndex() ([]Block, error) {
+	offset, count, err := r.readFooter()
+	if err != nil {
+		return nil, err
+	}
+
+	data := make([]byte, count*indexEntrySize)
+	if _, err := r.f.ReadAt(data, offset+int64(len(indexMagic))); err != nil {
+		return nil, err
+	}
+
+	index := make([]Block, count)
+	for i := range index {
+		e := data[i*indexEntrySize:]
+		index[i] = Block{
+			Offset:         int64(binary.LittleEndian.Uint64(e)),
+			FirstTimestamp: int64(binary.LittleEndian.Uint64(e[8:])),
+			Entries:        int(binary.LittleEndian.Uint32(e[16:])),
+			Length:         int(binary.LittleEndian.Uint32(e[20:])),
+			headerSize:     r.headerSize,
+		}
+	}
+
+	return index, nil
+}
+
+// scanIndex builds the index from the block headers, without decompressing any block. Corrupt blocks
+// are left out.
+func (r *BlockReader) scanIndex() ([]Block, error) {
+	index := make([]Block, 0)
+	offset := r.dataOffset
+	for {
+		b, err := r.readBlockHeader(offset)
+		if errors.Is(err, io.EOF) {
+			return index, nil
+		}
+
+		if err == nil && b.end() <= r.fileSize {
+			index = append(index, b)
+			offset = b.end()
+			continue
+		}
+
+		if err != nil && !errors.Is(err, errCorruptBlock) {
+			return nil, err
+		}
+
+		var ok bool
+		if offset, ok = r.resync(offset + 1); !ok {
+			return index, nil
+		}
+	}
+}
+
+func (r *BlockReader) SeekTimestamp(timestamp int64) error {
+	index, err := r.Index()
+	if err != nil {
+		return err
+	}
+
+	r.pending = nil
+	r.remaining = 0
+	if len(index) == 0 {
+		return nil
+	}
+
+	i := sort.Search(len(index), func(i int) bool {
+		return index[i].FirstTimestamp > timestamp
+	})
+
+	r.next = index[max(i-1, 0)].Offset
+	if err = r.load(r.next); err != nil {
+		if !errors.Is(err, errCorruptBlock) && !errors.Is(err, io.ErrUnexpectedEOF) {
+			return err
+		}
+
+		// reading continues at the next valid block
+		r.skip(r.next, err)
+		return nil
+	}
+
+	// decode the loaded block only, ReadEntry would move on to the next block on a decode error
+	entries := r.pending
+	for ; r.remaining > 0; r.remaining-- {
+		entry, err := r.decoder.decode(r.block)
+		if err != nil {
+			r.remaining = 0
+			r.corrupt = append(r.corrupt, CorruptRange{Start: r.loaded.Offset, End: r.loaded.end(), Err: fmt.Errorf("failed to decode entry: %w", err)})
+			break
+		}
+
+		entries = append(entries, entry)
+	}
+
+	// keep the last entry at or before timestamp and every entry after it
+	j := sort.Search(len(entries), func(j int) bool {
+		return entries[j].Timestamp > timestamp
+	})
+
+	r.pending = entries[max(j-1, 0):]
+	return nil
+}
+
+func (r *BlockReader) ReadSize() int64 {
+	return r.read
+}
+
+func (r *BlockReader) Size() int64 {
+	if r.stream {
+		return 0
+	}
+
+	return r.fileSize
+}
+
+func (r *BlockReader) Close() error {
+	r.codec.close()
+	if r.closer == nil {
+		return nil
+	}
+
+	return r.closer.Close()
+}
@@ -0,0 +1,699 @@
+package replay
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"sort"
+
+	"github.com/hfoxy/iracing-sdk/buf"
+)
+
+// A columnar block stores the variables of raw rows one column per variable, so a single channel can
+// be read without decompressing the others. Its body is:
+//
+//	directory length uint32 | directory | times | extra | column...
+//
+// The directory holds the variable headers, the row length, the length of every section and the minimum
+// and maximum value of every column. The times section holds the timestamp and flags of every entry, the
+// extra section the YAML and non-row variable data when they changed. Every section is compressed on its
+// own. Bytes of a row not covered by a variable are not stored and read back as zero.
+const columnarMagic = "ITCB"
+
+// ChannelReader is implemented by readers that can read a single variable without decoding whole entries
+type ChannelReader interface {
+	// ReadChannel returns the values of the variable name from from to to, both inclusive
+	ReadChannel(name string, from int64, to int64) ([]Sample, error)
+}
+
+// Sample holds the values of a channel at a timestamp, arrays have one value per element
+type Sample struct {
+	Timestamp int64
+	Values    []float64
+}
+
+// ChunkStats describes the values of a channel in a columnar block
+type ChunkStats struct {
+	Block
+	Min float64
+	Max float64
+}
+
+// column is a variable of a raw row, parsed from its irsdk_varHeader
+type column struct {
+	name    string
+	varType uint8
+	offset  int
+	count   int
+}
+
+func (c *column) size() int {
+	return c.count * varTypeSize(c.varType)
+}
+
+func varTypeSize(t uint8) int {
+	switch t {
+	case 0, 1: // char, bool
+		return 1
+	case 2, 3, 4: // int, bitfield, float
+		return 4
+	case 5: // double
+		return 8
+	default:
+		return 0
+	}
+}
+
+// value returns element i of the column in row as a float64
+func (c *column) value(row []byte, i int) float64 {
+	b := row[c.offset+i*varTypeSize(c.varType):]
+	switch c.varType {
+	case 0, 1:
+		return float64(b[0])
+	case 2:
+		return float64(int32(binary.LittleEndian.Uint32(b)))
+	case 3:
+		return float64(binary.LittleEndian.Uint32(b))
+	case 4:
+		return float64(math.Float32frombits(binary.LittleEndian.Uint32(b)))
+	default:
+		return math.Float64frombits(binary.LittleEndian.Uint64(b))
+	}
+}
+
+func parseColumns(schema string, rowLength int) ([]column, error) {
+	headers, err := ParseVarHeaders(schema)
+	if err != nil {
+		return nil, err
+	}
+
+	columns := make([]column, 0, len(headers))
+	for _, h := range headers {
+		c := column{name: h.Name, varType: uint8(h.Type), offset: h.Offset, count: h.Count}
+		if h.Type != int(c.varType) || c.size() == 0 || c.offset+c.size() > rowLength {
+			return nil, fmt.Errorf("variable %s does not fit in a row of %d bytes", c.name, rowLength)
+		}
+
+		columns = append(columns, c)
+	}
+
+	return columns, nil
+}
+
+func findColumn(columns []column, name string) (int, bool) {
+	for i := range columns {
+		if columns[i].name == name {
+			return i, true
+		}
+	}
+
+	return 0, false
+}
+
+// columnarDir is the directory of a columnar block
+type columnarDir struct {
+	schema    string
+	rowLength int
+	times     int
+	extra     int
+	columns   []column
+	stats     [][2]float64
+	lengths   []int
+}
+
+func (d *columnarDir) encode() []byte {
+	data := binary.AppendUvarint(nil, uint64(len(d.schema)))
+	data = append(data, d.schema...)
+	data = binary.AppendUvarint(data, uint64(d.rowLength))
+	data = binary.AppendUvarint(data, uint64(d.times))
+	data = binary.AppendUvarint(data, uint64(d.extra))
+	data = binary.AppendUvarint(data, uint64(len(d.lengths)))
+	for i, length := range d.lengths {
+		data = binary.LittleEndian.AppendUint64(data, math.Float64bits(d.stats[i][0]))
+		data = binary.LittleEndian.AppendUint64(data, math.Float64bits(d.stats[i][1]))
+		data = binary.AppendUvarint(data, uint64(length))
+	}
+
+	return data
+}
+
+var errCorruptDirectory = errors.New("corrupt columnar block directory")
+
+// maxRowLength bounds the rows of a columnar block, the simulator's rows are a few kilobytes
+const maxRowLength = 1 << 20
+
+func decodeColumnarDir(data []byte) (*columnarDir, error) {
+	next := func() int {
+		v, n := binary.Uvarint(data)
+		if n <= 0 || v > uint64(math.MaxInt32) {
+			data = nil
+			return -1
+		}
+
+		data = data[n:]
+		return int(v)
+	}
+
+	d := &columnarDir{}
+	length := next()
+	if length < 0 || length > len(data) {
+		return nil, errCorruptDirectory
+	}
+
+	d.schema = string(data[:length])
+	data = data[length:]
+	d.rowLength = next()
+	d.times = next()
+	d.extra = next()
+	count := next()
+	if d.rowLength < 0 || d.rowLength > maxRowLength || d.times < 0 || d.extra < 0 || count < 0 {
+		return nil, errCorruptDirectory
+	}
+
+	var err error
+	if d.columns, err = parseColumns(d.schema, d.rowLength); err != nil {
+		return nil, err
+	}
+
+	if count != len(d.columns) {
+		return nil, errCorruptDirectory
+	}
+
+	d.stats = make([][2]float64, count)
+	d.lengths = make([]int, count)
+	for i := range d.lengths {
+		if len(data) < 16 {
+			return nil, errCorruptDirectory
+		}
+
+		d.stats[i][0] = math.Float64frombits(binary.LittleEndian.Uint64(data))
+		d.stats[i][1] = math.Float64frombits(binary.LittleEndian.Uint64(data[8:]))
+		data = data[16:]
+		if d.lengths[i] = next(); d.lengths[i] < 0 {
+			return nil, errCorruptDirectory
+		}
+	}
+
+	return d, nil
+}
+
+// columnarBlock collects the entries of a columnar block. Every raw row of a block has the same
+// variable headers and length.
+type columnarBlock struct {
+	entries   []Entry
+	schema    string
+	row       string
+	rowLength int
+	size      int // approximate size of the encoded entries
+}
+
+// fits reports whether entry can be added to the block
+func (b *columnarBlock) fits(entry *Entry) bool {
+	schema, row, ok := DecodeRowData(entry.VariableData)
+	if !ok || b.row == "" {
+		return true
+	}
+
+	return schema == b.schema && len(row) == b.rowLength
+}
+
+func (b *columnarBlock) add(entry *Entry) {
+	schema, row, ok := DecodeRowData(entry.VariableData)
+	if ok && b.row == "" {
+		b.schema = schema
+		b.row = row
+		b.rowLength = len(row)
+	}
+
+	// YAML and other variable data are only stored when they change
+	var last *Entry
+	if n := len(b.entries); n > 0 {
+		last = &b.entries[n-1]
+	}
+
+	if ok {
+		b.size += len(row)
+	} else if last == nil || last.VariableData != entry.VariableData {
+		b.size += len(entry.VariableData)
+	}
+
+	if last == nil || last.YamlData != entry.YamlData {
+		b.size += len(entry.YamlData)
+	}
+
+	b.entries = append(b.entries, *entry)
+}
+
+// encode returns the body of the block
+func (b *columnarBlock) encode(codec *blockCodec) ([]byte, error) {
+	columns, err := parseColumns(b.schema, b.rowLength)
+	if err != nil {
+		return nil, err
+	}
+
+	var times, extra bytes.Buffer
+	tw := buf.NewWriter(&times)
+	ew := buf.NewWriter(&extra)
+	data := make([][]byte, len(columns))
+	stats := make([][2]float64, len(columns))
+	for i := range stats {
+		stats[i] = [2]float64{math.Inf(1), math.Inf(-1)}
+	}
+
+	var lastTimestamp int64
+	var lastYaml, lastVariableData string
+	for i := range b.entries {
+		entry := &b.entries[i]
+		_, rowData, hasRow := DecodeRowData(entry.VariableData)
+		row := []byte(rowData)
+
+		var bm buf.BitMap
+		bm[bitYamlUpdated] = i == 0 || entry.YamlData != lastYaml
+		bm[bitVariableUpdated] = !hasRow && (i == 0 || entry.VariableData != lastVariableData)
+		bm[bitConnected] = entry.Connected
+		bm[bitNotOk] = entry.NotOk
+		bm[bitRow] = hasRow
+
+		if err = tw.WriteVarLong(entry.Timestamp - lastTimestamp); err != nil {
+			return nil, err
+		}
+
+		if err = tw.WriteBitMap(bm); err != nil {
+			return nil, err
+		}
+
+		if bm[bitYamlUpdated] {
+			if err = ew.WriteString(entry.YamlData); err != nil {
+				return nil, err
+			}
+		}
+
+		if bm[bitVariableUpdated] {
+			if err = ew.WriteString(entry.VariableData); err != nil {
+				return nil, err
+			}
+
+			lastVariableData = entry.VariableData
+		}
+
+		lastTimestamp = entry.Timestamp
+		lastYaml = entry.YamlData
+		if !hasRow {
+			continue
+		}
+
+		for j := range columns {
+			c := &columns[j]
+			data[j] = append(data[j], row[c.offset:c.offset+c.size()]...)
+			for k := 0; k < c.count; k++ {
+				v := c.value(row, k)
+				stats[j][0] = min(stats[j][0], v)
+				stats[j][1] = max(stats[j][1], v)
+			}
+		}
+	}
+
+	sections := make([][]byte, 0, len(columns)+2)
+	for _, section := range append([][]byte{times.Bytes(), extra.Bytes()}, data...) {
+		compressed, err := codec.compress(section)
+		if err != nil {
+			return nil, err
+		}
+
+		sections = append(sections, compressed)
+	}
+
+	dir := &columnarDir{
+		schema:    b.schema,
+		rowLength: b.rowLength,
+		times:     len(sections[0]),
+		extra:     len(sections[1]),
+		stats:     stats,
+		lengths:   make([]int, len(columns)),
+	}
+
+	for i := range columns {
+		dir.lengths[i] = len(sections[i+2])
+	}
+
+	compressedDir, err := codec.compress(dir.encode())
+	if err != nil {
+		return nil, err
+	}
+
+	body := binary.LittleEndian.AppendUint32(nil, uint32(len(compressedDir)))
+	body = append(body, compressedDir...)
+	for _, section := range sections {
+		body = append(body, section...)
+	}
+
+	return body, nil
+}
+
+// columnarReader reads the sections of a columnar block
+type columnarReader struct {
+	r     *BlockReader
+	src   io.ReaderAt
+	block Block
+	dir   *columnarDir
+	start int64 // offset of the times section
+}
+
+// openBlock verifies b and reads the directory of the columnar block from its body
+func (r *BlockReader) openBlock(b Block) (*columnarReader, error) {
+	body, err := r.readBody(b)
+	if err != nil {
+		return nil, err
+	}
+
+	return r.openColumnar(b, &bodyReader{data: body, offset: b.body()})
+}
+
+// openColumnar reads the directory of a columnar block from src, the file or the body of the block
+func (r *BlockReader) openColumnar(b Block, src io.ReaderAt) (*columnarReader, error) {
+	l := make([]byte, 4)
+	if _, err := src.ReadAt(l, b.body()); err != nil {
+		return nil, fmt.Errorf("failed to read columnar block at offset %d: %w", b.Offset, err)
+	}
+
+	dirOffset := b.body() + 4
+	data, err := r.readSection(src, dirOffset, int(binary.LittleEndian.Uint32(l)))
+	if err != nil {
+		return nil, err
+	}
+
+	dir, err := decodeColumnarDir(data)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read columnar block at offset %d: %w", b.Offset, err)
+	}
+
+	return &columnarReader{r: r, src: src, block: b, dir: dir, start: dirOffset + int64(binary.LittleEndian.Uint32(l))}, nil
+}
+
+// readSection reads and decompresses length bytes at offset of src
+func (r *BlockReader) readSection(src io.ReaderAt, offset int64, length int) ([]byte, error) {
+	if offset+int64(length) > r.fileSize {
+		return nil, fmt.Errorf("section at offset %d is past the end of the file", offset)
+	}
+
+	data := make([]byte, length)
+	if _, err := src.ReadAt(data, offset); err != nil {
+		return nil, fmt.Errorf("failed to read section at offset %d: %w", offset, err)
+	}
+
+	data, err := r.codec.decompress(data)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decompress section at offset %d: %w", offset, err)
+	}
+
+	return data, nil
+}
+
+func (c *columnarReader) times() ([]int64, []buf.BitMap, error) {
+	data, err := c.r.readSection(c.src, c.start, c.dir.times)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	// every entry takes at least a byte of timestamp and a byte of bitmap
+	if c.block.Entries > len(data)/2 {
+		return nil, nil, fmt.Errorf("block at offset %d has %d entries in %d bytes of timestamps", c.block.Offset, c.block.Entries, len(data))
+	}
+
+	r := buf.NewReader(bytes.NewReader(data), nil)
+	timestamps := make([]int64, c.block.Entries)
+	flags := make([]buf.BitMap, c.block.Entries)
+	var timestamp int64
+	for i := range timestamps {
+		delta, _, err := r.ReadVarLong()
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to read timestamp: %w", err)
+		}
+
+		if flags[i], err = r.ReadBitMap(); err != nil {
+			return nil, nil, fmt.Errorf("failed to read bitmap: %w", err)
+		}
+
+		timestamp += delta
+		timestamps[i] = timestamp
+	}
+
+	return timestamps, flags, nil
+}
+
+func (c *columnarReader) extra() (*buf.Buffer, error) {
+	data, err := c.r.readSection(c.src, c.start+int64(c.dir.times), c.dir.extra)
+	if err != nil {
+		return nil, err
+	}
+
+	return buf.NewReader(bytes.NewReader(data), nil), nil
+}
+
+// column returns the values of column i for every row of the block
+func (c *columnarReader) column(i int) ([]byte, error) {
+	offset := c.start + int64(c.dir.times+c.dir.extra)
+	for _, length := range c.dir.lengths[:i] {
+		offset += int64(length)
+	}
+
+	data, err := c.r.readSection(c.src, offset, c.dir.lengths[i])
+	if err != nil {
+		return nil, err
+	}
+
+	if len(data)%c.dir.columns[i].size() != 0 {
+		return nil, fmt.Errorf("invalid length %d of column %s", len(data), c.dir.columns[i].name)
+	}
+
+	return data, nil
+}
+
+// entries decodes every entry of the block
+func (c *columnarReader) entries() ([]*Entry, error) {
+	timestamps, flags, err := c.times()
+	if err != nil {
+		return nil, err
+	}
+
+	extra, err := c.extra()
+	if err != nil {
+		return nil, err
+	}
+
+	columns := make([][]byte, len(c.dir.columns))
+	for i := range columns {
+		if columns[i], err = c.column(i); err != nil {
+			return nil, err
+		}
+	}
+
+	entries := make([]*Entry, len(timestamps))
+	var yaml, variableData string
+	rows := 0
+	for i, bm := range flags {
+		if bm[bitYamlUpdated] {
+			if yaml, err = extra.ReadString(); err != nil {
+				return nil, fmt.Errorf("failed to read yaml data: %w", err)
+			}
+		}
+
+		if bm[bitVariableUpdated] {
+			if variableData, err = extra.ReadString(); err != nil {
+				return nil, fmt.Errorf("failed to read variable data: %w", err)
+			}
+		}
+
+		entry := &Entry{
+			Timestamp:    timestamps[i],
+			Connected:    bm[bitConnected],
+			NotOk:        bm[bitNotOk],
+			YamlData:     yaml,
+			VariableData: variableData,
+		}
+
+		if bm[bitRow] {
+			row := make([]byte, c.dir.rowLength)
+			for j := range c.dir.columns {
+				col := &c.dir.columns[j]
+				start := rows * col.size()
+				if start+col.size() > len(columns[j]) {
+					return nil, fmt.Errorf("column %s is missing row %d", col.name, rows)
+				}
+
+				copy(row[col.offset:], columns[j][start:start+col.size()])
+			}
+
+			entry.VariableData = EncodeRowData([]byte(c.dir.schema), row)
+			rows++
+		}
+
+		entries[i] = entry
+	}
+
+	return entries, nil
+}
+
+// ReadChannel returns the values of the variable name for every entry from from to to, both inclusive.
+// Columnar blocks only decompress the timestamps and the column of the variable, other blocks are
+// decoded entry by entry. Entries without the variable are skipped.
+func (r *BlockReader) ReadChannel(name string, from int64, to int64) ([]Sample, error) {
+	samples := make([]Sample, 0)
+	err := r.forBlocks(from, to, func(b Block) error {
+		if !b.Columnar {
+			return r.readRowChannel(b, name, from, to, &samples)
+		}
+
+		c, err := r.openBlock(b)
+		if err != nil {
+			return err
+		}
+
+		i, ok := findColumn(c.dir.columns, name)
+		if !ok {
+			return nil
+		}
+
+		timestamps, flags, err := c.times()
+		if err != nil {
+			return err
+		}
+
+		data, err := c.column(i)
+		if err != nil {
+			return err
+		}
+
+		col := c.dir.columns[i]
+		col.offset = 0
+		rows := 0
+		for j, timestamp := range timestamps {
+			if !flags[j][bitRow] {
+				continue
+			}
+
+			start := rows * col.size()
+			if start+col.size() > len(data) {
+				return fmt.Errorf("column %s is missing row %d", col.name, rows)
+			}
+
+			value := data[start:]
+			rows++
+			if timestamp < from || timestamp > to {
+				continue
+			}
+
+			samples = append(samples, Sample{Timestamp: timestamp, Values: col.values(value)})
+		}
+
+		return nil
+	})
+
+	return samples, err
+}
+
+// ChannelStats returns the minimum and maximum value of the variable name in every columnar block
+func (r *BlockReader) ChannelStats(name string) ([]ChunkStats, error) {
+	stats := make([]ChunkStats, 0)
+	err := r.forBlocks(math.MinInt64, math.MaxInt64, func(b Block) error {
+		if !b.Columnar {
+			return nil
+		}
+
+		c, err := r.openBlock(b)
+		if err != nil {
+			return err
+		}
+
+		if i, ok := findColumn(c.dir.columns, name); ok {
+			stats = append(stats, ChunkStats{Block: b, Min: c.dir.stats[i][0], Max: c.dir.stats[i][1]})
+		}
+
+		return nil
+	})
+
+	return stats, err
+}
+
+// forBlocks calls fn with the header of every block that may hold entries from from to to
+func (r *BlockReader) forBlocks(from int64, to int64, fn func(b Block) error) error {
+	index, err := r.Index()
+	if err != nil {
+		return err
+	}
+
+	first := sort.Search(len(index), func(i int) bool {
+		return index[i].FirstTimestamp > from
+	})
+
+	for i := max(first-1, 0); i < len(index) && index[i].FirstTimestamp <= to; i++ {
+		b, err := r.readBlockHeader(index[i].Offset)
+		if err != nil {
+			return err
+		}
+
+		if err = fn(b); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (r *BlockReader) readRowChannel(b Block, name string, from int64, to int64, samples *[]Sample) error {
+	data, err := r.readBody(b)
+	if err != nil {
+		return err
+	}
+
+	if data, err = r.codec.decompress(data); err != nil {
+		return fmt.Errorf("failed to decompress block at offset %d: %w", b.Offset, err)
+	}
+
+	in := buf.NewReader(bytes.NewReader(data), nil)
+	var decoder entryDecoder
+	var schema string
+	var columns []column
+	for i := 0; i < b.Entries; i++ {
+		entry, err := decoder.decode(in)
+		if err != nil {
+			return fmt.Errorf("failed to decode entry: %w", err)
+		}
+
+		if entry.Timestamp < from || entry.Timestamp > to {
+			continue
+		}
+
+		s, row, ok := DecodeRowData(entry.VariableData)
+		if !ok {
+			continue
+		}
+
+		if columns == nil || s != schema {
+			if columns, err = parseColumns(s, len(row)); err != nil {
+				return err
+			}
+
+			schema = s
+		}
+
+		if j, ok := findColumn(columns, name); ok {
+			*samples = append(*samples, Sample{Timestamp: entry.Timestamp, Values: columns[j].values([]byte(row))})
+		}
+	}
+
+	return nil
+}
+
+// values returns every element of the column in row
+func (c *column) values(row []byte) []float64 {
+	values := make([]float64, c.count)
+	for i := range values {
+		values[i] = c.value(row, i)
+	}
+
+	return values
+}
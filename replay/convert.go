@@ -0,0 +1,67 @@
+package replay
+
+import (
+	"errors"
+	"fmt"
+	"os"
+)
+
+// ConvertOptions configures Convert
+type ConvertOptions struct {
+	WriterOptions
+
+	// Progress is called after every entry with the bytes read from the source and its size
+	Progress func(read int64, size int64)
+}
+
+// Convert transcodes the recording src into a new file dst, the format and compression of dst are
+// taken from its extension and opts. The metadata of src is kept unless opts sets its own.
+// dst is removed when the conversion fails.
+func Convert(src string, dst string, opts ConvertOptions) (err error) {
+	r, err := NewReader(src)
+	if err != nil {
+		return err
+	}
+
+	defer r.Close()
+
+	if opts.Metadata == nil {
+		opts.Metadata = sourceMetadata(r)
+	}
+
+	w, err := NewWriterWithOptions(dst, opts.WriterOptions)
+	if err != nil {
+		return err
+	}
+
+	defer func() {
+		if cerr := w.Close(); err == nil {
+			err = cerr
+		}
+
+		if err != nil {
+			_ = os.Remove(dst)
+		}
+	}()
+
+	for i := 0; ; i++ {
+		entry, err := r.ReadEntry()
+		if errors.Is(err, ErrEndOfFile) {
+			break
+		}
+
+		if err != nil {
+			return fmt.Errorf("failed to read entry %d: %w", i, err)
+		}
+
+		if err = w.WriteEntry(entry); err != nil {
+			return fmt.Errorf("failed to write entry %d: %w", i, err)
+		}
+
+		if opts.Progress != nil {
+			opts.Progress(r.ReadSize(), r.Size())
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,342 @@
+package replay
+
+import (
+	"bytes"
+	"cmp"
+	"encoding/base64"
+	"encoding/gob"
+	"errors"
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/go-yaml/yaml"
+)
+
+// TrimOptions selects the entries kept by Trim
+type TrimOptions struct {
+	WriterOptions
+
+	From int64 // first timestamp kept
+	To   int64 // last timestamp kept, zero keeps every entry after From
+
+	// Sessions keeps only the entries whose SessionNum variable is listed, every session is kept when
+	// it is empty
+	Sessions []int
+}
+
+// Trim writes the entries of src selected by opts to a new file dst. The metadata of src is kept unless
+// opts sets its own, dst is removed when trimming fails.
+func Trim(src string, dst string, opts TrimOptions) error {
+	to := opts.To
+	if to == 0 {
+		to = math.MaxInt64
+	}
+
+	r, err := NewReader(src)
+	if err != nil {
+		return err
+	}
+
+	defer r.Close()
+
+	if opts.Metadata == nil {
+		opts.Metadata = sourceMetadata(r)
+	}
+
+	return writeFile(dst, opts.WriterOptions, func(w Writer) error {
+		return forEntries(r, func(entry *Entry) error {
+			if entry.Timestamp < opts.From || entry.Timestamp > to {
+				return nil
+			}
+
+			if len(opts.Sessions) > 0 {
+				sessionNum, ok := variableInt(entry.VariableData, "SessionNum")
+				if !ok || !slices.Contains(opts.Sessions, sessionNum) {
+					return nil
+				}
+			}
+
+			return w.WriteEntry(entry)
+		})
+	})
+}
+
+// SplitSessions writes every session of src to its own file in dir, named after src, the SessionNum and
+// the session type from the session info, e.g. race-2-race.zsitrpy. Entries without a SessionNum, such as
+// disconnected ones, stay with the session before them. It returns the files written in session order.
+func SplitSessions(src string, dir string) ([]string, error) {
+	r, err := NewReader(src)
+	if err != nil {
+		return nil, err
+	}
+
+	defer r.Close()
+
+	ext := filepath.Ext(src)
+	base := strings.TrimSuffix(filepath.Base(src), ext)
+	if ext != ".itrpy" && ext != ".zsitrpy" && ext != ".gzitrpy" {
+		ext = ".zsitrpy"
+	}
+
+	meta := sourceMetadata(r)
+	writers := make(map[int]Writer)
+	files := make(map[int]string)
+	closeAll := func() error {
+		var err error
+		for _, w := range writers {
+			err = errors.Join(err, w.Close())
+		}
+
+		return err
+	}
+
+	current := -1
+	err = forEntries(r, func(entry *Entry) error {
+		if sessionNum, ok := variableInt(entry.VariableData, "SessionNum"); ok {
+			current = sessionNum
+		}
+
+		if current < 0 {
+			// nothing to attach entries to before the first session
+			return nil
+		}
+
+		w, ok := writers[current]
+		if !ok {
+			name := fmt.Sprintf("%s-%d%s", base, current, ext)
+			if sessionType := sessionType(entry.YamlData, current); sessionType != "" {
+				name = fmt.Sprintf("%s-%d-%s%s", base, current, sessionType, ext)
+			}
+
+			// only files created here are recorded, an existing file that collides must survive the cleanup
+			fileName := filepath.Join(dir, name)
+			var err error
+			if w, err = NewWriterWithOptions(fileName, WriterOptions{Metadata: meta}); err != nil {
+				return err
+			}
+
+			writers[current] = w
+			files[current] = fileName
+		}
+
+		return w.WriteEntry(entry)
+	})
+
+	if err = errors.Join(err, closeAll()); err != nil {
+		for _, fileName := range files {
+			_ = os.Remove(fileName)
+		}
+
+		return nil, err
+	}
+
+	sessions := make([]int, 0, len(files))
+	for sessionNum := range files {
+		sessions = append(sessions, sessionNum)
+	}
+
+	slices.Sort(sessions)
+	result := make([]string, len(sessions))
+	for i, sessionNum := range sessions {
+		result[i] = files[sessionNum]
+	}
+
+	return result, nil
+}
+
+// Merge writes the entries of srcs to a new file dst, ordering the files by their first timestamp.
+// Entries that are not after the last entry written, where recordings overlap, are dropped.
+// dst takes the metadata of the first file and is removed when merging fails.
+func Merge(dst string, srcs ...string) error {
+	readers := make([]Reader, 0, len(srcs))
+	defer func() {
+		for _, r := range readers {
+			_ = r.Close()
+		}
+	}()
+
+	firsts := make(map[Reader]*Entry)
+	for _, src := range srcs {
+		r, err := NewReader(src)
+		if err != nil {
+			return err
+		}
+
+		readers = append(readers, r)
+		entry, err := r.ReadEntry()
+		if errors.Is(err, ErrEndOfFile) {
+			continue
+		}
+
+		if err != nil {
+			return fmt.Errorf("failed to read %s: %w", src, err)
+		}
+
+		firsts[r] = entry
+	}
+
+	ordered := slices.DeleteFunc(slices.Clone(readers), func(r Reader) bool {
+		return firsts[r] == nil
+	})
+
+	slices.SortStableFunc(ordered, func(a, b Reader) int {
+		return cmp.Compare(firsts[a].Timestamp, firsts[b].Timestamp)
+	})
+
+	opts := WriterOptions{}
+	if len(ordered) > 0 {
+		opts.Metadata = sourceMetadata(ordered[0])
+	}
+
+	return writeFile(dst, opts, func(w Writer) error {
+		last := int64(math.MinInt64)
+		write := func(entry *Entry) error {
+			if entry.Timestamp <= last {
+				return nil
+			}
+
+			last = entry.Timestamp
+			return w.WriteEntry(entry)
+		}
+
+		for _, r := range ordered {
+			if err := write(firsts[r]); err != nil {
+				return err
+			}
+
+			if err := forEntries(r, write); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+}
+
+// sourceMetadata returns a copy of the metadata of r to write to a derived file, or nil
+func sourceMetadata(r Reader) *Metadata {
+	m, ok := r.(interface{ Metadata() *Metadata })
+	if !ok || m.Metadata() == nil {
+		return nil
+	}
+
+	meta := *m.Metadata()
+	meta.LibraryVersion = ""
+	return &meta
+}
+
+// writeFile creates dst, calls fn to write its entries and closes it, dst is removed when any step fails
+func writeFile(dst string, opts WriterOptions, fn func(w Writer) error) error {
+	w, err := NewWriterWithOptions(dst, opts)
+	if err != nil {
+		return err
+	}
+
+	if err = errors.Join(fn(w), w.Close()); err != nil {
+		_ = os.Remove(dst)
+		return err
+	}
+
+	return nil
+}
+
+// forEntries calls fn with every remaining entry of r
+func forEntries(r Reader, fn func(entry *Entry) error) error {
+	for i := 0; ; i++ {
+		entry, err := r.ReadEntry()
+		if errors.Is(err, ErrEndOfFile) {
+			return nil
+		}
+
+		if err != nil {
+			return fmt.Errorf("failed to read entry %d: %w", i, err)
+		}
+
+		if err = fn(entry); err != nil {
+			return err
+		}
+	}
+}
+
+// variableInt returns the first value of the variable name in variable data as an int
+func variableInt(data string, name string) (int, bool) {
+	if schema, row, ok := DecodeRowData(data); ok {
+		columns, err := parseColumns(schema, len(row))
+		if err != nil {
+			return 0, false
+		}
+
+		i, ok := findColumn(columns, name)
+		if !ok {
+			return 0, false
+		}
+
+		return int(columns[i].value([]byte(row), 0)), true
+	}
+
+	if data == "" {
+		return 0, false
+	}
+
+	vd, err := base64.StdEncoding.DecodeString(data)
+	if err != nil {
+		return 0, false
+	}
+
+	var vars []struct {
+		Name   string
+		Values []any
+	}
+
+	if err = gob.NewDecoder(bytes.NewReader(vd)).Decode(&vars); err != nil {
+		return 0, false
+	}
+
+	for _, v := range vars {
+		if v.Name != name || len(v.Values) == 0 {
+			continue
+		}
+
+		switch n := v.Values[0].(type) {
+		case int:
+			return n, true
+		case int32:
+			return int(n), true
+		case uint32:
+			return int(n), true
+		}
+	}
+
+	return 0, false
+}
+
+// sessionType returns the lower case type of session sessionNum from session info YAML, e.g. "race"
+func sessionType(data string, sessionNum int) string {
+	var s inspectSessionInfo
+	if err := yaml.Unmarshal([]byte(data), &s); err != nil {
+		return ""
+	}
+
+	for _, session := range s.SessionInfo.Sessions {
+		if session.SessionNum == sessionNum {
+			// the type ends up in a file name, keep it to [a-z0-9-]
+			name := strings.Map(func(r rune) rune {
+				switch {
+				case r >= 'a' && r <= 'z', r >= '0' && r <= '9', r == '-':
+					return r
+				case r == ' ':
+					return '-'
+				default:
+					return -1
+				}
+			}, strings.ToLower(session.SessionType))
+			return strings.Trim(name, "-")
+		}
+	}
+
+	return ""
+}
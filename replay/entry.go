@@ -0,0 +1,198 @@
+package replay
+
+import (
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/hfoxy/iracing-sdk/buf"
+)
+
+// entry bitmap flags
+const (
+	bitYamlUpdated = iota
+	bitVariableUpdated
+	bitConnected
+	bitNotOk
+	bitRow           // the variable data is a raw row, see EncodeRowData
+	bitSchemaUpdated // the row is preceded by its variable headers
+	bitRowDelta      // the row is stored as a delta against the previous row
+)
+
+// entryEncoder writes entries, storing the YAML and variable data only when they changed. Raw rows
+// are stored as a delta against the previous row, with the variable headers only when they changed.
+type entryEncoder struct {
+	lastYamlData     string
+	lastVariableData string
+	lastSchema       string
+	lastRow          string
+	delta            []byte
+}
+
+// reset makes the next entry a keyframe holding the full YAML and variable data
+func (e *entryEncoder) reset() {
+	e.lastYamlData = ""
+	e.lastVariableData = ""
+	e.lastSchema = ""
+	e.lastRow = ""
+}
+
+func (e *entryEncoder) encode(w *buf.Buffer, entry *Entry) error {
+	yamlUpdated := e.lastYamlData != entry.YamlData
+	variableUpdated := e.lastVariableData != entry.VariableData
+
+	var bm buf.BitMap
+	bm[bitYamlUpdated] = yamlUpdated
+	bm[bitVariableUpdated] = variableUpdated
+	bm[bitConnected] = entry.Connected
+	bm[bitNotOk] = entry.NotOk
+
+	var schema, row string
+	if variableUpdated {
+		schema, row, bm[bitRow] = DecodeRowData(entry.VariableData)
+		bm[bitSchemaUpdated] = bm[bitRow] && schema != e.lastSchema
+		bm[bitRowDelta] = bm[bitRow] && !bm[bitSchemaUpdated] && len(row) == len(e.lastRow)
+	}
+
+	err := w.WriteVarLong(entry.Timestamp)
+	if err != nil {
+		return err
+	}
+
+	err = w.WriteBitMap(bm)
+	if err != nil {
+		return err
+	}
+
+	if yamlUpdated {
+		err = w.WriteString(entry.YamlData)
+		if err != nil {
+			return err
+		}
+	}
+
+	switch {
+	case bm[bitRow]:
+		if bm[bitSchemaUpdated] {
+			if err = w.WriteString(schema); err != nil {
+				return err
+			}
+		}
+
+		if bm[bitRowDelta] {
+			e.delta = appendRowDelta(e.delta[:0], e.lastRow, row)
+			err = w.WriteString(string(e.delta))
+		} else {
+			err = w.WriteString(row)
+		}
+
+		if err != nil {
+			return err
+		}
+
+		e.lastSchema = schema
+		e.lastRow = row
+	case variableUpdated:
+		err = w.WriteString(entry.VariableData)
+		if err != nil {
+			return err
+		}
+	}
+
+	e.lastYamlData = entry.YamlData
+	e.lastVariableData = entry.VariableData
+	return nil
+}
+
+// entryDecoder reads entries written by an entryEncoder
+type entryDecoder struct {
+	yamlData     string
+	variableData string
+	schema       string
+	row          string
+}
+
+func (d *entryDecoder) reset() {
+	d.yamlData = ""
+	d.variableData = ""
+	d.schema = ""
+	d.row = ""
+}
+
+func (d *entryDecoder) decode(r *buf.Buffer) (*Entry, error) {
+	entry := &Entry{}
+
+	var err error
+	entry.Timestamp, _, err = r.ReadVarLong()
+	if err != nil {
+		if errors.Is(err, io.EOF) {
+			return entry, ErrEndOfFile
+		}
+
+		return entry, fmt.Errorf("failed to read timestamp: %w", err)
+	}
+
+	bm, err := r.ReadBitMap()
+	if err != nil {
+		return entry, fmt.Errorf("failed to read bitmap: %w", err)
+	}
+
+	yamlUpdated := bm[bitYamlUpdated]
+	variableUpdated := bm[bitVariableUpdated]
+	entry.Connected = bm[bitConnected]
+	entry.NotOk = bm[bitNotOk]
+
+	if yamlUpdated {
+		entry.YamlData, err = r.ReadString()
+		if err != nil {
+			return entry, fmt.Errorf("failed to read yaml data: %w", err)
+		}
+
+		d.yamlData = entry.YamlData
+	} else {
+		entry.YamlData = d.yamlData
+	}
+
+	switch {
+	case bm[bitRow]:
+		if err = d.decodeRow(r, bm); err != nil {
+			return entry, err
+		}
+
+		d.variableData = EncodeRowData([]byte(d.schema), []byte(d.row))
+	case variableUpdated:
+		d.variableData, err = r.ReadString()
+		if err != nil {
+			return entry, fmt.Errorf("failed to read variable data: %w", err)
+		}
+	}
+
+	entry.VariableData = d.variableData
+
+	return entry, nil
+}
+
+func (d *entryDecoder) decodeRow(r *buf.Buffer, bm buf.BitMap) error {
+	var err error
+	if bm[bitSchemaUpdated] {
+		d.schema, err = r.ReadString()
+		if err != nil {
+			return fmt.Errorf("failed to read variable headers: %w", err)
+		}
+	}
+
+	row, err := r.ReadString()
+	if err != nil {
+		return fmt.Errorf("failed to read row: %w", err)
+	}
+
+	if bm[bitRowDelta] {
+		row, err = applyRowDelta(d.row, []byte(row))
+		if err != nil {
+			return err
+		}
+	}
+
+	d.row = row
+	return nil
+}
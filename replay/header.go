@@ -0,0 +1,243 @@
+package replay
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"runtime/debug"
+	"time"
+
+	"github.com/go-yaml/yaml"
+	"github.com/hfoxy/iracing-sdk/buf"
+)
+
+// FormatVersion is the version of the file format written by this package. Version 1 compresses the
+// entries as a single stream, version 2 as independent blocks starting with a keyframe and version 3
+// stores raw telemetry rows as deltas against the previous row, version 4 adds a checksum to every block.
+const FormatVersion = 4
+
+// magic starts every file with a header, files written before the header was introduced start
+// straight with their first entry
+var magic = []byte("\x89ITRPY\r\n")
+
+var ErrNoMetadata = errors.New("file has no metadata")
+
+// maxMetadataSize bounds the metadata read from a header, it is a few hundred bytes of JSON
+const maxMetadataSize = 1 << 20
+
+// Codec is the compression applied to the entries of a file
+type Codec uint8
+
+const (
+	CodecNone Codec = iota
+	CodecZstd
+	CodecGzip
+)
+
+func (c Codec) String() string {
+	switch c {
+	case CodecNone:
+		return "none"
+	case CodecZstd:
+		return "zstd"
+	case CodecGzip:
+		return "gzip"
+	default:
+		return fmt.Sprintf("Codec(%d)", uint8(c))
+	}
+}
+
+// codecForExtension returns the codec implied by a file extension
+func codecForExtension(ext string) (Codec, error) {
+	switch ext {
+	case ".itrpy":
+		return CodecNone, nil
+	case ".zsitrpy":
+		return CodecZstd, nil
+	case ".gzitrpy":
+		return CodecGzip, nil
+	default:
+		return 0, fmt.Errorf("unsupported file extension: %s", ext)
+	}
+}
+
+// Metadata describes a recording, it is stored uncompressed in the file header
+type Metadata struct {
+	FormatVersion int   `json:"-"`
+	Codec         Codec `json:"-"`
+
+	Created        time.Time `json:"created"`
+	LibraryVersion string    `json:"libraryVersion,omitempty"`
+
+	Track        string `json:"track,omitempty"`
+	Car          string `json:"car,omitempty"`
+	SubSessionID int    `json:"subSessionId,omitempty"`
+	Driver       string `json:"driver,omitempty"`
+}
+
+// libraryVersion returns the version of this module in the running binary
+func libraryVersion() string {
+	info, ok := debug.ReadBuildInfo()
+	if !ok {
+		return ""
+	}
+
+	const module = "github.com/hfoxy/iracing-sdk"
+	if info.Main.Path == module {
+		return info.Main.Version
+	}
+
+	for _, dep := range info.Deps {
+		if dep.Path == module {
+			return dep.Version
+		}
+	}
+
+	return ""
+}
+
+// sessionInfo holds the parts of the session info YAML copied into Metadata
+type sessionInfo struct {
+	WeekendInfo struct {
+		TrackDisplayName string `yaml:"TrackDisplayName"`
+		TrackName        string `yaml:"TrackName"`
+		SubSessionID     int    `yaml:"SubSessionID"`
+	} `yaml:"WeekendInfo"`
+	DriverInfo struct {
+		DriverCarIdx int `yaml:"DriverCarIdx"`
+		Drivers      []struct {
+			CarIdx        int    `yaml:"CarIdx"`
+			UserName      string `yaml:"UserName"`
+			CarScreenName string `yaml:"CarScreenName"`
+		} `yaml:"Drivers"`
+	} `yaml:"DriverInfo"`
+}
+
+// FromSessionInfo fills the session metadata of m from session info YAML, fields the YAML does not
+// provide are left untouched
+func (m *Metadata) FromSessionInfo(data string) error {
+	var s sessionInfo
+	if err := yaml.Unmarshal([]byte(data), &s); err != nil {
+		return fmt.Errorf("failed to parse session info: %w", err)
+	}
+
+	if s.WeekendInfo.TrackDisplayName != "" {
+		m.Track = s.WeekendInfo.TrackDisplayName
+	} else if s.WeekendInfo.TrackName != "" {
+		m.Track = s.WeekendInfo.TrackName
+	}
+
+	if s.WeekendInfo.SubSessionID != 0 {
+		m.SubSessionID = s.WeekendInfo.SubSessionID
+	}
+
+	for _, d := range s.DriverInfo.Drivers {
+		if d.CarIdx == s.DriverInfo.DriverCarIdx {
+			m.Driver = d.UserName
+			m.Car = d.CarScreenName
+			break
+		}
+	}
+
+	return nil
+}
+
+// writeHeader writes the file header and returns its size, it is never compressed
+func writeHeader(w io.Writer, codec Codec, meta *Metadata) (int64, error) {
+	data, err := json.Marshal(meta)
+	if err != nil {
+		return 0, fmt.Errorf("failed to encode metadata: %w", err)
+	}
+
+	var b bytes.Buffer
+	b.Write(magic)
+	b.WriteByte(FormatVersion)
+	b.WriteByte(byte(codec))
+	if err = buf.NewWriter(&b).WriteString(string(data)); err != nil {
+		return 0, err
+	}
+
+	if _, err = w.Write(b.Bytes()); err != nil {
+		return 0, fmt.Errorf("failed to write header: %w", err)
+	}
+
+	return int64(b.Len()), nil
+}
+
+// readHeader reads the file header, returning ErrNoMetadata for files without one. It also returns
+// the size of the header and a reader continuing after it, or at the start of the file when there
+// is no header.
+func readHeader(r io.Reader) (*Metadata, int64, *bufio.Reader, error) {
+	br := bufio.NewReader(r)
+	start, err := br.Peek(len(magic))
+	if err != nil && !errors.Is(err, io.EOF) {
+		return nil, 0, br, fmt.Errorf("failed to read header: %w", err)
+	}
+
+	if !bytes.Equal(start, magic) {
+		return nil, 0, br, ErrNoMetadata
+	}
+
+	if _, err = br.Discard(len(magic)); err != nil {
+		return nil, 0, br, err
+	}
+
+	version, err := br.ReadByte()
+	if err != nil {
+		return nil, 0, br, fmt.Errorf("failed to read format version: %w", err)
+	}
+
+	if version < 1 || version > FormatVersion {
+		return nil, 0, br, fmt.Errorf("unsupported format version %d", version)
+	}
+
+	codec, err := br.ReadByte()
+	if err != nil {
+		return nil, 0, br, fmt.Errorf("failed to read codec: %w", err)
+	}
+
+	length, n, err := buf.NewReader(br, nil).ReadVarInt()
+	if err != nil {
+		return nil, 0, br, fmt.Errorf("failed to read metadata: %w", err)
+	}
+
+	if length < 0 || length > maxMetadataSize {
+		return nil, 0, br, fmt.Errorf("invalid metadata length %d", length)
+	}
+
+	data, err := io.ReadAll(io.LimitReader(br, int64(length)))
+	if err == nil && len(data) < int(length) {
+		err = io.ErrUnexpectedEOF
+	}
+
+	if err != nil {
+		return nil, 0, br, fmt.Errorf("failed to read metadata: %w", err)
+	}
+
+	meta := &Metadata{}
+	if err = json.Unmarshal(data, meta); err != nil {
+		return nil, 0, br, fmt.Errorf("failed to decode metadata: %w", err)
+	}
+
+	meta.FormatVersion = int(version)
+	meta.Codec = Codec(codec)
+	return meta, int64(len(magic) + 2 + n + len(data)), br, nil
+}
+
+// ReadMetadata reads the metadata of a recording without decoding its entries.
+// Files written before metadata was introduced return ErrNoMetadata.
+func ReadMetadata(fileName string) (*Metadata, error) {
+	f, err := os.Open(fileName)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open file: %w", err)
+	}
+
+	defer f.Close()
+
+	meta, _, _, err := readHeader(f)
+	return meta, err
+}
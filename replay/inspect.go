@@ -0,0 +1,221 @@
+package replay
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/gob"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"slices"
+	"time"
+
+	"github.com/go-yaml/yaml"
+)
+
+// Span is a run of consecutive entries with the same connection state
+type Span struct {
+	Start   int64 // timestamp of the first entry
+	End     int64 // timestamp of the last entry
+	Entries int
+}
+
+func (s Span) Duration() time.Duration {
+	return time.Duration(s.End-s.Start) * time.Millisecond
+}
+
+// SessionSummary is a session listed in the session info of a recording
+type SessionSummary struct {
+	SubSessionID int
+	SessionNum   int
+	SessionType  string
+	SessionName  string
+}
+
+// Inspection summarises a recording, see Inspect
+type Inspection struct {
+	Metadata *Metadata // nil for files without a header
+
+	Entries        int
+	FirstTimestamp int64
+	LastTimestamp  int64
+	Duration       time.Duration
+	EntryRate      float64 // entries per second
+
+	YamlRevisions int // distinct session info strings in a row, including the first
+	SchemaChanges int // times the variable layout changed after the first layout
+	NotOk         int
+
+	ConnectedSpans    []Span
+	DisconnectedSpans []Span
+	Sessions          []SessionSummary
+
+	Size             int64 // size of the file
+	ReadSize         int64 // bytes read from the file, as reported by the reader
+	UncompressedSize int64 // size of the timestamps, YAML and variable data stored, before compression
+}
+
+// CompressionRatio returns the uncompressed size divided by the file size
+func (i *Inspection) CompressionRatio() float64 {
+	if i.Size == 0 {
+		return 0
+	}
+
+	return float64(i.UncompressedSize) / float64(i.Size)
+}
+
+// inspectSessionInfo holds the parts of the session info YAML listed by Inspect
+type inspectSessionInfo struct {
+	WeekendInfo struct {
+		SubSessionID int `yaml:"SubSessionID"`
+	} `yaml:"WeekendInfo"`
+	SessionInfo struct {
+		Sessions []struct {
+			SessionNum  int    `yaml:"SessionNum"`
+			SessionType string `yaml:"SessionType"`
+			SessionName string `yaml:"SessionName"`
+		} `yaml:"Sessions"`
+	} `yaml:"SessionInfo"`
+}
+
+// Inspect reads every entry of a recording and summarises it without decoding the variables
+func Inspect(fileName string) (*Inspection, error) {
+	r, err := NewReader(fileName)
+	if err != nil {
+		return nil, err
+	}
+
+	defer r.Close()
+
+	info := &Inspection{}
+	if m, ok := r.(interface{ Metadata() *Metadata }); ok {
+		info.Metadata = m.Metadata()
+	}
+
+	var lastYaml, lastVariableData string
+	var lastSchema uint64
+	var spans *[]Span // spans of the current connection state
+	for {
+		entry, err := r.ReadEntry()
+		if errors.Is(err, ErrEndOfFile) {
+			break
+		}
+
+		if err != nil {
+			return nil, fmt.Errorf("failed to read entry %d: %w", info.Entries, err)
+		}
+
+		if info.Entries == 0 {
+			info.FirstTimestamp = entry.Timestamp
+		}
+
+		info.Entries++
+		info.LastTimestamp = entry.Timestamp
+		info.UncompressedSize += 8
+		if entry.NotOk {
+			info.NotOk++
+		}
+
+		current := &info.DisconnectedSpans
+		if entry.Connected {
+			current = &info.ConnectedSpans
+		}
+
+		if current != spans {
+			spans = current
+			*spans = append(*spans, Span{Start: entry.Timestamp})
+		}
+
+		span := &(*spans)[len(*spans)-1]
+		span.End = entry.Timestamp
+		span.Entries++
+
+		if entry.YamlData != lastYaml {
+			lastYaml = entry.YamlData
+			info.UncompressedSize += int64(len(entry.YamlData))
+			if entry.YamlData != "" {
+				info.YamlRevisions++
+				info.addSessions(entry.YamlData)
+			}
+		}
+
+		if entry.VariableData != lastVariableData {
+			lastVariableData = entry.VariableData
+			info.UncompressedSize += int64(len(entry.VariableData))
+			if schema, ok := schemaHash(entry.VariableData); ok {
+				if lastSchema != 0 && schema != lastSchema {
+					info.SchemaChanges++
+				}
+
+				lastSchema = schema
+			}
+		}
+	}
+
+	info.Duration = time.Duration(info.LastTimestamp-info.FirstTimestamp) * time.Millisecond
+	if info.Duration > 0 {
+		info.EntryRate = float64(info.Entries-1) / info.Duration.Seconds()
+	}
+
+	info.Size = r.Size()
+	info.ReadSize = r.ReadSize()
+	return info, nil
+}
+
+// addSessions adds the sessions of a session info not seen before, YAML that fails to parse is ignored
+func (i *Inspection) addSessions(data string) {
+	var s inspectSessionInfo
+	if err := yaml.Unmarshal([]byte(data), &s); err != nil {
+		return
+	}
+
+	for _, session := range s.SessionInfo.Sessions {
+		summary := SessionSummary{
+			SubSessionID: s.WeekendInfo.SubSessionID,
+			SessionNum:   session.SessionNum,
+			SessionType:  session.SessionType,
+			SessionName:  session.SessionName,
+		}
+
+		if !slices.Contains(i.Sessions, summary) {
+			i.Sessions = append(i.Sessions, summary)
+		}
+	}
+}
+
+// gobVariable holds the fields of an irsdk.Variable that make up the layout
+type gobVariable struct {
+	VarType uint8
+	Offset  int
+	Count   int
+	Name    string
+}
+
+// schemaHash returns a hash of the variable layout of variable data, ok is false when there are no variables
+func schemaHash(data string) (uint64, bool) {
+	h := fnv.New64a()
+	if schema, _, ok := DecodeRowData(data); ok {
+		_, _ = h.Write([]byte(schema))
+		return h.Sum64(), true
+	}
+
+	if data == "" {
+		return 0, false
+	}
+
+	vd, err := base64.StdEncoding.DecodeString(data)
+	if err != nil {
+		return 0, false
+	}
+
+	var vars []gobVariable
+	if err = gob.NewDecoder(bytes.NewReader(vd)).Decode(&vars); err != nil || len(vars) == 0 {
+		return 0, false
+	}
+
+	for _, v := range vars {
+		_, _ = fmt.Fprintf(h, "%d/%d/%d/%s\x00", v.VarType, v.Offset, v.Count, v.Name)
+	}
+
+	return h.Sum64(), true
+}
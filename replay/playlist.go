@@ -0,0 +1,207 @@
+package replay
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+)
+
+// joinInterval separates the last entry of a recording from the first entry of the next one
+const joinInterval = time.Second / 60
+
+// PlaylistOptions configures a Playlist
+type PlaylistOptions struct {
+	// Gap is the time the stream is disconnected between two recordings. Zero joins the recordings
+	// back to back.
+	Gap time.Duration
+
+	// Open opens a single recording, defaults to NewReader
+	Open func(fileName string) (Reader, error)
+
+	// OnFile is called when the playlist starts reading a recording
+	OnFile func(index int, fileName string)
+}
+
+// Playlist reads several recordings in order as one continuous stream of entries. Every recording
+// is shifted in time so it starts right after the previous one ended, or Gap later with a
+// disconnected entry in between.
+type Playlist struct {
+	fileNames []string
+	opts      PlaylistOptions
+	sizes     []int64
+
+	index   int // recording being read
+	current Reader
+	first   bool  // the next entry read is the first of the current recording
+	offset  int64 // milliseconds added to the timestamps of the current recording
+	last    int64 // timestamp of the last entry returned
+	started bool  // an entry has been returned
+	done    int64 // bytes of the recordings read completely
+	pending *Entry
+}
+
+// NewPlaylist creates a Playlist of fileNames, the recordings are only opened once they are reached
+func NewPlaylist(fileNames []string, opts PlaylistOptions) (*Playlist, error) {
+	if len(fileNames) == 0 {
+		return nil, errors.New("playlist is empty")
+	}
+
+	if opts.Open == nil {
+		opts.Open = NewReader
+	}
+
+	p := &Playlist{
+		fileNames: slices.Clone(fileNames),
+		opts:      opts,
+		sizes:     make([]int64, len(fileNames)),
+	}
+
+	for i, fileName := range fileNames {
+		info, err := os.Stat(fileName)
+		if err != nil {
+			return nil, fmt.Errorf("failed to stat recording: %w", err)
+		}
+
+		p.sizes[i] = info.Size()
+	}
+
+	return p, nil
+}
+
+// Glob expands patterns into a list of recordings, the matches of every pattern are sorted by name.
+// Patterns without glob characters are kept as they are.
+func Glob(patterns ...string) ([]string, error) {
+	fileNames := make([]string, 0, len(patterns))
+	for _, pattern := range patterns {
+		if !strings.ContainsAny(pattern, `*?[`) {
+			// a missing file is reported by NewPlaylist, not as an empty match
+			fileNames = append(fileNames, pattern)
+			continue
+		}
+
+		matches, err := filepath.Glob(pattern)
+		if err != nil {
+			return nil, fmt.Errorf("invalid pattern %q: %w", pattern, err)
+		}
+
+		if len(matches) == 0 {
+			return nil, fmt.Errorf("no recordings match %q", pattern)
+		}
+
+		slices.Sort(matches)
+		fileNames = append(fileNames, matches...)
+	}
+
+	return fileNames, nil
+}
+
+// Current returns the index and name of the recording being read
+func (p *Playlist) Current() (int, string) {
+	index := min(p.index, len(p.fileNames)-1)
+	return index, p.fileNames[index]
+}
+
+func (p *Playlist) ReadEntry() (*Entry, error) {
+	for {
+		if p.pending != nil {
+			entry := p.pending
+			p.pending = nil
+			p.last = entry.Timestamp
+			return entry, nil
+		}
+
+		if p.current == nil {
+			if p.index >= len(p.fileNames) {
+				return &Entry{}, ErrEndOfFile
+			}
+
+			r, err := p.opts.Open(p.fileNames[p.index])
+			if err != nil {
+				return nil, fmt.Errorf("failed to open recording %s: %w", p.fileNames[p.index], err)
+			}
+
+			p.current = r
+			p.first = true
+			if p.opts.OnFile != nil {
+				p.opts.OnFile(p.index, p.fileNames[p.index])
+			}
+		}
+
+		entry, err := p.current.ReadEntry()
+		if errors.Is(err, ErrEndOfFile) {
+			if err = p.next(); err != nil {
+				return nil, err
+			}
+
+			continue
+		}
+
+		if err != nil {
+			return entry, fmt.Errorf("failed to read recording %s: %w", p.fileNames[p.index], err)
+		}
+
+		if p.first {
+			p.first = false
+			if p.started {
+				p.offset = p.last + max(p.opts.Gap, joinInterval).Milliseconds() - entry.Timestamp
+				if p.opts.Gap > joinInterval {
+					entry.Timestamp += p.offset
+					p.pending = entry
+
+					entry = &Entry{Timestamp: p.last + joinInterval.Milliseconds()}
+					p.last = entry.Timestamp
+					return entry, nil
+				}
+			}
+		}
+
+		entry.Timestamp += p.offset
+		p.last = entry.Timestamp
+		p.started = true
+		return entry, nil
+	}
+}
+
+// next closes the current recording and moves on to the next one
+func (p *Playlist) next() error {
+	err := p.current.Close()
+	p.current = nil
+	p.done += p.sizes[p.index]
+	p.index++
+	if err != nil {
+		return fmt.Errorf("failed to close recording: %w", err)
+	}
+
+	return nil
+}
+
+func (p *Playlist) ReadSize() int64 {
+	if p.current == nil {
+		return p.done
+	}
+
+	return p.done + p.current.ReadSize()
+}
+
+func (p *Playlist) Size() int64 {
+	var size int64
+	for _, s := range p.sizes {
+		size += s
+	}
+
+	return size
+}
+
+func (p *Playlist) Close() error {
+	if p.current == nil {
+		return nil
+	}
+
+	err := p.current.Close()
+	p.current = nil
+	return err
+}
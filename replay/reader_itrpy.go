@@ -1,6 +1,7 @@
 package replay
 
 import (
+	"bufio"
 	"compress/gzip"
 	"errors"
 	"fmt"
@@ -16,9 +17,8 @@ type TelemetryReplayReader struct {
 	fileSize  int64
 	closeFunc func() error
 	reader    *buf2.Buffer
-
-	yamlData     string
-	variableData string
+	metadata  *Metadata
+	decoder   entryDecoder
 }
 
 func NewTelemetryReplayReader(fileName string, fileSize int64) (Reader, error) {
@@ -31,62 +31,120 @@ func NewTelemetryReplayReader(fileName string, fileSize int64) (Reader, error) {
 		return nil, fmt.Errorf("failed to open file: %s", fileName)
 	}
 
-	var closeFunc func() error
+	r, err := openReader(f, f, fileSize, f, func(*bufio.Reader) (Codec, error) {
+		// files without a header are identified by their extension
+		return codecForExtension(filepath.Ext(fileName))
+	})
+	if err != nil {
+		_ = f.Close()
+		return nil, err
+	}
+
+	if s, ok := r.(*TelemetryReplayReader); ok {
+		s.fileName = fileName
+	}
 
-	var r io.Reader
-	r = f
+	return r, nil
+}
 
+// newStreamReader reads a recording from r, files without a header are identified by their first bytes
+func newStreamReader(r io.Reader) (Reader, error) {
+	closer, _ := r.(io.Closer)
+	ra, size, ok := readerAt(r)
+	if ok {
+		return openReader(io.NewSectionReader(ra, 0, size), ra, size, closer, sniffCodec)
+	}
+
+	return openReader(r, nil, -1, closer, sniffCodec)
+}
+
+// openReader reads a recording from r. at reads the same data at offsets, it is nil for streams that
+// are read forward only and whose size is negative. legacy returns the codec of files without a header,
+// it is given a reader at their start. closer is called by Close and may be nil.
+func openReader(r io.Reader, at io.ReaderAt, size int64, closer io.Closer, legacy func(*bufio.Reader) (Codec, error)) (Reader, error) {
 	cr := &buf2.CountingReader{
 		Reader: r,
 	}
 
-	r = cr
+	meta, headerSize, br, err := readHeader(cr)
+	codec := CodecNone
+	switch {
+	case err == nil && meta.FormatVersion >= 2:
+		if at == nil {
+			at = &streamSource{r: br, base: headerSize}
+		}
 
-	ext := filepath.Ext(fileName)
-	switch ext {
-	case ".itrpy":
-		closeFunc = f.Close
-	case ".zsitrpy":
-		var dec *zstd.Decoder
-		dec, err = zstd.NewReader(r)
+		return newBlockReader(at, closer, size, meta, headerSize)
+	case err == nil:
+		codec = meta.Codec
+	case errors.Is(err, ErrNoMetadata):
+		meta = nil
+		if codec, err = legacy(br); err != nil {
+			return nil, err
+		}
+	default:
+		return nil, err
+	}
+
+	var entries io.Reader = br
+	closeFunc := func() error {
+		if closer == nil {
+			return nil
+		}
+
+		return closer.Close()
+	}
+
+	switch codec {
+	case CodecNone:
+	case CodecZstd:
+		dec, err := zstd.NewReader(br)
 		if err != nil {
 			return nil, fmt.Errorf("failed to create zstd decoder: %w", err)
 		}
 
-		r = dec
+		entries = dec
+		closeFile := closeFunc
 		closeFunc = func() error {
 			dec.Close()
-			return f.Close()
+			return closeFile()
 		}
-	case ".gzitrpy":
-		var dec *gzip.Reader
-		dec, err = gzip.NewReader(r)
+	case CodecGzip:
+		dec, err := gzip.NewReader(br)
 		if err != nil {
 			return nil, fmt.Errorf("failed to create gzip decoder: %w", err)
 		}
 
-		r = dec
+		entries = dec
+		closeFile := closeFunc
 		closeFunc = func() error {
-			if err = dec.Close(); err != nil {
+			if err := dec.Close(); err != nil {
 				return err
 			}
 
-			return f.Close()
+			return closeFile()
 		}
 	default:
-		return nil, fmt.Errorf("unsupported file extension: %s", ext)
+		return nil, fmt.Errorf("unsupported codec: %s", codec)
 	}
 
-	buffer := buf2.NewReader(r, &cr.BytesRead)
+	if size < 0 {
+		size = 0
+	}
 
 	return &TelemetryReplayReader{
-		fileName:  fileName,
-		fileSize:  fileSize,
+		fileSize:  size,
 		closeFunc: closeFunc,
-		reader:    buffer,
+		reader:    buf2.NewReader(entries, &cr.BytesRead),
+		metadata:  meta,
 	}, nil
 }
 
+// Metadata returns the metadata from the file header, or nil for files without a header
+func (s *TelemetryReplayReader) Metadata() *Metadata {
+	return s.metadata
+}
+
 func (s *TelemetryReplayReader) ReadSize() int64 {
 	return s.reader.ReadCount()
 }
@@ -96,51 +154,7 @@ func (s *TelemetryReplayReader) Size() int64 {
 }
 
 func (s *TelemetryReplayReader) ReadEntry() (*Entry, error) {
-	entry := &Entry{}
-
-	var err error
-	entry.Timestamp, _, err = s.reader.ReadVarLong()
-	if err != nil {
-		if errors.Is(err, io.EOF) {
-			return entry, ErrEndOfFile
-		}
-
-		return entry, fmt.Errorf("failed to read timestamp: %w", err)
-	}
-
-	bm, err := s.reader.ReadBitMap()
-	if err != nil {
-		return entry, fmt.Errorf("failed to read bitmap: %w", err)
-	}
-
-	yamlUpdated := bm[0]
-	variableUpdated := bm[1]
-	entry.Connected = bm[2]
-	entry.NotOk = bm[3]
-
-	if yamlUpdated {
-		entry.YamlData, err = s.reader.ReadString()
-		if err != nil {
-			return entry, fmt.Errorf("failed to read yaml data: %w", err)
-		}
-
-		s.yamlData = entry.YamlData
-	} else {
-		entry.YamlData = s.yamlData
-	}
-
-	if variableUpdated {
-		entry.VariableData, err = s.reader.ReadString()
-		if err != nil {
-			return entry, fmt.Errorf("failed to read variable data: %w", err)
-		}
-
-		s.variableData = entry.VariableData
-	} else {
-		entry.VariableData = s.variableData
-	}
-
-	return entry, nil
+	return s.decoder.decode(s.reader)
 }
 
 func (s *TelemetryReplayReader) Close() error {
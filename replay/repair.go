@@ -0,0 +1,82 @@
+package replay
+
+import (
+	"errors"
+)
+
+// TolerantReader ends a recording at the first entry that fails to decode instead of returning the
+// error, recovering every complete entry of a truncated or unclosed file
+type TolerantReader struct {
+	Reader
+	err error
+}
+
+// NewTolerantReader opens a recording like NewReader, reading stops quietly at the first corrupt entry
+func NewTolerantReader(fileName string) (*TolerantReader, error) {
+	r, err := NewReader(fileName)
+	if err != nil {
+		return nil, err
+	}
+
+	return &TolerantReader{Reader: r}, nil
+}
+
+func (r *TolerantReader) ReadEntry() (*Entry, error) {
+	if r.err != nil {
+		return &Entry{}, ErrEndOfFile
+	}
+
+	entry, err := r.Reader.ReadEntry()
+	if err != nil && !errors.Is(err, ErrEndOfFile) {
+		r.err = err
+		return &Entry{}, ErrEndOfFile
+	}
+
+	return entry, err
+}
+
+// Err returns the error that ended the recording early, or nil when it was read to the end
+func (r *TolerantReader) Err() error {
+	return r.err
+}
+
+// Metadata returns the metadata of the file, or nil for files without a header
+func (r *TolerantReader) Metadata() *Metadata {
+	if m, ok := r.Reader.(interface{ Metadata() *Metadata }); ok {
+		return m.Metadata()
+	}
+
+	return nil
+}
+
+// RepairResult describes a recording recovered by Repair
+type RepairResult struct {
+	Entries int   // entries written to the repaired file
+	Cause   error // error that ended the source early, nil when it was read to the end
+}
+
+// Repair writes every complete entry of src, a truncated or unclosed recording, to a new file dst with a
+// complete index
+func Repair(src string, dst string) (*RepairResult, error) {
+	r, err := NewTolerantReader(src)
+	if err != nil {
+		return nil, err
+	}
+
+	defer r.Close()
+
+	result := &RepairResult{}
+	err = writeFile(dst, WriterOptions{Metadata: sourceMetadata(r)}, func(w Writer) error {
+		return forEntries(r, func(entry *Entry) error {
+			result.Entries++
+			return w.WriteEntry(entry)
+		})
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	result.Cause = r.Err()
+	return result, nil
+}
@@ -2,6 +2,7 @@ package replay
 
 import (
 	"fmt"
+	"io"
 	"os"
 	"path/filepath"
 )
@@ -45,11 +46,63 @@ func NewReader(fileName string) (Reader, error) {
 		return NewTelemetryReplayReader(fileName, fileSize)
 	case ".gzitrpy":
 		return NewTelemetryReplayReader(fileName, fileSize)
+	default:
+		// files with a header identify themselves, whatever their extension
+		if _, err = ReadMetadata(fileName); err == nil {
+			return NewTelemetryReplayReader(fileName, fileSize)
+		}
+
+		return nil, fmt.Errorf("unsupported file extension: %s", ext)
+	}
+}
+
+// NewStreamReader reads a recording from r, such as a network connection, an HTTP body or stdin. The
+// format is taken from the file header or, for files without one, from the zstd or gzip magic bytes.
+// Readers that can read at offsets and report their size, like bytes.Reader and regular files, can
+// seek and read channels, other streams are read forward only and return ErrNotSeekable. r is closed
+// by Close when it is an io.Closer.
+func NewStreamReader(r io.Reader) (Reader, error) {
+	return newStreamReader(r)
+}
+
+// NewWriterWithMetadata creates a writer storing meta in the file header instead of taking the
+// metadata from the session info of the first entry
+func NewWriterWithMetadata(fileName string, meta Metadata) (Writer, error) {
+	switch ext := filepath.Ext(fileName); ext {
+	case ".itrpy", ".zsitrpy", ".gzitrpy":
+		return NewTelemetryReplayWriterWithMetadata(fileName, meta)
+	default:
+		return nil, fmt.Errorf("unsupported file extension: %s", ext)
+	}
+}
+
+// NewColumnarWriter creates a writer storing raw rows one column per variable, for files that are
+// mostly read a channel at a time with ReadChannel
+func NewColumnarWriter(fileName string) (Writer, error) {
+	switch ext := filepath.Ext(fileName); ext {
+	case ".itrpy", ".zsitrpy", ".gzitrpy":
+		return NewTelemetryReplayWriterWithOptions(fileName, WriterOptions{Columnar: true})
+	default:
+		return nil, fmt.Errorf("unsupported file extension: %s", ext)
+	}
+}
+
+// NewWriterWithOptions creates a writer configured by opts
+func NewWriterWithOptions(fileName string, opts WriterOptions) (Writer, error) {
+	switch ext := filepath.Ext(fileName); ext {
+	case ".itrpy", ".zsitrpy", ".gzitrpy":
+		return NewTelemetryReplayWriterWithOptions(fileName, opts)
 	default:
 		return nil, fmt.Errorf("unsupported file extension: %s", ext)
 	}
 }
 
+// NewStreamWriter writes a recording to w, such as a network connection or stdout, compressed with
+// opts.Codec. The index is written by Close, w is closed by Close when it is an io.Closer.
+func NewStreamWriter(w io.Writer, opts WriterOptions) (Writer, error) {
+	return newStreamWriter(w, opts)
+}
+
 func NewWriter(fileName string) (Writer, error) {
 	ext := filepath.Ext(fileName)
 	switch ext {
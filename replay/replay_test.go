@@ -0,0 +1,1404 @@
+package replay
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"path/filepath"
+	"reflect"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/hfoxy/iracing-sdk/buf"
+	"github.com/klauspost/compress/zstd"
+)
+
+const testYaml = `---
+WeekendInfo:
+ TrackName: spa
+ TrackDisplayName: Circuit de Spa-Francorchamps
+ SubSessionID: 12345
+DriverInfo:
+ DriverCarIdx: 1
+ Drivers:
+ - CarIdx: 0
+   UserName: Pace Car
+   CarScreenName: Safety Car
+ - CarIdx: 1
+   UserName: Alice Smith
+   CarScreenName: Porsche 911 GT3 R
+...
+`
+
+func writeEntries(t *testing.T, w Writer, n int) {
+	t.Helper()
+
+	for i := 0; i < n; i++ {
+		err := w.WriteEntry(&Entry{Timestamp: int64(1000 + i), Connected: true, YamlData: testYaml, VariableData: "vars"})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func readEntries(t *testing.T, fileName string) []*Entry {
+	t.Helper()
+
+	r, err := NewReader(fileName)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return readAll(t, r)
+}
+
+func readAll(t *testing.T, r Reader) []*Entry {
+	t.Helper()
+
+	defer r.Close()
+
+	entries := make([]*Entry, 0)
+	for {
+		entry, err := r.ReadEntry()
+		if errors.Is(err, ErrEndOfFile) {
+			return entries
+		}
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		entries = append(entries, entry)
+	}
+}
+
+func TestMetadata(t *testing.T) {
+	fileName := filepath.Join(t.TempDir(), "test.zsitrpy")
+	w, err := NewWriter(fileName)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	writeEntries(t, w, 3)
+
+	meta, err := ReadMetadata(fileName)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if meta.FormatVersion != FormatVersion || meta.Codec != CodecZstd || meta.Created.IsZero() {
+		t.Errorf("unexpected header %+v", meta)
+	}
+
+	if meta.Track != "Circuit de Spa-Francorchamps" || meta.SubSessionID != 12345 ||
+		meta.Driver != "Alice Smith" || meta.Car != "Porsche 911 GT3 R" {
+		t.Errorf("unexpected session metadata %+v", meta)
+	}
+
+	if entries := readEntries(t, fileName); len(entries) != 3 || entries[2].Timestamp != 1002 || entries[2].YamlData != testYaml {
+		t.Errorf("unexpected entries %+v", entries)
+	}
+
+	// the header identifies the file whatever its extension
+	renamed := filepath.Join(t.TempDir(), "test.bin")
+	if err = os.Rename(fileName, renamed); err != nil {
+		t.Fatal(err)
+	}
+
+	if entries := readEntries(t, renamed); len(entries) != 3 {
+		t.Errorf("expected 3 entries, got %d", len(entries))
+	}
+}
+
+func TestMetadataExplicit(t *testing.T) {
+	fileName := filepath.Join(t.TempDir(), "test.gzitrpy")
+	w, err := NewWriterWithMetadata(fileName, Metadata{Track: "Monza", SubSessionID: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	writeEntries(t, w, 1)
+
+	meta, err := ReadMetadata(fileName)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if meta.Codec != CodecGzip || meta.Track != "Monza" || meta.SubSessionID != 1 || meta.Driver != "" {
+		t.Errorf("unexpected metadata %+v", meta)
+	}
+}
+
+func TestMetadataLength(t *testing.T) {
+	for _, length := range [][]byte{{0xff, 0xff, 0xff, 0xff, 0x0f}, {0x80, 0x80, 0x80, 0x10}, {0x10}} {
+		header := append(append([]byte(nil), magic...), FormatVersion, byte(CodecNone))
+		header = append(header, length...)
+		if _, err := NewStreamReader(bytes.NewReader(header)); err == nil {
+			t.Errorf("expected an error for metadata length % x", length)
+		}
+	}
+}
+
+func TestLegacyFile(t *testing.T) {
+	fileName := filepath.Join(t.TempDir(), "legacy.zsitrpy")
+	f, err := os.Create(fileName)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	enc, err := zstd.NewWriter(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	b := buf.NewWriter(enc)
+	for _, err = range []error{
+		b.WriteVarLong(1000),
+		b.WriteBitMap(buf.BitMap{true, true, true, false}),
+		b.WriteString(testYaml),
+		b.WriteString("vars"),
+	} {
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err = enc.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	if err = f.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err = ReadMetadata(fileName); !errors.Is(err, ErrNoMetadata) {
+		t.Errorf("expected no metadata, got %v", err)
+	}
+
+	entries := readEntries(t, fileName)
+	if len(entries) != 1 || entries[0].Timestamp != 1000 || !entries[0].Connected || entries[0].VariableData != "vars" {
+		t.Errorf("unexpected entries %+v", entries)
+	}
+}
+
+func TestSeek(t *testing.T) {
+	for _, ext := range []string{".itrpy", ".gzitrpy", ".zsitrpy"} {
+		t.Run(ext, func(t *testing.T) {
+			fileName := filepath.Join(t.TempDir(), "test"+ext)
+			w, err := newTelemetryReplayWriter(fileName, WriterOptions{})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			w.KeyframeInterval = 10
+			for i := 0; i < 95; i++ {
+				yaml := testYaml
+				if i >= 50 {
+					yaml += "# second revision\n"
+				}
+
+				err = w.WriteEntry(&Entry{Timestamp: int64(1000 + i*10), Connected: true, YamlData: yaml, VariableData: fmt.Sprintf("vars %d", i/3)})
+				if err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			if err = w.Close(); err != nil {
+				t.Fatal(err)
+			}
+
+			if entries := readEntries(t, fileName); len(entries) != 95 {
+				t.Fatalf("expected 95 entries, got %d", len(entries))
+			}
+
+			r, err := NewReader(fileName)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			defer r.Close()
+
+			br := r.(*BlockReader)
+			index, err := br.Index()
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if len(index) != 10 || index[3].FirstTimestamp != 1300 || index[9].Entries != 5 {
+				t.Fatalf("unexpected index %+v", index)
+			}
+
+			// a seek lands on the last entry at or before the timestamp, forward then backward
+			for _, ts := range []int64{1555, 1550, 1305, 0, 1940, 5000} {
+				if err = br.SeekTimestamp(ts); err != nil {
+					t.Fatal(err)
+				}
+
+				entry, err := br.ReadEntry()
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				i := min(max((ts-1000)/10, 0), 94)
+				if entry.Timestamp != 1000+i*10 || entry.VariableData != fmt.Sprintf("vars %d", i/3) || (i >= 50) != strings.HasSuffix(entry.YamlData, "revision\n") {
+					t.Errorf("seek to %d returned %+v", ts, entry)
+				}
+
+				if ts >= 1940 {
+					continue
+				}
+
+				// reading continues across the block boundary
+				next, err := br.ReadEntry()
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				if next.Timestamp != entry.Timestamp+10 {
+					t.Errorf("expected entry %d after seeking to %d, got %d", entry.Timestamp+10, ts, next.Timestamp)
+				}
+			}
+		})
+	}
+}
+
+func TestSeekWithoutIndex(t *testing.T) {
+	fileName := filepath.Join(t.TempDir(), "test.zsitrpy")
+	w, err := newTelemetryReplayWriter(fileName, WriterOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	w.KeyframeInterval = 4
+	for i := 0; i < 10; i++ {
+		if err = w.WriteEntry(&Entry{Timestamp: int64(i), Connected: true, YamlData: testYaml, VariableData: "vars"}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// a writer that was never closed leaves its complete blocks but no index
+	_ = w.f.Close()
+
+	r, err := NewReader(fileName)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer r.Close()
+
+	if err = r.(Seeker).SeekTimestamp(5); err != nil {
+		t.Fatal(err)
+	}
+
+	for want := int64(5); ; want++ {
+		entry, err := r.ReadEntry()
+		if errors.Is(err, ErrEndOfFile) {
+			if want != 8 {
+				t.Errorf("expected the file to end after entry 7, got %d", want-1)
+			}
+
+			break
+		}
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if entry.Timestamp != want || entry.YamlData != testYaml {
+			t.Errorf("expected entry %d, got %+v", want, entry)
+		}
+	}
+}
+
+func TestRowDelta(t *testing.T) {
+	schema := bytes.Repeat([]byte("schema"), 40)
+	rows := make([]string, 200)
+	row := make([]byte, 1024)
+	for i := range rows {
+		binary.LittleEndian.PutUint32(row[16:], uint32(i))
+		row[900+i%100] ^= 0xff
+		rows[i] = EncodeRowData(schema, row)
+	}
+
+	// the schema changes half way through
+	rows[150] = EncodeRowData(schema[6:], row)
+
+	fileName := filepath.Join(t.TempDir(), "test.itrpy")
+	w, err := newTelemetryReplayWriter(fileName, WriterOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	w.KeyframeInterval = 64
+	for i, data := range rows {
+		if err = w.WriteEntry(&Entry{Timestamp: int64(i), Connected: true, VariableData: data}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err = w.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	entries := readEntries(t, fileName)
+	if len(entries) != len(rows) {
+		t.Fatalf("expected %d entries, got %d", len(rows), len(entries))
+	}
+
+	for i, entry := range entries {
+		if entry.VariableData != rows[i] {
+			t.Fatalf("entry %d does not match the row written", i)
+		}
+	}
+
+	if info, err := os.Stat(fileName); err != nil || info.Size() > 4*int64(len(rows[0])+len(schema))+int64(len(rows))*32 {
+		t.Errorf("expected deltas to be small, file is %d bytes", info.Size())
+	}
+
+	if _, _, ok := DecodeRowData("dmFycw=="); ok {
+		t.Errorf("base64 variable data decoded as a row")
+	}
+}
+
+// testVarHeader returns an irsdk_varHeader
+func testVarHeader(name string, varType uint8, offset int, count int) []byte {
+	h := make([]byte, VarHeaderSize)
+	binary.LittleEndian.PutUint32(h, uint32(varType))
+	binary.LittleEndian.PutUint32(h[4:], uint32(offset))
+	binary.LittleEndian.PutUint32(h[8:], uint32(count))
+	copy(h[16:], name)
+	return h
+}
+
+func TestColumnar(t *testing.T) {
+	schema := slices.Concat(
+		testVarHeader("Speed", 4, 0, 1),
+		testVarHeader("SessionTime", 5, 8, 1),
+		testVarHeader("CarIdxLap", 2, 16, 3),
+	)
+
+	row := func(i int) string {
+		row := make([]byte, 28)
+		binary.LittleEndian.PutUint32(row, math.Float32bits(float32(i)/2))
+		binary.LittleEndian.PutUint64(row[8:], math.Float64bits(float64(i)/60))
+		for car := 0; car < 3; car++ {
+			binary.LittleEndian.PutUint32(row[16+car*4:], uint32(int32(i/10-car)))
+		}
+
+		return EncodeRowData(schema, row)
+	}
+
+	entries := make([]*Entry, 0)
+	for i := 0; i < 250; i++ {
+		entry := &Entry{Timestamp: int64(1000 + i*10), Connected: true, YamlData: testYaml, VariableData: row(i)}
+		switch {
+		case i >= 100 && i < 110:
+			// disconnected entries have no row
+			entry.Connected = false
+			entry.VariableData = ""
+		case i >= 200:
+			// a new layout starts a new block
+			entry.VariableData = EncodeRowData(schema[:VarHeaderSize], []byte(row(i)[len(rowMagic)+2+len(schema):])[:4])
+		}
+
+		entries = append(entries, entry)
+	}
+
+	fileName := filepath.Join(t.TempDir(), "test.zsitrpy")
+	w, err := NewColumnarWriter(fileName)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	w.(*TelemetryReplayWriter).KeyframeInterval = 64
+	for _, entry := range entries {
+		if err = w.WriteEntry(entry); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err = w.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	read := readEntries(t, fileName)
+	if len(read) != len(entries) {
+		t.Fatalf("expected %d entries, got %d", len(entries), len(read))
+	}
+
+	for i := range read {
+		if *read[i] != *entries[i] {
+			t.Fatalf("entry %d does not match: %+v", i, read[i])
+		}
+	}
+
+	r, err := NewReader(fileName)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer r.Close()
+
+	samples, err := r.(ChannelReader).ReadChannel("CarIdxLap", 1500, 2200)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// entries 50 to 120 without the ten disconnected ones
+	if len(samples) != 61 || samples[0].Timestamp != 1500 || !slices.Equal(samples[0].Values, []float64{5, 4, 3}) || samples[60].Timestamp != 2200 {
+		t.Fatalf("unexpected samples %+v", samples)
+	}
+
+	samples, err = r.(ChannelReader).ReadChannel("Speed", 0, math.MaxInt64)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(samples) != 240 || samples[239].Values[0] != 124.5 {
+		t.Errorf("expected 240 speed samples, got %d", len(samples))
+	}
+
+	stats, err := r.(*BlockReader).ChannelStats("Speed")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(stats) != 5 || stats[0].Min != 0 || stats[0].Max != 31.5 || stats[4].Min != 100 || stats[4].Max != 124.5 {
+		t.Errorf("unexpected stats %+v", stats)
+	}
+
+	if err = r.(Seeker).SeekTimestamp(1505); err != nil {
+		t.Fatal(err)
+	}
+
+	if entry, err := r.ReadEntry(); err != nil || *entry != *entries[50] {
+		t.Errorf("expected entry 50 after seeking, got %+v (%v)", entry, err)
+	}
+
+	// row files return the same samples
+	rowFileName := filepath.Join(t.TempDir(), "test.zsitrpy")
+	w, err = NewWriter(rowFileName)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, entry := range entries {
+		if err = w.WriteEntry(entry); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err = w.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	rr, err := NewReader(rowFileName)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer rr.Close()
+
+	rowSamples, err := rr.(ChannelReader).ReadChannel("Speed", 0, math.MaxInt64)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !reflect.DeepEqual(rowSamples, samples) {
+		t.Errorf("expected the samples of the columnar file, got %d samples", len(rowSamples))
+	}
+}
+
+// columnarFile returns a file holding one columnar block of rows, passed to mutate before it is written
+func columnarFile(t *testing.T, rows int, mutate func(b *Block, dir *columnarDir)) []byte {
+	t.Helper()
+
+	schema := testVarHeader("Speed", 4, 0, 1)
+	var cb columnarBlock
+	for i := 0; i < rows; i++ {
+		cb.add(&Entry{Timestamp: int64(i), Connected: true, VariableData: EncodeRowData(schema, binary.LittleEndian.AppendUint32(nil, uint32(i)))})
+	}
+
+	codec, err := newBlockCodec(CodecNone, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	body, err := cb.encode(codec)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	l := binary.LittleEndian.Uint32(body)
+	dir, err := decodeColumnarDir(body[4 : 4+l])
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	b := Block{Entries: rows, Columnar: true}
+	mutate(&b, dir)
+	encoded := dir.encode()
+	body = slices.Concat(binary.LittleEndian.AppendUint32(nil, uint32(len(encoded))), encoded, body[4+l:])
+	b.Length = len(body)
+
+	var out bytes.Buffer
+	if _, err = writeHeader(&out, CodecNone, &Metadata{}); err != nil {
+		t.Fatal(err)
+	}
+
+	h := make([]byte, blockHeaderSize)
+	putBlockHeader(h, &b, body)
+	out.Write(h)
+	out.Write(body)
+	return out.Bytes()
+}
+
+func TestColumnarCorrupt(t *testing.T) {
+	for name, data := range map[string][]byte{
+		"short column": columnarFile(t, 4, func(b *Block, dir *columnarDir) {
+			dir.lengths[0] /= 2
+		}),
+		"entries": columnarFile(t, 4, func(b *Block, dir *columnarDir) {
+			b.Entries = math.MaxUint32
+		}),
+	} {
+		t.Run(name, func(t *testing.T) {
+			r, err := NewStreamReader(bytes.NewReader(data))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			defer r.Close()
+
+			if _, err = r.(ChannelReader).ReadChannel("Speed", 0, math.MaxInt64); err == nil {
+				t.Error("expected an error reading the channel of a corrupt block")
+			}
+		})
+	}
+}
+
+func TestInspect(t *testing.T) {
+	yamls := []string{
+		strings.TrimSuffix(testYaml, "...\n") + "SessionInfo:\n Sessions:\n - SessionNum: 0\n   SessionType: Practice\n   SessionName: PRACTICE\n",
+		strings.TrimSuffix(testYaml, "...\n") + "SessionInfo:\n Sessions:\n - SessionNum: 0\n   SessionType: Practice\n   SessionName: PRACTICE\n - SessionNum: 1\n   SessionType: Race\n   SessionName: RACE\n",
+	}
+
+	schema := testVarHeader("Speed", 4, 0, 1)
+	fileName := filepath.Join(t.TempDir(), "test.zsitrpy")
+	w, err := NewWriter(fileName)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for i := 0; i < 600; i++ {
+		entry := &Entry{Timestamp: int64(i * 100), Connected: true, NotOk: i%100 == 0, YamlData: yamls[i/300]}
+		switch {
+		case i >= 200 && i < 250:
+			entry = &Entry{Timestamp: int64(i * 100)}
+		case i < 400:
+			entry.VariableData = EncodeRowData(schema, []byte{0, 0, 0, byte(i)})
+		default:
+			entry.VariableData = EncodeRowData(slices.Concat(schema, testVarHeader("Gear", 2, 4, 1)), make([]byte, 8))
+		}
+
+		if err = w.WriteEntry(entry); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err = w.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	info, err := Inspect(fileName)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if info.Entries != 600 || info.Duration != 59900*time.Millisecond || math.Abs(info.EntryRate-10) > 0.01 {
+		t.Errorf("unexpected entries %d over %s at %f/s", info.Entries, info.Duration, info.EntryRate)
+	}
+
+	// the YAML comes back after the disconnect
+	if info.YamlRevisions != 3 || info.SchemaChanges != 1 || info.NotOk != 5 {
+		t.Errorf("unexpected revisions %d, schema changes %d and not ok %d", info.YamlRevisions, info.SchemaChanges, info.NotOk)
+	}
+
+	wantSpans := []Span{{Start: 0, End: 19900, Entries: 200}, {Start: 25000, End: 59900, Entries: 350}}
+	if !slices.Equal(info.ConnectedSpans, wantSpans) || !slices.Equal(info.DisconnectedSpans, []Span{{Start: 20000, End: 24900, Entries: 50}}) {
+		t.Errorf("unexpected spans %+v and %+v", info.ConnectedSpans, info.DisconnectedSpans)
+	}
+
+	if len(info.Sessions) != 2 || info.Sessions[1] != (SessionSummary{SubSessionID: 12345, SessionNum: 1, SessionType: "Race", SessionName: "RACE"}) {
+		t.Errorf("unexpected sessions %+v", info.Sessions)
+	}
+
+	if info.Metadata == nil || info.Metadata.Track != "Circuit de Spa-Francorchamps" {
+		t.Errorf("unexpected metadata %+v", info.Metadata)
+	}
+
+	if info.Size == 0 || info.ReadSize == 0 || info.ReadSize > info.Size || info.CompressionRatio() < 2 {
+		t.Errorf("unexpected sizes %d / %d / %d", info.ReadSize, info.Size, info.UncompressedSize)
+	}
+}
+
+func TestConvert(t *testing.T) {
+	dir := t.TempDir()
+	src := filepath.Join(dir, "src.gzitrpy")
+	w, err := NewWriterWithOptions(src, WriterOptions{GzipLevel: 9})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	writeEntries(t, w, 100)
+	srcMeta, err := ReadMetadata(src)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var read, size int64
+	calls := 0
+	dst := filepath.Join(dir, "dst.zsitrpy")
+	err = Convert(src, dst, ConvertOptions{
+		WriterOptions: WriterOptions{ZstdLevel: 19, Concurrency: 4, KeyframeInterval: 8},
+		Progress: func(r int64, s int64) {
+			if r < read {
+				t.Errorf("progress went back from %d to %d", read, r)
+			}
+
+			read, size = r, s
+			calls++
+		},
+	})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if calls != 100 || read == 0 || read > size {
+		t.Errorf("unexpected progress, %d calls ending at %d / %d", calls, read, size)
+	}
+
+	if got, want := readEntries(t, dst), readEntries(t, src); !reflect.DeepEqual(got, want) {
+		t.Errorf("converted entries do not match")
+	}
+
+	meta, err := ReadMetadata(dst)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if meta.Codec != CodecZstd || meta.Track != srcMeta.Track || !meta.Created.Equal(srcMeta.Created) {
+		t.Errorf("unexpected metadata %+v", meta)
+	}
+
+	r, err := NewReader(dst)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer r.Close()
+
+	if index, err := r.(*BlockReader).Index(); err != nil || len(index) != 13 {
+		t.Errorf("expected 13 blocks, got %d (%v)", len(index), err)
+	}
+
+	// a codec stored in the header wins over the extension
+	other := filepath.Join(dir, "other.itrpy")
+	if err = Convert(dst, other, ConvertOptions{WriterOptions: WriterOptions{Codec: CodecGzip}}); err != nil {
+		t.Fatal(err)
+	}
+
+	if entries := readEntries(t, other); len(entries) != 100 {
+		t.Errorf("expected 100 entries, got %d", len(entries))
+	}
+
+	invalid := filepath.Join(dir, "invalid.zsitrpy")
+	if err = Convert(src, invalid, ConvertOptions{WriterOptions: WriterOptions{WindowSize: 1000}}); err == nil {
+		t.Errorf("expected an invalid window size to fail")
+	}
+
+	if _, err = os.Stat(invalid); !os.IsNotExist(err) {
+		t.Errorf("expected no output file, got %v", err)
+	}
+}
+
+func TestTrimSplitMerge(t *testing.T) {
+	yaml := strings.TrimSuffix(testYaml, "...\n") + `SessionInfo:
+ Sessions:
+ - SessionNum: 0
+   SessionType: Practice
+ - SessionNum: 1
+   SessionType: Lone Qualify
+ - SessionNum: 2
+   SessionType: Race
+`
+
+	schema := slices.Concat(testVarHeader("SessionNum", 2, 0, 1), testVarHeader("Speed", 4, 4, 1))
+	dir := t.TempDir()
+	src := filepath.Join(dir, "weekend.zsitrpy")
+	w, err := NewWriter(src)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	entries := make([]*Entry, 0)
+	for i := 0; i < 300; i++ {
+		row := make([]byte, 8)
+		binary.LittleEndian.PutUint32(row, uint32(i/100))
+		binary.LittleEndian.PutUint32(row[4:], math.Float32bits(float32(i)))
+		entry := &Entry{Timestamp: int64(i * 100), Connected: true, YamlData: yaml, VariableData: EncodeRowData(schema, row)}
+		if i%100 >= 90 {
+			// disconnected between sessions
+			entry = &Entry{Timestamp: int64(i * 100)}
+		}
+
+		if err = w.WriteEntry(entry); err != nil {
+			t.Fatal(err)
+		}
+
+		entries = append(entries, entry)
+	}
+
+	if err = w.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	trimmed := filepath.Join(dir, "trimmed.zsitrpy")
+	if err = Trim(src, trimmed, TrimOptions{From: 5000, To: 25000, Sessions: []int{1}}); err != nil {
+		t.Fatal(err)
+	}
+
+	got := readEntries(t, trimmed)
+	if len(got) != 90 || !reflect.DeepEqual(got[0], entries[100]) || !reflect.DeepEqual(got[89], entries[189]) {
+		t.Errorf("unexpected trimmed entries %d", len(got))
+	}
+
+	if meta, err := ReadMetadata(trimmed); err != nil || meta.Track != "Circuit de Spa-Francorchamps" {
+		t.Errorf("expected the metadata of the source, got %+v (%v)", meta, err)
+	}
+
+	files, err := SplitSessions(src, dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := []string{"weekend-0-practice.zsitrpy", "weekend-1-lone-qualify.zsitrpy", "weekend-2-race.zsitrpy"}
+	for i, fileName := range files {
+		if i >= len(want) || filepath.Base(fileName) != want[i] {
+			t.Fatalf("expected files %v, got %v", want, files)
+		}
+
+		// each session keeps the disconnected entries after it
+		if got = readEntries(t, fileName); len(got) != 100 || !reflect.DeepEqual(got[0], entries[i*100]) {
+			t.Errorf("unexpected entries in %s", fileName)
+		}
+	}
+
+	// overlapping recordings keep the first copy of every timestamp
+	merged := filepath.Join(dir, "merged.zsitrpy")
+	if err = Merge(merged, files[2], files[0], src, files[1]); err != nil {
+		t.Fatal(err)
+	}
+
+	if got = readEntries(t, merged); !reflect.DeepEqual(got, entries) {
+		t.Errorf("expected the merged file to match the source, got %d entries", len(got))
+	}
+}
+
+func TestSplitSessionsFileNames(t *testing.T) {
+	yaml := strings.TrimSuffix(testYaml, "...\n") + `SessionInfo:
+ Sessions:
+ - SessionNum: 0
+   SessionType: ../../x
+ - SessionNum: 1
+   SessionType: '..\..\Open Practice'
+ - SessionNum: 2
+   SessionType: /..
+`
+
+	schema := testVarHeader("SessionNum", 2, 0, 1)
+	dir := t.TempDir()
+	src := filepath.Join(dir, "upload.zsitrpy")
+	w, err := NewWriter(src)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for i := 0; i < 3; i++ {
+		row := binary.LittleEndian.AppendUint32(nil, uint32(i))
+		if err = w.WriteEntry(&Entry{Timestamp: int64(i), Connected: true, YamlData: yaml, VariableData: EncodeRowData(schema, row)}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err = w.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	out := filepath.Join(dir, "sessions")
+	if err = os.Mkdir(out, 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	files, err := SplitSessions(src, out)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := []string{"upload-0-x.zsitrpy", "upload-1-open-practice.zsitrpy", "upload-2.zsitrpy"}
+	if len(files) != len(want) {
+		t.Fatalf("expected files %v, got %v", want, files)
+	}
+
+	for i, fileName := range files {
+		if fileName != filepath.Join(out, want[i]) {
+			t.Errorf("expected %s, got %s", filepath.Join(out, want[i]), fileName)
+		}
+	}
+
+	// a colliding file fails the split and is left untouched
+	collide := filepath.Join(dir, "collide")
+	if err = os.Mkdir(collide, 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	existing := filepath.Join(collide, want[1])
+	if err = os.WriteFile(existing, []byte("keep"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err = SplitSessions(src, collide); err == nil {
+		t.Fatal("expected an error for an existing file")
+	}
+
+	if data, err := os.ReadFile(existing); err != nil || string(data) != "keep" {
+		t.Errorf("expected %s to be untouched, got %q (%v)", existing, data, err)
+	}
+
+	if _, err = os.Stat(filepath.Join(collide, want[0])); !os.IsNotExist(err) {
+		t.Errorf("expected %s to be removed, got %v", want[0], err)
+	}
+}
+
+func TestCrashRecovery(t *testing.T) {
+	dir := t.TempDir()
+	write := func(fileName string, flush bool) {
+		t.Helper()
+
+		w, err := newTelemetryReplayWriter(fileName, WriterOptions{FlushInterval: time.Second, SyncInterval: time.Millisecond})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		for i := 0; i < 35; i++ {
+			if err = w.WriteEntry(&Entry{Timestamp: int64(i * 100), Connected: true, YamlData: testYaml, VariableData: fmt.Sprintf("vars %d", i)}); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		if flush {
+			if err = w.Flush(); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		// the process dies without closing the writer
+		_ = w.f.Close()
+	}
+
+	unflushed := filepath.Join(dir, "unflushed.zsitrpy")
+	write(unflushed, false)
+	if entries := readEntries(t, unflushed); len(entries) != 33 {
+		t.Errorf("expected the three blocks spanning a second to survive, got %d entries", len(entries))
+	}
+
+	flushed := filepath.Join(dir, "flushed.zsitrpy")
+	write(flushed, true)
+	if entries := readEntries(t, flushed); len(entries) != 35 || entries[34].VariableData != "vars 34" {
+		t.Errorf("expected every entry to survive a flush, got %d entries", len(entries))
+	}
+
+	data, err := os.ReadFile(flushed)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// cut the last block in half
+	truncated := filepath.Join(dir, "truncated.zsitrpy")
+	if err = os.WriteFile(truncated, data[:len(data)-10], 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	repaired := filepath.Join(dir, "repaired.zsitrpy")
+	result, err := Repair(truncated, repaired)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if result.Entries != 33 || result.Cause != nil {
+		t.Errorf("unexpected repair result %+v", result)
+	}
+
+	r, err := NewReader(repaired)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer r.Close()
+
+	if index, err := r.(*BlockReader).readIndex(); err != nil || len(index) != 1 || index[0].Entries != 33 {
+		t.Errorf("expected a repaired file with an index, got %+v (%v)", index, err)
+	}
+}
+
+func TestTolerantReader(t *testing.T) {
+	// files without blocks fail mid entry when they are cut
+	var b bytes.Buffer
+	enc := gzip.NewWriter(&b)
+	w := buf.NewWriter(enc)
+	for i := 0; i < 20; i++ {
+		errs := []error{w.WriteVarLong(int64(i)), w.WriteBitMap(buf.BitMap{i == 0, true, true, false})}
+		if i == 0 {
+			errs = append(errs, w.WriteString(testYaml))
+		}
+
+		errs = append(errs, w.WriteString(strings.Repeat("v", 1000+i)))
+		if err := errors.Join(errs...); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := enc.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	dir := t.TempDir()
+	last := -1
+	for cut := b.Len() - 1; cut > b.Len()-200; cut -= 7 {
+		fileName := filepath.Join(dir, fmt.Sprintf("cut-%d.gzitrpy", cut))
+		if err := os.WriteFile(fileName, b.Bytes()[:cut], 0644); err != nil {
+			t.Fatal(err)
+		}
+
+		r, err := NewTolerantReader(fileName)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		n := 0
+		for {
+			entry, err := r.ReadEntry()
+			if errors.Is(err, ErrEndOfFile) {
+				break
+			}
+
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if entry.Timestamp != int64(n) || len(entry.VariableData) != 1000+n {
+				t.Fatalf("unexpected entry %d in %s", entry.Timestamp, fileName)
+			}
+
+			n++
+		}
+
+		_ = r.Close()
+		if r.Err() == nil {
+			t.Errorf("expected the cut at %d to be reported", cut)
+		}
+
+		if last >= 0 && n > last {
+			t.Errorf("recovered more entries from a shorter file")
+		}
+
+		last = n
+	}
+
+	if last <= 0 {
+		t.Errorf("expected entries to be recovered from every cut")
+	}
+}
+
+func TestBlockLength(t *testing.T) {
+	var out bytes.Buffer
+	w, err := NewStreamWriter(&out, WriterOptions{KeyframeInterval: 10})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	writeEntries(t, w, 30)
+
+	// a length far past the end of the stream in the header of the second block
+	data := out.Bytes()
+	second := bytes.Index(data[bytes.Index(data, []byte(blockMagic))+1:], []byte(blockMagic)) + bytes.Index(data, []byte(blockMagic)) + 1
+	binary.LittleEndian.PutUint32(data[second+16:], 0xf0000000)
+
+	r, err := NewStreamReader(struct{ io.Reader }{bytes.NewReader(data)})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if entries := readAll(t, r); len(entries) != 20 || entries[10].Timestamp != 1020 {
+		t.Errorf("expected the first and last block, got %d entries", len(entries))
+	}
+
+	if corrupt := r.(*BlockReader).Corrupt(); len(corrupt) != 1 || corrupt[0].Start != int64(second) {
+		t.Errorf("expected the second block to be corrupt, got %v", corrupt)
+	}
+
+	// entries too large for one block are split over several
+	out.Reset()
+	w, err = NewStreamWriter(&out, WriterOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for i := 0; i < 8; i++ {
+		variables := strings.Repeat(string(rune('a'+i)), 5<<20)
+		if err = w.WriteEntry(&Entry{Timestamp: int64(i), Connected: true, VariableData: variables}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err = w.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	r, err = NewStreamReader(bytes.NewReader(out.Bytes()))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer r.Close()
+
+	index, err := r.(*BlockReader).Index()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(index) < 2 {
+		t.Errorf("expected several blocks, got %d", len(index))
+	}
+}
+
+func TestCorruption(t *testing.T) {
+	for _, columnar := range []bool{false, true} {
+		t.Run(fmt.Sprintf("columnar=%v", columnar), func(t *testing.T) {
+			schema := testVarHeader("Speed", 4, 0, 1)
+			fileName := filepath.Join(t.TempDir(), "test.zsitrpy")
+			w, err := newTelemetryReplayWriter(fileName, WriterOptions{KeyframeInterval: 10, Columnar: columnar})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			for i := 0; i < 100; i++ {
+				row := binary.LittleEndian.AppendUint32(nil, math.Float32bits(float32(i)))
+				if err = w.WriteEntry(&Entry{Timestamp: int64(i), Connected: true, YamlData: testYaml, VariableData: EncodeRowData(schema, row)}); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			if err = w.Close(); err != nil {
+				t.Fatal(err)
+			}
+
+			blocks := w.blocks
+			data, err := os.ReadFile(fileName)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			// a flipped bit in the body of block 2 and in the magic of block 5
+			data[blocks[2].end()-3] ^= 0x10
+			data[blocks[5].Offset] ^= 0x01
+			if err = os.WriteFile(fileName, data, 0644); err != nil {
+				t.Fatal(err)
+			}
+
+			r, err := NewReader(fileName)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			defer r.Close()
+
+			timestamps := make([]int64, 0)
+			for {
+				entry, err := r.ReadEntry()
+				if errors.Is(err, ErrEndOfFile) {
+					break
+				}
+
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				timestamps = append(timestamps, entry.Timestamp)
+			}
+
+			if len(timestamps) != 80 || timestamps[19] != 19 || timestamps[20] != 30 || timestamps[49] != 69 {
+				t.Errorf("expected blocks 2 and 5 to be skipped, got %v", timestamps)
+			}
+
+			corrupt := r.(*BlockReader).Corrupt()
+			want := []CorruptRange{{Start: blocks[2].Offset, End: blocks[3].Offset}, {Start: blocks[5].Offset, End: blocks[6].Offset}}
+			if len(corrupt) != 2 {
+				t.Fatalf("expected two corrupt ranges, got %v", corrupt)
+			}
+
+			for i, c := range corrupt {
+				if c.Start != want[i].Start || c.End != want[i].End || !errors.Is(c.Err, errCorruptBlock) {
+					t.Errorf("expected corrupt range %d-%d, got %v", want[i].Start, want[i].End, c)
+				}
+			}
+
+			// seeking into a corrupt block continues at the next valid one
+			if err = r.(Seeker).SeekTimestamp(25); err != nil {
+				t.Fatal(err)
+			}
+
+			if entry, err := r.ReadEntry(); err != nil || entry.Timestamp != 30 {
+				t.Errorf("expected entry 30 after seeking into a corrupt block, got %+v (%v)", entry, err)
+			}
+
+			// without the index the headers are scanned, skipping the corrupt magic
+			data = data[:blocks[len(blocks)-1].end()]
+			if err = os.WriteFile(fileName, data, 0644); err != nil {
+				t.Fatal(err)
+			}
+
+			r2, err := NewReader(fileName)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			defer r2.Close()
+
+			index, err := r2.(*BlockReader).Index()
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if len(index) != 9 || index[5].Offset != blocks[6].Offset {
+				t.Errorf("expected the scanned index to skip block 5, got %d blocks", len(index))
+			}
+		})
+	}
+}
+
+// slowWriter records entries, writes wait until release is closed
+type slowWriter struct {
+	mux     sync.Mutex
+	entries []Entry
+	release chan struct{}
+	closed  bool
+}
+
+func (w *slowWriter) WriteEntry(entry *Entry) error {
+	if w.release != nil {
+		<-w.release
+	}
+
+	w.mux.Lock()
+	defer w.mux.Unlock()
+	w.entries = append(w.entries, *entry)
+	return nil
+}
+
+func (w *slowWriter) Close() error {
+	w.closed = true
+	return nil
+}
+
+func TestAsyncWriter(t *testing.T) {
+	for _, policy := range []OverflowPolicy{OverflowBlock, OverflowDrop, OverflowSpill} {
+		t.Run(policy.String(), func(t *testing.T) {
+			w := &slowWriter{release: make(chan struct{})}
+			a := NewAsyncWriter(w, AsyncOptions{QueueSize: 10, Overflow: policy, SpillDir: t.TempDir()})
+
+			// the first write is taken off the queue and waits for release, so the queue fills up
+			if policy == OverflowBlock {
+				go func() {
+					for a.Stats().Blocked == 0 {
+						time.Sleep(time.Millisecond)
+					}
+
+					close(w.release)
+				}()
+			}
+
+			for i := 0; i < 100; i++ {
+				entry := &Entry{Timestamp: int64(i), Connected: true, YamlData: testYaml, VariableData: fmt.Sprintf("vars %d", i/7)}
+				if err := a.WriteEntry(entry); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			if policy != OverflowBlock {
+				close(w.release)
+			}
+
+			if err := a.Close(); err != nil {
+				t.Fatal(err)
+			}
+
+			stats := a.Stats()
+			if !w.closed || stats.Depth != 0 || stats.Written != uint64(len(w.entries)) || stats.MaxDepth > 10 && policy != OverflowSpill {
+				t.Errorf("unexpected stats %+v", stats)
+			}
+
+			switch policy {
+			case OverflowDrop:
+				if stats.Dropped == 0 || stats.Written+stats.Dropped != 100 {
+					t.Errorf("expected dropped entries, got %+v", stats)
+				}
+			case OverflowSpill:
+				if stats.Spilled == 0 || stats.MaxDepth <= 10 {
+					t.Errorf("expected spilled entries, got %+v", stats)
+				}
+			}
+
+			if policy == OverflowDrop {
+				return
+			}
+
+			if len(w.entries) != 100 {
+				t.Fatalf("expected 100 entries, got %d", len(w.entries))
+			}
+
+			for i, entry := range w.entries {
+				if entry.Timestamp != int64(i) || entry.VariableData != fmt.Sprintf("vars %d", i/7) || entry.YamlData != testYaml {
+					t.Fatalf("entry %d out of order: %+v", i, entry)
+				}
+			}
+		})
+	}
+}
+
+func TestStream(t *testing.T) {
+	for _, codec := range []Codec{CodecNone, CodecZstd, CodecGzip} {
+		t.Run(codec.String(), func(t *testing.T) {
+			var out bytes.Buffer
+			w, err := NewStreamWriter(&out, WriterOptions{Codec: codec, KeyframeInterval: 10})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			writeEntries(t, w, 95)
+			data := out.Bytes()
+
+			// readers with offsets can seek
+			r, err := NewStreamReader(bytes.NewReader(data))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if err = r.(Seeker).SeekTimestamp(1050); err != nil {
+				t.Fatal(err)
+			}
+
+			if entries := readAll(t, r); len(entries) != 45 || entries[0].Timestamp != 1050 {
+				t.Errorf("unexpected entries after seek: %d", len(entries))
+			}
+
+			// streams are read forward
+			r, err = NewStreamReader(struct{ io.Reader }{bytes.NewReader(data)})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if err = r.(Seeker).SeekTimestamp(1050); !errors.Is(err, ErrNotSeekable) {
+				t.Errorf("expected ErrNotSeekable, got %v", err)
+			}
+
+			entries := readAll(t, r)
+			if len(entries) != 95 || entries[94].Timestamp != 1094 || entries[94].YamlData != testYaml {
+				t.Fatalf("unexpected entries %d", len(entries))
+			}
+
+			// a stream cut short ends at the last complete block
+			r, err = NewStreamReader(struct{ io.Reader }{bytes.NewReader(data[:len(data)*2/3])})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if entries = readAll(t, r); len(entries) == 0 || len(entries)%10 != 0 || len(entries) >= 95 {
+				t.Errorf("unexpected entries from truncated stream: %d", len(entries))
+			}
+		})
+	}
+
+	t.Run("pipe", func(t *testing.T) {
+		pr, pw := io.Pipe()
+		go func() {
+			w, err := NewStreamWriter(pw, WriterOptions{Codec: CodecZstd, KeyframeInterval: 7})
+			if err != nil {
+				_ = pw.CloseWithError(err)
+				return
+			}
+
+			for i := 0; i < 50 && err == nil; i++ {
+				err = w.WriteEntry(&Entry{Timestamp: int64(i), Connected: true, YamlData: testYaml, VariableData: "vars"})
+			}
+
+			if err != nil {
+				_ = pw.CloseWithError(err)
+				return
+			}
+
+			// closes the pipe
+			_ = pw.CloseWithError(w.Close())
+		}()
+
+		r, err := NewStreamReader(pr)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if entries := readAll(t, r); len(entries) != 50 {
+			t.Errorf("expected 50 entries, got %d", len(entries))
+		}
+	})
+
+	t.Run("legacy", func(t *testing.T) {
+		var out bytes.Buffer
+		enc, err := gzip.NewWriterLevel(&out, gzip.BestSpeed)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		var encoder entryEncoder
+		for i := 0; i < 3; i++ {
+			if err = encoder.encode(buf.NewWriter(enc), &Entry{Timestamp: int64(i), Connected: true, YamlData: testYaml, VariableData: "vars"}); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		if err = enc.Close(); err != nil {
+			t.Fatal(err)
+		}
+
+		r, err := NewStreamReader(&out)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if entries := readAll(t, r); len(entries) != 3 || entries[2].VariableData != "vars" {
+			t.Errorf("unexpected entries %+v", entries)
+		}
+	})
+}
@@ -0,0 +1,143 @@
+package replay
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// rowMagic starts variable data holding the variable headers and a raw telemetry row, instead of the
+// base64 gob written by older versions. Base64 never contains a null byte.
+const rowMagic = "\x00ROW"
+
+// EncodeRowData returns Entry.VariableData holding schema, the variable headers, and a raw telemetry row
+func EncodeRowData(schema []byte, row []byte) string {
+	var b strings.Builder
+	b.Grow(len(rowMagic) + binary.MaxVarintLen32 + len(schema) + len(row))
+	b.WriteString(rowMagic)
+	b.Write(binary.AppendUvarint(nil, uint64(len(schema))))
+	b.Write(schema)
+	b.Write(row)
+	return b.String()
+}
+
+// DecodeRowData splits variable data written by EncodeRowData, ok is false for any other variable data
+func DecodeRowData(data string) (schema string, row string, ok bool) {
+	if !strings.HasPrefix(data, rowMagic) {
+		return "", "", false
+	}
+
+	data = data[len(rowMagic):]
+	length, n := binary.Uvarint([]byte(data[:min(len(data), binary.MaxVarintLen32)]))
+	if n <= 0 || uint64(len(data)-n) < length {
+		return "", "", false
+	}
+
+	return data[n : n+int(length)], data[n+int(length):], true
+}
+
+// VarHeaderSize is the size of an irsdk_varHeader, the schema of row data is a list of them
+const VarHeaderSize = 144
+
+// VarHeader is an irsdk_varHeader describing a variable of a telemetry row
+type VarHeader struct {
+	Type        int
+	Offset      int
+	Count       int
+	CountAsTime bool
+	Name        string
+	Desc        string
+	Unit        string
+}
+
+// ParseVarHeader parses an irsdk_varHeader, b must hold VarHeaderSize bytes
+func ParseVarHeader(b []byte) VarHeader {
+	return VarHeader{
+		Type:        int(binary.LittleEndian.Uint32(b[0:4])),
+		Offset:      int(binary.LittleEndian.Uint32(b[4:8])),
+		Count:       int(binary.LittleEndian.Uint32(b[8:12])),
+		CountAsTime: b[12] > 0,
+		Name:        strings.TrimRight(string(b[16:48]), "\x00"),
+		Desc:        strings.TrimRight(string(b[48:112]), "\x00"),
+		Unit:        strings.TrimRight(string(b[112:144]), "\x00"),
+	}
+}
+
+// ParseVarHeaders parses the schema of row data
+func ParseVarHeaders(schema string) ([]VarHeader, error) {
+	if len(schema)%VarHeaderSize != 0 {
+		return nil, fmt.Errorf("invalid var headers length %d", len(schema))
+	}
+
+	headers := make([]VarHeader, 0, len(schema)/VarHeaderSize)
+	for i := 0; i < len(schema); i += VarHeaderSize {
+		headers = append(headers, ParseVarHeader([]byte(schema[i:i+VarHeaderSize])))
+	}
+
+	return headers, nil
+}
+
+var errCorruptDelta = errors.New("corrupt row delta")
+
+// appendRowDelta appends the bytes of row that differ from prev, which has the same length, as runs of
+// unchanged length, changed length and the changed bytes XOR the previous ones
+func appendRowDelta(dst []byte, prev string, row string) []byte {
+	for i := 0; i < len(row); {
+		start := i
+		for i < len(row) && row[i] == prev[i] {
+			i++
+		}
+
+		if i == len(row) {
+			break
+		}
+
+		changed := i
+		// short unchanged gaps cost more as a new run than as XOR zeros
+		for i < len(row) && (row[i] != prev[i] || (i+2 < len(row) && row[i+1] != prev[i+1])) {
+			i++
+		}
+
+		dst = binary.AppendUvarint(dst, uint64(changed-start))
+		dst = binary.AppendUvarint(dst, uint64(i-changed))
+		for j := changed; j < i; j++ {
+			dst = append(dst, row[j]^prev[j])
+		}
+	}
+
+	return dst
+}
+
+// applyRowDelta returns prev with a delta written by appendRowDelta applied
+func applyRowDelta(prev string, delta []byte) (string, error) {
+	row := []byte(prev)
+	pos := 0
+	for len(delta) > 0 {
+		skip, n := binary.Uvarint(delta)
+		if n <= 0 {
+			return "", errCorruptDelta
+		}
+
+		delta = delta[n:]
+		length, n := binary.Uvarint(delta)
+		if n <= 0 || uint64(len(delta)-n) < length {
+			return "", errCorruptDelta
+		}
+
+		delta = delta[n:]
+		if uint64(len(row)-pos) < skip+length {
+			return "", errCorruptDelta
+		}
+
+		pos += int(skip)
+		for _, b := range delta[:length] {
+			row[pos] ^= b
+			pos++
+		}
+
+		delta = delta[length:]
+	}
+
+	return string(row), nil
+}
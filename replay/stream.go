@@ -0,0 +1,120 @@
+package replay
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"slices"
+)
+
+// ErrNotSeekable is returned by readers of streams for operations that need the index
+var ErrNotSeekable = errors.New("stream is not seekable")
+
+var (
+	zstdMagic = []byte{0x28, 0xb5, 0x2f, 0xfd}
+	gzipMagic = []byte{0x1f, 0x8b}
+)
+
+// sniffCodec returns the codec of a file without a header from its first bytes
+func sniffCodec(r *bufio.Reader) (Codec, error) {
+	start, err := r.Peek(len(zstdMagic))
+	if err != nil && !errors.Is(err, io.EOF) {
+		return 0, fmt.Errorf("failed to read stream: %w", err)
+	}
+
+	switch {
+	case bytes.HasPrefix(start, zstdMagic):
+		return CodecZstd, nil
+	case bytes.HasPrefix(start, gzipMagic):
+		return CodecGzip, nil
+	default:
+		return CodecNone, nil
+	}
+}
+
+// readerAt returns r as an io.ReaderAt with its size when it supports reading at offsets, like
+// bytes.Reader, io.SectionReader and regular files
+func readerAt(r io.Reader) (io.ReaderAt, int64, bool) {
+	if f, ok := r.(*os.File); ok {
+		// pipes and terminals cannot be read at offsets
+		info, err := f.Stat()
+		if err != nil || !info.Mode().IsRegular() {
+			return nil, 0, false
+		}
+
+		offset, err := f.Seek(0, io.SeekCurrent)
+		if err != nil {
+			return nil, 0, false
+		}
+
+		return io.NewSectionReader(f, offset, info.Size()-offset), info.Size() - offset, true
+	}
+
+	ra, ok := r.(io.ReaderAt)
+	if !ok {
+		return nil, 0, false
+	}
+
+	sized, ok := r.(interface{ Size() int64 })
+	if !ok {
+		return nil, 0, false
+	}
+
+	if s, ok := r.(io.Seeker); ok {
+		// bytes.Reader and strings.Reader report the size of the whole data whatever was read
+		offset, err := s.Seek(0, io.SeekCurrent)
+		if err != nil {
+			return nil, 0, false
+		}
+
+		return io.NewSectionReader(ra, offset, sized.Size()-offset), sized.Size() - offset, true
+	}
+
+	return ra, sized.Size(), true
+}
+
+// streamSource lets a BlockReader read a stream forward. Data is kept from the start of the last read
+// past the data read so far, so the blocks read in order can be read again, up to the next block.
+type streamSource struct {
+	r    io.Reader
+	base int64 // stream offset of data
+	data []byte
+}
+
+func (s *streamSource) ReadAt(p []byte, off int64) (int, error) {
+	end := s.base + int64(len(s.data))
+	if off >= end {
+		// the blocks before off are done with
+		if _, err := io.CopyN(io.Discard, s.r, off-end); err != nil {
+			return 0, err
+		}
+
+		s.base = off
+		s.data = s.data[:0]
+		end = off
+	}
+
+	if off < s.base {
+		return 0, fmt.Errorf("offset %d was already read from the stream", off)
+	}
+
+	if want := off + int64(len(p)) - end; want > 0 {
+		n := len(s.data)
+		s.data = slices.Grow(s.data, int(want))[:n+int(want)]
+		m, err := io.ReadFull(s.r, s.data[n:])
+		s.data = s.data[:n+m]
+		if err != nil && !errors.Is(err, io.EOF) && !errors.Is(err, io.ErrUnexpectedEOF) {
+			return 0, err
+		}
+	}
+
+	n := copy(p, s.data[off-s.base:])
+	if n < len(p) {
+		return n, io.EOF
+	}
+
+	return n, nil
+}
@@ -1,107 +1,412 @@
 package replay
 
 import (
-	"compress/gzip"
+	"bytes"
 	"fmt"
 	"github.com/hfoxy/iracing-sdk/buf"
-	"github.com/klauspost/compress/zstd"
 	"io"
 	"os"
 	"path/filepath"
+	"time"
 )
 
+// WriterOptions configures a TelemetryReplayWriter, the zero value uses the codec implied by the file
+// extension with default settings
+type WriterOptions struct {
+	// Codec overrides the codec implied by the file extension when it is not CodecNone, the codec is
+	// stored in the file header so readers do not depend on the extension
+	Codec Codec
+	// ZstdLevel is the zstd compression level from 1 to 22, zero uses the default level
+	ZstdLevel int
+	// GzipLevel is a compress/gzip level, zero uses gzip.DefaultCompression
+	GzipLevel int
+	// WindowSize is the zstd window size in bytes, a power of two, zero uses the default size
+	WindowSize int
+	// Concurrency is the number of blocks compressed in parallel, blocks are compressed on the
+	// calling goroutine when it is zero or one
+	Concurrency int
+
+	// KeyframeInterval is the number of entries per block, DefaultKeyframeInterval when zero
+	KeyframeInterval int
+	// Columnar stores raw rows one column per variable, see BlockReader.ReadChannel
+	Columnar bool
+	// Metadata is written to the file header, it is taken from the session info of the first entry when nil
+	Metadata *Metadata
+
+	// FlushInterval writes a block once its entries span this long, by their timestamps, bounding the
+	// entries lost when the process crashes. Blocks are only written when full when it is zero.
+	FlushInterval time.Duration
+	// SyncInterval calls fsync after writing a block when the last fsync is at least this old, the file
+	// is only synced by Flush and Close when it is zero
+	SyncInterval time.Duration
+}
+
+// TelemetryReplayWriter writes entries in blocks of KeyframeInterval entries, each compressed on its
+// own and starting with a keyframe, followed by an index of the blocks when the writer is closed
 type TelemetryReplayWriter struct {
-	closeFunc func() error
-	buf       *buf.Buffer
+	// KeyframeInterval is the number of entries per block, DefaultKeyframeInterval when zero
+	KeyframeInterval int
+	// Columnar stores raw rows one column per variable, see BlockReader.ReadChannel
+	Columnar bool
+
+	f        *os.File  // the output file, nil when writing to a stream
+	dst      io.Writer // f or the stream
+	codec    Codec
+	options  WriterOptions
+	metadata *Metadata // nil until the header is written when it is taken from the first entry
+	created  time.Time
+	started  bool
+
+	blockCodec *blockCodec
+	offset     int64 // file offset of the next block
+	blocks     []Block
+	inflight   []*pendingBlock // blocks being compressed, in file order
+	lastSync   time.Time
+
+	block    bytes.Buffer // entries of the current block, uncompressed
+	out      *buf.Buffer
+	encoder  entryEncoder
+	columnar columnarBlock
+	current  Block
+}
 
-	lastYamlData     string
-	lastVariableData string
+// pendingBlock is a block compressed on another goroutine
+type pendingBlock struct {
+	block Block
+	done  chan struct{}
+	data  []byte
+	err   error
 }
 
+// NewTelemetryReplayWriter creates a file taking its metadata from the session info of the first entry
 func NewTelemetryReplayWriter(outputFile string) (Writer, error) {
-	if _, err := os.Stat(outputFile); err == nil {
+	return newTelemetryReplayWriter(outputFile, WriterOptions{})
+}
+
+// NewTelemetryReplayWriterWithMetadata creates a file with the given metadata, Created and
+// LibraryVersion are filled in when empty
+func NewTelemetryReplayWriterWithMetadata(outputFile string, meta Metadata) (Writer, error) {
+	return newTelemetryReplayWriter(outputFile, WriterOptions{Metadata: &meta})
+}
+
+// NewTelemetryReplayWriterWithOptions creates a file configured by opts
+func NewTelemetryReplayWriterWithOptions(outputFile string, opts WriterOptions) (Writer, error) {
+	return newTelemetryReplayWriter(outputFile, opts)
+}
+
+func newTelemetryReplayWriter(outputFile string, opts WriterOptions) (*TelemetryReplayWriter, error) {
+	codec, err := codecForExtension(filepath.Ext(outputFile))
+	if err != nil {
+		return nil, err
+	}
+
+	if opts.Codec != CodecNone {
+		codec = opts.Codec
+	}
+
+	if _, err = os.Stat(outputFile); err == nil {
 		return nil, fmt.Errorf("output file already exists: %s", outputFile)
 	}
 
+	// validate the compression settings before creating the file
+	bc, err := newBlockCodec(codec, &opts)
+	if err != nil {
+		return nil, err
+	}
+
 	f, err := os.OpenFile(outputFile, os.O_CREATE|os.O_WRONLY, 0644)
 	if err != nil {
+		bc.close()
 		return nil, fmt.Errorf("failed to open output file: %s", outputFile)
 	}
 
-	var closeFunc func() error
-	var w io.Writer
+	return newWriter(f, f, codec, bc, opts)
+}
 
-	ext := filepath.Ext(outputFile)
-	switch ext {
-	case ".itrpy":
-		closeFunc = f.Close
-		w = f
-	case ".zsitrpy":
-		var enc *zstd.Encoder
-		enc, err = zstd.NewWriter(f)
-		if err != nil {
-			return nil, fmt.Errorf("failed to create zstd encoder: %w", err)
-		}
+// newStreamWriter writes a recording to dst, compressed with opts.Codec
+func newStreamWriter(dst io.Writer, opts WriterOptions) (*TelemetryReplayWriter, error) {
+	bc, err := newBlockCodec(opts.Codec, &opts)
+	if err != nil {
+		return nil, err
+	}
+
+	return newWriter(dst, nil, opts.Codec, bc, opts)
+}
 
-		closeFunc = func() error {
-			enc.Close()
-			return f.Close()
+// newWriter writes to dst, f is the file behind dst which is synced, nil for streams.
+// dst is closed by Close when it is an io.Closer.
+func newWriter(dst io.Writer, f *os.File, codec Codec, bc *blockCodec, opts WriterOptions) (*TelemetryReplayWriter, error) {
+	if opts.Metadata != nil {
+		meta := *opts.Metadata
+		opts.Metadata = &meta
+	}
+
+	w := &TelemetryReplayWriter{
+		KeyframeInterval: opts.KeyframeInterval,
+		Columnar:         opts.Columnar,
+		f:                f,
+		dst:              dst,
+		codec:            codec,
+		options:          opts,
+		metadata:         opts.Metadata,
+		created:          time.Now(),
+		lastSync:         time.Now(),
+		blockCodec:       bc,
+	}
+
+	if w.metadata != nil {
+		if err := w.start(); err != nil {
+			bc.close()
+			_ = w.closeDst()
+			return nil, err
 		}
+	}
+
+	return w, nil
+}
+
+// start writes the header and sets up compression for the entries that follow
+func (w *TelemetryReplayWriter) start() error {
+	if w.metadata == nil {
+		w.metadata = &Metadata{}
+	}
+
+	if w.metadata.Created.IsZero() {
+		w.metadata.Created = w.created
+	}
 
-		w = enc
-	case ".gzitrpy":
-		enc := gzip.NewWriter(f)
-		closeFunc = enc.Close
-		w = enc
-	default:
-		return nil, fmt.Errorf("unsupported format: %s", ext)
+	if w.metadata.LibraryVersion == "" {
+		w.metadata.LibraryVersion = libraryVersion()
 	}
 
-	return &TelemetryReplayWriter{
-		closeFunc: closeFunc,
-		buf:       buf.NewWriter(w),
-	}, nil
+	w.metadata.FormatVersion = FormatVersion
+	w.metadata.Codec = w.codec
+
+	offset, err := writeHeader(w.dst, w.codec, w.metadata)
+	if err != nil {
+		return err
+	}
+
+	w.offset = offset
+	w.out = buf.NewWriter(&w.block)
+	w.started = true
+	return nil
+}
+
+// Metadata returns the metadata written to the header, or nil before the first entry when the
+// metadata is taken from it
+func (w *TelemetryReplayWriter) Metadata() *Metadata {
+	return w.metadata
 }
 
 func (w *TelemetryReplayWriter) WriteEntry(entry *Entry) error {
-	yamlUpdated := w.lastYamlData != entry.YamlData
-	variableUpdated := w.lastVariableData != entry.VariableData
+	if !w.started {
+		w.metadata = &Metadata{}
+		if entry.YamlData != "" {
+			// a session info that fails to parse only costs the session metadata
+			_ = w.metadata.FromSessionInfo(entry.YamlData)
+		}
 
-	bm := buf.BitMap{yamlUpdated, variableUpdated, entry.Connected, entry.NotOk}
+		if err := w.start(); err != nil {
+			return err
+		}
+	}
 
-	err := w.buf.WriteVarLong(entry.Timestamp)
-	if err != nil {
+	if w.Columnar && !w.columnar.fits(entry) {
+		// a block holds rows of a single layout
+		if err := w.writeBlock(); err != nil {
+			return err
+		}
+	}
+
+	if w.current.Entries == 0 {
+		w.encoder.reset()
+		w.current.FirstTimestamp = entry.Timestamp
+		w.current.Columnar = w.Columnar
+	}
+
+	if w.Columnar {
+		w.columnar.add(entry)
+	} else if err := w.encoder.encode(w.out, entry); err != nil {
 		return err
 	}
 
-	err = w.buf.WriteBitMap(bm)
-	if err != nil {
+	w.current.Entries++
+	interval := w.KeyframeInterval
+	if interval <= 0 {
+		interval = DefaultKeyframeInterval
+	}
+
+	flush := w.options.FlushInterval
+	if w.current.Entries >= interval || (flush > 0 && entry.Timestamp-w.current.FirstTimestamp >= flush.Milliseconds()) || w.blockSize() >= maxBlockSize {
+		return w.writeBlock()
+	}
+
+	return nil
+}
+
+// blockSize returns the size of the entries of the current block, before compression
+func (w *TelemetryReplayWriter) blockSize() int {
+	if w.current.Columnar {
+		return w.columnar.size
+	}
+
+	return w.block.Len()
+}
+
+// Flush writes every entry written so far, including the incomplete block, and syncs the file.
+// Readers treat the file as complete up to here should the process crash before Close.
+func (w *TelemetryReplayWriter) Flush() error {
+	if !w.started {
+		return nil
+	}
+
+	if err := w.writeBlock(); err != nil {
 		return err
 	}
 
-	if yamlUpdated {
-		err = w.buf.WriteString(entry.YamlData)
-		if err != nil {
+	for len(w.inflight) > 0 {
+		if err := w.writeOldest(); err != nil {
 			return err
 		}
 	}
 
-	if variableUpdated {
-		err = w.buf.WriteString(entry.VariableData)
-		if err != nil {
-			return err
+	return w.sync()
+}
+
+func (w *TelemetryReplayWriter) sync() error {
+	w.lastSync = time.Now()
+	if w.f == nil {
+		// streams are left to their writer
+		return nil
+	}
+
+	if err := w.f.Sync(); err != nil {
+		return fmt.Errorf("failed to sync file: %w", err)
+	}
+
+	return nil
+}
+
+// writeBlock compresses and writes the current block, or hands it to another goroutine when blocks
+// are compressed in parallel
+func (w *TelemetryReplayWriter) writeBlock() error {
+	if w.current.Entries == 0 {
+		return nil
+	}
+
+	var compress func() ([]byte, error)
+	if w.current.Columnar {
+		columnar := w.columnar
+		w.columnar = columnarBlock{}
+		compress = func() ([]byte, error) {
+			return columnar.encode(w.blockCodec)
 		}
+	} else {
+		data := bytes.Clone(w.block.Bytes())
+		w.block.Reset()
+		compress = func() ([]byte, error) {
+			return w.blockCodec.compress(data)
+		}
+	}
+
+	p := &pendingBlock{block: w.current, done: make(chan struct{})}
+	w.current = Block{}
+	if w.options.Concurrency <= 1 {
+		p.data, p.err = compress()
+		close(p.done)
+		return w.writeCompressed(p)
+	}
+
+	go func() {
+		defer close(p.done)
+		p.data, p.err = compress()
+	}()
+
+	w.inflight = append(w.inflight, p)
+	if len(w.inflight) >= w.options.Concurrency {
+		return w.writeOldest()
+	}
+
+	return nil
+}
+
+// writeOldest waits for the first block being compressed and writes it
+func (w *TelemetryReplayWriter) writeOldest() error {
+	p := w.inflight[0]
+	w.inflight = w.inflight[1:]
+	<-p.done
+	return w.writeCompressed(p)
+}
+
+func (w *TelemetryReplayWriter) writeCompressed(p *pendingBlock) error {
+	if p.err != nil {
+		return fmt.Errorf("failed to compress block: %w", p.err)
+	}
+
+	if len(p.data) > maxBlockLength {
+		// readers would take the block for a corrupt one
+		return fmt.Errorf("block of %d bytes is longer than %d bytes", len(p.data), maxBlockLength)
 	}
 
-	w.lastYamlData = entry.YamlData
-	w.lastVariableData = entry.VariableData
-	return w.buf.Flush()
+	b := p.block
+	b.Offset = w.offset
+	b.Length = len(p.data)
+	b.headerSize = blockHeaderSize
+
+	h := make([]byte, blockHeaderSize, blockHeaderSize+len(p.data))
+	putBlockHeader(h, &b, p.data)
+	if _, err := w.dst.Write(append(h, p.data...)); err != nil {
+		return fmt.Errorf("failed to write block: %w", err)
+	}
+
+	w.blocks = append(w.blocks, b)
+	w.offset = b.end()
+	if w.options.SyncInterval > 0 && time.Since(w.lastSync) >= w.options.SyncInterval {
+		return w.sync()
+	}
+
+	return nil
 }
 
+// Close writes the remaining blocks and the index, then closes the file
 func (w *TelemetryReplayWriter) Close() error {
-	if w.closeFunc == nil {
-		return nil
+	if !w.started {
+		if err := w.start(); err != nil {
+			w.blockCodec.close()
+			_ = w.closeDst()
+			return err
+		}
+	}
+
+	err := w.writeBlock()
+	for len(w.inflight) > 0 {
+		if werr := w.writeOldest(); err == nil {
+			err = werr
+		}
+	}
+
+	w.blockCodec.close()
+	if err == nil {
+		err = writeIndex(w.dst, w.offset, w.blocks)
+	}
+
+	if err == nil {
+		err = w.sync()
+	}
+
+	if err != nil {
+		_ = w.closeDst()
+		return err
+	}
+
+	return w.closeDst()
+}
+
+func (w *TelemetryReplayWriter) closeDst() error {
+	if c, ok := w.dst.(io.Closer); ok {
+		return c.Close()
 	}
 
-	return w.closeFunc()
+	return nil
 }
@@ -6,7 +6,12 @@ import (
 )
 
 var ErrNotImplemented = fmt.Errorf("not implemented - placeholder")
+var ErrNoValue = fmt.Errorf("no value")
 
+// SDK is implemented by the live SDK, MockSDK and the wrappers around them.
+// Implementations are safe for one writer and many readers: WaitForData, RefreshSession and Close
+// must be called from a single goroutine, every other method may be called concurrently with them.
+// Variables returned by the getters are snapshots and are never modified by the SDK afterwards.
 type SDK interface {
 	WaitForData(timeout time.Duration) (bool, error)
 	GetVars() ([]Variable, error)
@@ -14,9 +19,17 @@ type SDK interface {
 	GetVarValue(name string) (interface{}, error)
 	GetVarValues(name string) (interface{}, error)
 	RefreshSession() error
+	// GetLastVersion returns the tick count of the latest data, or -1 when not connected
 	GetLastVersion() int
 	IsConnected() bool
 	GetYaml() string
 	BroadcastMsg(msg Msg) error
 	Close() error
 }
+
+// SessionInfoVersioner is implemented by SDKs that track changes of the session info YAML
+type SessionInfoVersioner interface {
+	// GetSessionInfoVersion returns a counter that changes whenever the session info YAML changes,
+	// or -1 when not connected
+	GetSessionInfoVersion() int
+}
@@ -0,0 +1,104 @@
+package synth
+
+import (
+	"github.com/hfoxy/iracing-sdk"
+)
+
+// Builder assembles a Scenario in Go, as an alternative to a YAML scenario file. Sessions are numbered
+// in the order they are added.
+type Builder struct {
+	s Scenario
+}
+
+// NewScenario starts building a scenario on a track of the given length in km
+func NewScenario(track string, length float64) *Builder {
+	return &Builder{
+		s: Scenario{
+			Track: Track{Name: track, Length: length},
+			Weather: Weather{
+				AirTemp:   20,
+				TrackTemp: 30,
+				Skies:     1,
+				Humidity:  0.5,
+			},
+		},
+	}
+}
+
+func (b *Builder) TickRate(rate int) *Builder {
+	b.s.TickRate = rate
+	return b
+}
+
+func (b *Builder) SubSessionID(id int) *Builder {
+	b.s.SubSessionID = id
+	return b
+}
+
+func (b *Builder) Player(carIdx int) *Builder {
+	b.s.PlayerCarIdx = carIdx
+	return b
+}
+
+func (b *Builder) Weather(w Weather) *Builder {
+	b.s.Weather = w
+	return b
+}
+
+// WeatherChange replaces the weather at time seconds into session
+func (b *Builder) WeatherChange(session int, time float64, w Weather) *Builder {
+	b.s.WeatherChanges = append(b.s.WeatherChanges, WeatherChange{Session: session, Time: time, Weather: w})
+	return b
+}
+
+// Practice adds a practice session lasting duration seconds
+func (b *Builder) Practice(duration float64) *Builder {
+	b.s.Sessions = append(b.s.Sessions, Session{Type: "Practice", Duration: duration})
+	return b
+}
+
+// Qualify adds a qualifying session lasting duration seconds
+func (b *Builder) Qualify(duration float64) *Builder {
+	b.s.Sessions = append(b.s.Sessions, Session{Type: "Qualify", Duration: duration})
+	return b
+}
+
+// Race adds a race session of laps laps
+func (b *Builder) Race(laps int) *Builder {
+	b.s.Sessions = append(b.s.Sessions, Session{Type: "Race", Laps: laps})
+	return b
+}
+
+// Driver adds a car, its CarIdx is the number of drivers added before it
+func (b *Builder) Driver(d Driver) *Builder {
+	b.s.Drivers = append(b.s.Drivers, d)
+	return b
+}
+
+// Flag shows a session flag from start until end seconds into session
+func (b *Builder) Flag(session int, flag irsdk.Flag, start, end float64) *Builder {
+	b.s.Flags = append(b.s.Flags, FlagPeriod{Session: session, Start: start, End: end, Flag: flag.String()})
+	return b
+}
+
+// CarFlag shows a flag to a single car from start until end seconds into session
+func (b *Builder) CarFlag(session, carIdx int, flag irsdk.Flag, start, end float64) *Builder {
+	b.s.Flags = append(b.s.Flags, FlagPeriod{Session: session, Start: start, End: end, Flag: flag.String(), CarIdx: &carIdx})
+	return b
+}
+
+// Incident gives a car incident points at time seconds into session
+func (b *Builder) Incident(session int, time float64, carIdx, points int) *Builder {
+	b.s.Incidents = append(b.s.Incidents, Incident{Session: session, Time: time, CarIdx: carIdx, Points: points})
+	return b
+}
+
+// Build validates and returns the scenario
+func (b *Builder) Build() (*Scenario, error) {
+	s := b.s
+	if err := s.Validate(); err != nil {
+		return nil, err
+	}
+
+	return &s, nil
+}
@@ -0,0 +1,682 @@
+package synth
+
+import (
+	"cmp"
+	"fmt"
+	"math"
+	"slices"
+	"sort"
+
+	"github.com/hfoxy/iracing-sdk"
+)
+
+const (
+	// a pitting car enters the pit lane at pitEntryPct of the lap and stops in its stall at pitStallPct
+	pitEntryPct = 0.9
+	pitStallPct = 0.95
+
+	// cooldownTime is the number of seconds a race session continues after the last car finished
+	cooldownTime = 30.0
+)
+
+// irsdk_SessionState values
+const (
+	sessionStateRacing    = 4
+	sessionStateCheckered = 5
+	sessionStateCoolDown  = 6
+)
+
+// irsdk_TrkLoc values
+const (
+	trackNotInWorld     = -1
+	trackInPitStall     = 1
+	trackApproachingPit = 2
+	trackOnTrack        = 3
+)
+
+// flags that replace the green flag while they are shown
+const cautionFlags = irsdk.FlagYellow | irsdk.FlagYellowWaving | irsdk.FlagCaution | irsdk.FlagCautionWaving | irsdk.FlagRed
+
+type lapPlan struct {
+	start float64 // session time the lap started at
+	base  float64 // lap time without the pit stop
+	pit   float64 // seconds stopped in the pit stall
+}
+
+func (l lapPlan) end() float64 {
+	return l.start + l.base + l.pit
+}
+
+type carPlan struct {
+	laps []lapPlan // laps[i] is lap i+1
+
+	finishLaps int     // laps completed when taking the checkered flag
+	finishTime float64 // session time the car took the checkered flag, +Inf if it never does
+}
+
+type sessionPlan struct {
+	offset float64 // scenario time the session starts at
+	end    float64 // session time the session ends at
+	finish float64 // session time the leader takes the checkered flag, +Inf outside of races
+	cars   []carPlan
+}
+
+type carState struct {
+	carIdx    int
+	lap       int
+	completed int
+	pct       float64
+	pitRoad   bool
+	surface   int
+	speed     float64
+	last      float64 // -1 before the first lap was completed
+	best      float64 // -1 before the first lap was completed
+	bestLap   int
+	finished  bool
+}
+
+// yamlKey identifies everything the session info depends on, the YAML is only rendered again when it changes
+type yamlKey struct {
+	session   int
+	weather   int
+	swaps     int
+	incidents int
+	laps      int
+	ended     bool
+}
+
+type scenarioGenerator struct {
+	s     *Scenario
+	plans []sessionPlan
+	total float64
+	tick  int
+
+	yamlKey yamlKey
+	yaml    string
+}
+
+// NewScenarioGenerator validates s and creates a Generator playing it. Every tick is computed from the
+// scenario alone, so two generators of the same scenario produce identical frames.
+func NewScenarioGenerator(s *Scenario) (Generator, error) {
+	if err := s.Validate(); err != nil {
+		return nil, err
+	}
+
+	g := &scenarioGenerator{
+		s:       s,
+		tick:    -1,
+		yamlKey: yamlKey{session: -1},
+	}
+
+	for num := range s.Sessions {
+		p := g.plan(num)
+		p.offset = g.total
+		g.total += p.end
+		g.plans = append(g.plans, p)
+	}
+
+	return g, nil
+}
+
+func (g *scenarioGenerator) TickRate() int {
+	return g.s.TickRate
+}
+
+func (g *scenarioGenerator) Step() bool {
+	if g.time() >= g.total {
+		return false
+	}
+
+	g.tick++
+	return g.time() < g.total
+}
+
+// time returns the scenario time of the current tick
+func (g *scenarioGenerator) time() float64 {
+	return float64(g.tick) / float64(g.s.TickRate)
+}
+
+func (g *scenarioGenerator) lapTime(carIdx, lap int) float64 {
+	d := g.s.Drivers[carIdx]
+	if lap <= len(d.LapTimes) {
+		return d.LapTimes[lap-1]
+	}
+
+	return d.LapTime
+}
+
+func (g *scenarioGenerator) pitTime(carIdx, session, lap int) float64 {
+	for _, p := range g.s.Drivers[carIdx].PitStops {
+		if p.Session == session && p.Lap == lap {
+			return p.Duration
+		}
+	}
+
+	return 0
+}
+
+// addLap plans the next lap of a car
+func (g *scenarioGenerator) addLap(car *carPlan, carIdx, session int) {
+	l := lapPlan{}
+	if len(car.laps) > 0 {
+		l.start = car.laps[len(car.laps)-1].end()
+	}
+
+	lap := len(car.laps) + 1
+	l.base = g.lapTime(carIdx, lap)
+	l.pit = g.pitTime(carIdx, session, lap)
+	car.laps = append(car.laps, l)
+}
+
+// extend plans the laps of a car until one ends at or after until
+func (g *scenarioGenerator) extend(car *carPlan, carIdx, session int, until float64) {
+	for len(car.laps) == 0 || car.laps[len(car.laps)-1].end() < until {
+		g.addLap(car, carIdx, session)
+	}
+}
+
+func (g *scenarioGenerator) plan(num int) sessionPlan {
+	session := g.s.Sessions[num]
+	p := sessionPlan{
+		finish: math.Inf(1),
+		cars:   make([]carPlan, len(g.s.Drivers)),
+	}
+
+	for i := range p.cars {
+		p.cars[i].finishTime = math.Inf(1)
+	}
+
+	if !session.isRace() {
+		p.end = session.Duration
+		for i := range p.cars {
+			g.extend(&p.cars[i], i, num, p.end)
+		}
+
+		return p
+	}
+
+	for i := range p.cars {
+		car := &p.cars[i]
+		for len(car.laps) < session.Laps {
+			g.addLap(car, i, num)
+		}
+
+		p.finish = min(p.finish, car.laps[session.Laps-1].end())
+	}
+
+	// every car takes the checkered flag the first time it crosses the line after the leader
+	for i := range p.cars {
+		car := &p.cars[i]
+		g.extend(car, i, num, p.finish)
+		for lap, l := range car.laps {
+			if l.end() >= p.finish {
+				car.finishLaps = lap + 1
+				car.finishTime = l.end()
+				break
+			}
+		}
+
+		p.end = max(p.end, car.finishTime)
+	}
+
+	p.end += cooldownTime
+	for i := range p.cars {
+		g.extend(&p.cars[i], i, num, p.end)
+	}
+
+	return p
+}
+
+// car returns the state of a car at session time t
+func (p *sessionPlan) car(s *Scenario, carIdx int, t float64) carState {
+	laps := p.cars[carIdx].laps
+	i := sort.Search(len(laps), func(i int) bool {
+		return laps[i].end() > t
+	})
+
+	i = min(i, len(laps)-1)
+	l := laps[i]
+	state := carState{
+		carIdx:    carIdx,
+		lap:       i + 1,
+		completed: i,
+		surface:   trackOnTrack,
+		speed:     s.Track.Length * 1000 / l.base,
+		last:      -1,
+		best:      -1,
+		finished:  p.cars[carIdx].finishTime <= t,
+	}
+
+	elapsed := t - l.start
+	stall := l.base * pitStallPct
+	switch {
+	case l.pit == 0 || elapsed < stall:
+		state.pct = elapsed / l.base
+	case elapsed < stall+l.pit:
+		state.pct = pitStallPct
+		state.speed = 0
+		state.surface = trackInPitStall
+	default:
+		state.pct = (elapsed - l.pit) / l.base
+	}
+
+	state.pct = min(max(state.pct, 0), 1)
+	if l.pit > 0 && state.pct >= pitEntryPct {
+		state.pitRoad = true
+		if state.surface == trackOnTrack {
+			state.surface = trackApproachingPit
+		}
+	}
+
+	for lap := 0; lap < i; lap++ {
+		d := laps[lap].end() - laps[lap].start
+		state.last = d
+		if state.best < 0 || d < state.best {
+			state.best = d
+			state.bestLap = lap + 1
+		}
+	}
+
+	return state
+}
+
+// order sorts cars by position. Races are ordered by distance, with finished cars ordered by the
+// laps they completed and the time they took the checkered flag. Other sessions are ordered by best lap.
+func (p *sessionPlan) order(race bool, cars []carState) []carState {
+	order := slices.Clone(cars)
+	slices.SortStableFunc(order, func(a, b carState) int {
+		if !race {
+			if (a.best < 0) != (b.best < 0) {
+				if a.best < 0 {
+					return 1
+				}
+
+				return -1
+			}
+
+			return cmp.Compare(a.best, b.best)
+		}
+
+		da, db := p.distance(a), p.distance(b)
+		if da != db {
+			return -cmp.Compare(da, db)
+		}
+
+		if a.finished != b.finished {
+			if a.finished {
+				return -1
+			}
+
+			return 1
+		}
+
+		return cmp.Compare(p.cars[a.carIdx].finishTime, p.cars[b.carIdx].finishTime)
+	})
+
+	return order
+}
+
+func (p *sessionPlan) distance(c carState) float64 {
+	if c.finished {
+		return float64(p.cars[c.carIdx].finishLaps)
+	}
+
+	return float64(c.completed) + c.pct
+}
+
+// locate returns the session and session time at scenario time t
+func (g *scenarioGenerator) locate(t float64) (int, float64) {
+	for num := range g.plans {
+		if t < g.plans[num].offset+g.plans[num].end || num == len(g.plans)-1 {
+			return num, t - g.plans[num].offset
+		}
+	}
+
+	return 0, t
+}
+
+func before(session int, t float64, atSession int, at float64) bool {
+	return session < atSession || (session == atSession && t <= at)
+}
+
+func (g *scenarioGenerator) weather(num int, t float64) (Weather, int) {
+	w, idx := g.s.Weather, -1
+	for i, change := range g.s.WeatherChanges {
+		if !before(change.Session, change.Time, num, t) {
+			continue
+		}
+
+		if idx < 0 || before(g.s.WeatherChanges[idx].Session, g.s.WeatherChanges[idx].Time, change.Session, change.Time) {
+			w, idx = change.Weather, i
+		}
+	}
+
+	return w, idx
+}
+
+// incidents returns the incident points of every car in session num up to session time t, incident counts
+// start over with every session
+func (g *scenarioGenerator) incidents(num int, t float64) ([]int, int) {
+	counts := make([]int, len(g.s.Drivers))
+	applied := 0
+	for _, incident := range g.s.Incidents {
+		if incident.Session == num && incident.Time <= t {
+			counts[incident.CarIdx] += incident.Points
+			applied++
+		}
+	}
+
+	return counts, applied
+}
+
+// driver returns the driver of a car on lap of session num, after any driver swaps
+func (g *scenarioGenerator) driver(carIdx, num, lap int) (Driver, int) {
+	d := g.s.Drivers[carIdx]
+	applied := 0
+	var latest *DriverSwap
+	for i := range d.Swaps {
+		sw := &d.Swaps[i]
+		if !before(sw.Session, float64(sw.Lap), num, float64(lap)) {
+			continue
+		}
+
+		applied++
+		if latest == nil || before(latest.Session, float64(latest.Lap), sw.Session, float64(sw.Lap)) {
+			latest = sw
+		}
+	}
+
+	if latest != nil {
+		d.Name = latest.Name
+		if latest.UserID != 0 {
+			d.UserID = latest.UserID
+		}
+	}
+
+	return d, applied
+}
+
+func (g *scenarioGenerator) Frame() Frame {
+	num, t := g.locate(g.time())
+	session := g.s.Sessions[num]
+	p := &g.plans[num]
+	race := session.isRace()
+
+	cars := make([]carState, len(g.s.Drivers))
+	laps := 0
+	for i := range cars {
+		cars[i] = p.car(g.s, i, t)
+		laps += cars[i].completed
+	}
+
+	order := p.order(race, cars)
+	positions := make([]int, maxCars)
+	for pos, c := range order {
+		positions[c.carIdx] = pos + 1
+	}
+
+	leader := order[0]
+	weather, weatherIdx := g.weather(num, t)
+	incidents, incidentCount := g.incidents(num, t)
+
+	swaps := 0
+	drivers := make([]Driver, len(cars))
+	for i, c := range cars {
+		var applied int
+		drivers[i], applied = g.driver(i, num, c.lap)
+		swaps += applied
+	}
+
+	key := yamlKey{session: num, weather: weatherIdx, swaps: swaps, incidents: incidentCount, laps: laps, ended: t >= p.end}
+	if key != g.yamlKey {
+		// the session info is left unchanged when it cannot be marshalled and retried on the next frame
+		if y, err := g.sessionInfo(num, t, weather, drivers, incidents).marshal(); err == nil {
+			g.yaml = y
+			g.yamlKey = key
+		}
+	}
+
+	sessionFlags, carFlags := g.flags(num, p, t, leader)
+
+	state := sessionStateRacing
+	if race && t >= p.finish {
+		state = sessionStateCheckered
+		if t >= p.end-cooldownTime {
+			state = sessionStateCoolDown
+		}
+	}
+
+	lapsRemain := 32767
+	if race {
+		lapsRemain = max(session.Laps-leader.completed, 0)
+	}
+
+	player := cars[g.s.PlayerCarIdx]
+	b := &varBuilder{}
+	b.double("SessionTime", "Seconds since session start", "s", t)
+	b.int("SessionTick", "Current update number", "", int(math.Round(t*float64(g.s.TickRate))))
+	b.int("SessionNum", "Session number", "", num)
+	b.int("SessionState", "Session state", "irsdk_SessionState", state)
+	b.bitField("SessionFlags", "Session flags", sessionFlags)
+	b.double("SessionTimeRemain", "Seconds left till session ends", "s", max(p.end-t, 0))
+	b.int("SessionLapsRemainEx", "New improved laps left till session ends", "", lapsRemain)
+	b.int("PlayerCarIdx", "Players carIdx", "", g.s.PlayerCarIdx)
+	b.int("PlayerCarPosition", "Players position in race", "", positions[g.s.PlayerCarIdx])
+	b.int("PlayerCarClassPosition", "Players class position in race", "", positions[g.s.PlayerCarIdx])
+	b.int("PlayerCarMyIncidentCount", "Players own incident count for this session", "", incidents[g.s.PlayerCarIdx])
+	b.int("PlayerCarTeamIncidentCount", "Players team incident count for this session", "", incidents[g.s.PlayerCarIdx])
+	b.int("PlayerTrackSurface", "Players car track surface type", "irsdk_TrkLoc", player.surface)
+	b.int("Lap", "Laps started count", "", player.lap)
+	b.int("LapCompleted", "Laps completed count", "", player.completed)
+	b.float("LapDistPct", "Percentage distance around lap", "%", player.pct)
+	b.float("LapDist", "Meters traveled from S/F this lap", "m", player.pct*g.s.Track.Length*1000)
+	b.float("LapLastLapTime", "Players last lap time", "s", player.last)
+	b.float("LapBestLapTime", "Players best lap time", "s", player.best)
+	b.bool("OnPitRoad", "Is the player car on pit road between the cones", player.pitRoad)
+	b.float("Speed", "GPS vehicle speed", "m/s", player.speed)
+	b.float("AirTemp", "Temperature of air at start/finish line", "C", weather.AirTemp)
+	b.float("TrackTempCrew", "Temperature of track measured by crew around track", "C", weather.TrackTemp)
+	b.float("TrackTemp", "Deprecated  set to TrackTempCrew", "C", weather.TrackTemp)
+	b.int("Skies", "Skies (0=clear/1=p cloudy/2=m cloudy/3=overcast)", "", weather.Skies)
+	b.float("WindVel", "Wind velocity at start/finish line", "m/s", weather.WindVel)
+	b.float("RelativeHumidity", "Relative Humidity", "%", weather.Humidity)
+
+	lap := filled(maxCars, -1)
+	lapCompleted := filled(maxCars, -1)
+	lapDistPct := filled(maxCars, -1.0)
+	lastLapTime := filled(maxCars, -1.0)
+	bestLapTime := filled(maxCars, -1.0)
+	surface := filled(maxCars, trackNotInWorld)
+	onPitRoad := make([]bool, maxCars)
+	for i, c := range cars {
+		lap[i] = c.lap
+		lapCompleted[i] = c.completed
+		lapDistPct[i] = c.pct
+		lastLapTime[i] = c.last
+		bestLapTime[i] = c.best
+		surface[i] = c.surface
+		onPitRoad[i] = c.pitRoad
+	}
+
+	b.ints("CarIdxLap", "Laps started by car index", "", lap)
+	b.ints("CarIdxLapCompleted", "Laps completed by car index", "", lapCompleted)
+	b.floats("CarIdxLapDistPct", "Percentage distance around lap by car index", "%", lapDistPct)
+	b.ints("CarIdxTrackSurface", "Track surface type by car index", "irsdk_TrkLoc", surface)
+	b.bools("CarIdxOnPitRoad", "On pit road between the cones by car index", onPitRoad)
+	b.ints("CarIdxPosition", "Cars position in race by car index", "", positions)
+	b.ints("CarIdxClassPosition", "Cars class position in race by car index", "", positions)
+	b.bitFields("CarIdxSessionFlags", "Session flags for each player", carFlags)
+	b.floats("CarIdxLastLapTime", "Cars last lap time", "s", lastLapTime)
+	b.floats("CarIdxBestLapTime", "Cars best lap time", "s", bestLapTime)
+
+	return Frame{
+		Variables: b.vars,
+		Yaml:      g.yaml,
+	}
+}
+
+// flags returns the session and per car flags. Green is shown while racing, white once the leader
+// started the last lap of a race and checkered once the leader finished; cautions replace the green flag.
+func (g *scenarioGenerator) flags(num int, p *sessionPlan, t float64, leader carState) (irsdk.Flag, []irsdk.Flag) {
+	session := irsdk.FlagGreen
+	if g.s.Sessions[num].isRace() {
+		switch {
+		case t >= p.finish:
+			session = irsdk.FlagCheckered
+		case leader.lap >= g.s.Sessions[num].Laps:
+			session |= irsdk.FlagWhite
+		}
+	}
+
+	cars := make([]irsdk.Flag, maxCars)
+	for _, f := range g.s.Flags {
+		if f.Session != num || t < f.Start || t >= f.End {
+			continue
+		}
+
+		if f.CarIdx == nil {
+			session |= f.flag
+		} else {
+			cars[*f.CarIdx] |= f.flag
+		}
+	}
+
+	if session&cautionFlags != 0 {
+		session &^= irsdk.FlagGreen
+	}
+
+	return session, cars
+}
+
+func (g *scenarioGenerator) sessionInfo(num int, t float64, weather Weather, drivers []Driver, incidents []int) *sessionInfoYaml {
+	info := &sessionInfoYaml{
+		WeekendInfo: weekendInfoYaml{
+			TrackName:             g.s.Track.Name,
+			TrackID:               g.s.Track.ID,
+			TrackLength:           fmt.Sprintf("%.2f km", g.s.Track.Length),
+			TrackDisplayName:      g.s.Track.DisplayName,
+			TrackConfigName:       g.s.Track.Config,
+			TrackAirTemp:          fmt.Sprintf("%.2f C", weather.AirTemp),
+			TrackSurfaceTemp:      fmt.Sprintf("%.2f C", weather.TrackTemp),
+			TrackSkies:            skies[min(max(weather.Skies, 0), len(skies)-1)],
+			TrackWindVel:          fmt.Sprintf("%.2f m/s", weather.WindVel),
+			TrackRelativeHumidity: fmt.Sprintf("%d %%", int(math.Round(weather.Humidity*100))),
+			SubSessionID:          g.s.SubSessionID,
+			EventType:             "Race",
+			Category:              "Road",
+			SimMode:               "full",
+		},
+		DriverInfo: driverInfoYaml{
+			DriverCarIdx: g.s.PlayerCarIdx,
+			DriverUserID: drivers[g.s.PlayerCarIdx].UserID,
+			PaceCarIdx:   -1,
+		},
+	}
+
+	for i, session := range g.s.Sessions {
+		sy := sessionYaml{
+			SessionNum:  i,
+			SessionLaps: sessionLaps(session.Laps),
+			SessionTime: sessionTime(session.Duration),
+			SessionType: session.Type,
+			SessionName: session.Name,
+		}
+
+		switch {
+		case i < num:
+			g.results(&sy, i, g.plans[i].end)
+		case i == num:
+			g.results(&sy, i, t)
+		}
+
+		info.SessionInfo.Sessions = append(info.SessionInfo.Sessions, sy)
+	}
+
+	for i, d := range drivers {
+		info.DriverInfo.Drivers = append(info.DriverInfo.Drivers, driverYaml{
+			CarIdx:                 i,
+			UserName:               d.Name,
+			AbbrevName:             d.Name,
+			Initials:               initials(d.Name),
+			UserID:                 d.UserID,
+			TeamID:                 g.s.Drivers[i].UserID,
+			TeamName:               d.Team,
+			CarNumber:              d.CarNumber,
+			CarNumberRaw:           carNumberRaw(d.CarNumber),
+			CarScreenName:          d.Car,
+			IRating:                d.IRating,
+			LicString:              d.License,
+			CurDriverIncidentCount: incidents[i],
+			TeamIncidentCount:      incidents[i],
+		})
+	}
+
+	return info
+}
+
+var skies = []string{"Clear", "Partly Cloudy", "Mostly Cloudy", "Overcast"}
+
+// results fills in the results of session num at session time t
+func (g *scenarioGenerator) results(sy *sessionYaml, num int, t float64) {
+	p := &g.plans[num]
+	incidents, _ := g.incidents(num, t)
+	cars := make([]carState, len(g.s.Drivers))
+	for i := range cars {
+		cars[i] = p.car(g.s, i, t)
+	}
+
+	for _, c := range p.order(g.s.Sessions[num].isRace(), cars) {
+		completed := c.completed
+		if c.finished {
+			completed = p.cars[c.carIdx].finishLaps
+		}
+
+		if completed == 0 {
+			continue
+		}
+
+		sy.ResultsPositions = append(sy.ResultsPositions, resultPosYaml{
+			Position:      len(sy.ResultsPositions) + 1,
+			ClassPosition: len(sy.ResultsPositions),
+			CarIdx:        c.carIdx,
+			Lap:           completed,
+			FastestLap:    c.bestLap,
+			FastestTime:   c.best,
+			LastTime:      c.last,
+			LapsComplete:  completed,
+			ReasonOutStr:  "Running",
+			Incidents:     incidents[c.carIdx],
+			LapsDriven:    float64(completed),
+		})
+
+		if len(sy.ResultsFastest) == 0 || c.best < sy.ResultsFastest[0].FastestTime {
+			sy.ResultsFastest = []resultFastestYaml{{CarIdx: c.carIdx, FastestLap: c.bestLap, FastestTime: c.best}}
+		}
+	}
+
+	if len(sy.ResultsPositions) > 0 {
+		sy.ResultsLapsDone = sy.ResultsPositions[0].LapsComplete
+	}
+
+	if t >= p.end {
+		sy.ResultsOfficial = 1
+	}
+}
+
+func carNumberRaw(number string) int {
+	var n int
+	if _, err := fmt.Sscanf(number, "%d", &n); err != nil {
+		return -1
+	}
+
+	return n
+}
+
+func filled[T any](n int, v T) []T {
+	s := make([]T, n)
+	for i := range s {
+		s[i] = v
+	}
+
+	return s
+}
@@ -0,0 +1,269 @@
+package synth
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/go-yaml/yaml"
+	"github.com/hfoxy/iracing-sdk"
+)
+
+// Scenario declaratively describes a synthetic event: the track, weather, sessions and drivers,
+// and the lap times, pit stops, driver swaps, flags and incidents that happen during it.
+// Times are in seconds of session time, laps are counted from 1.
+type Scenario struct {
+	TickRate     int     `yaml:"tickRate"` // defaults to 60
+	SubSessionID int     `yaml:"subSessionId"`
+	PlayerCarIdx int     `yaml:"playerCarIdx"`
+	Track        Track   `yaml:"track"`
+	Weather      Weather `yaml:"weather"`
+
+	WeatherChanges []WeatherChange `yaml:"weatherChanges"`
+	Sessions       []Session       `yaml:"sessions"`
+	Drivers        []Driver        `yaml:"drivers"` // the index of a driver is its CarIdx
+	Flags          []FlagPeriod    `yaml:"flags"`
+	Incidents      []Incident      `yaml:"incidents"`
+}
+
+type Track struct {
+	ID          int     `yaml:"id"`
+	Name        string  `yaml:"name"`
+	DisplayName string  `yaml:"displayName"`
+	Config      string  `yaml:"config"`
+	Length      float64 `yaml:"length"` // km
+}
+
+type Weather struct {
+	AirTemp   float64 `yaml:"airTemp"`   // C
+	TrackTemp float64 `yaml:"trackTemp"` // C
+	Skies     int     `yaml:"skies"`     // 0 clear, 1 partly cloudy, 2 mostly cloudy, 3 overcast
+	WindVel   float64 `yaml:"windVel"`   // m/s
+	Humidity  float64 `yaml:"humidity"`  // 0 to 1
+}
+
+// WeatherChange replaces the weather from Time in Session onwards
+type WeatherChange struct {
+	Session int     `yaml:"session"`
+	Time    float64 `yaml:"time"`
+	Weather Weather `yaml:"weather"`
+}
+
+// Session is a practice or qualifying session run for Duration seconds, or a race run for Laps laps
+type Session struct {
+	Type     string  `yaml:"type"` // Practice, Qualify or Race
+	Name     string  `yaml:"name"`
+	Laps     int     `yaml:"laps"`
+	Duration float64 `yaml:"duration"`
+}
+
+func (s Session) isRace() bool {
+	return s.Type == "Race"
+}
+
+type Driver struct {
+	Name      string `yaml:"name"`
+	UserID    int    `yaml:"userId"`
+	Team      string `yaml:"team"`
+	CarNumber string `yaml:"carNumber"`
+	Car       string `yaml:"car"`
+	IRating   int    `yaml:"iRating"`
+	License   string `yaml:"license"`
+
+	LapTime  float64   `yaml:"lapTime"`  // seconds, used for every lap without an entry in LapTimes
+	LapTimes []float64 `yaml:"lapTimes"` // seconds per lap, shared by every session
+
+	PitStops []PitStop    `yaml:"pitStops"`
+	Swaps    []DriverSwap `yaml:"swaps"`
+}
+
+// PitStop stops the car in its pit stall for Duration seconds near the end of Lap
+type PitStop struct {
+	Session  int     `yaml:"session"`
+	Lap      int     `yaml:"lap"`
+	Duration float64 `yaml:"duration"`
+}
+
+// DriverSwap hands the car to another driver at the start of Lap
+type DriverSwap struct {
+	Session int    `yaml:"session"`
+	Lap     int    `yaml:"lap"`
+	Name    string `yaml:"name"`
+	UserID  int    `yaml:"userId"`
+}
+
+// FlagPeriod shows Flag, e.g. "caution|caution waving", from Start until End. It is a session flag
+// unless CarIdx is set.
+type FlagPeriod struct {
+	Session int     `yaml:"session"`
+	Start   float64 `yaml:"start"`
+	End     float64 `yaml:"end"`
+	Flag    string  `yaml:"flag"`
+	CarIdx  *int    `yaml:"carIdx"`
+
+	flag irsdk.Flag
+}
+
+type Incident struct {
+	Session int     `yaml:"session"`
+	Time    float64 `yaml:"time"`
+	CarIdx  int     `yaml:"carIdx"`
+	Points  int     `yaml:"points"`
+}
+
+// LoadScenario reads a YAML scenario file
+func LoadScenario(fileName string) (*Scenario, error) {
+	data, err := os.ReadFile(fileName)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read scenario: %w", err)
+	}
+
+	return ParseScenario(data)
+}
+
+// ParseScenario parses and validates a YAML scenario
+func ParseScenario(data []byte) (*Scenario, error) {
+	s := &Scenario{}
+	if err := yaml.UnmarshalStrict(data, s); err != nil {
+		return nil, fmt.Errorf("failed to parse scenario: %w", err)
+	}
+
+	if err := s.Validate(); err != nil {
+		return nil, err
+	}
+
+	return s, nil
+}
+
+// Validate checks the scenario and fills in defaults
+func (s *Scenario) Validate() error {
+	if s.TickRate == 0 {
+		s.TickRate = 60
+	}
+
+	if s.TickRate < 0 {
+		return fmt.Errorf("invalid tick rate: %d", s.TickRate)
+	}
+
+	if s.Track.Length <= 0 {
+		return fmt.Errorf("track length must be positive")
+	}
+
+	if s.Track.DisplayName == "" {
+		s.Track.DisplayName = s.Track.Name
+	}
+
+	if len(s.Sessions) == 0 {
+		return fmt.Errorf("scenario has no sessions")
+	}
+
+	for i := range s.Sessions {
+		session := &s.Sessions[i]
+		switch session.Type {
+		case "Race":
+			if session.Laps <= 0 {
+				return fmt.Errorf("session %d: race needs a lap count", i)
+			}
+		case "Practice", "Qualify":
+			if session.Duration <= 0 {
+				return fmt.Errorf("session %d: %s needs a duration", i, session.Type)
+			}
+		default:
+			return fmt.Errorf("session %d: unknown session type %q", i, session.Type)
+		}
+
+		if session.Name == "" {
+			session.Name = session.Type
+		}
+	}
+
+	if len(s.Drivers) == 0 || len(s.Drivers) > maxCars {
+		return fmt.Errorf("scenario needs between 1 and %d drivers, got %d", maxCars, len(s.Drivers))
+	}
+
+	if s.PlayerCarIdx < 0 || s.PlayerCarIdx >= len(s.Drivers) {
+		return fmt.Errorf("player car %d is not a driver", s.PlayerCarIdx)
+	}
+
+	for i := range s.Drivers {
+		d := &s.Drivers[i]
+		if d.LapTime <= 0 {
+			return fmt.Errorf("driver %d: lap time must be positive", i)
+		}
+
+		for _, t := range d.LapTimes {
+			if t <= 0 {
+				return fmt.Errorf("driver %d: lap times must be positive", i)
+			}
+		}
+
+		if d.CarNumber == "" {
+			d.CarNumber = fmt.Sprintf("%d", i+1)
+		}
+
+		if d.UserID == 0 {
+			d.UserID = 1000 + i
+		}
+
+		if d.Team == "" {
+			d.Team = d.Name
+		}
+
+		if d.License == "" {
+			d.License = "A 4.99"
+		}
+
+		for _, p := range d.PitStops {
+			if p.Session < 0 || p.Session >= len(s.Sessions) || p.Lap < 1 || p.Duration < 0 {
+				return fmt.Errorf("driver %d: invalid pit stop %+v", i, p)
+			}
+		}
+
+		for _, sw := range d.Swaps {
+			if sw.Session < 0 || sw.Session >= len(s.Sessions) || sw.Lap < 1 || sw.Name == "" {
+				return fmt.Errorf("driver %d: invalid driver swap %+v", i, sw)
+			}
+		}
+	}
+
+	for i := range s.Flags {
+		f := &s.Flags[i]
+		flag, err := irsdk.ParseFlag(f.Flag)
+		if err != nil {
+			return fmt.Errorf("flag %d: %w", i, err)
+		}
+
+		if f.Session < 0 || f.Session >= len(s.Sessions) || f.End <= f.Start {
+			return fmt.Errorf("flag %d: invalid period %+v", i, *f)
+		}
+
+		if f.CarIdx != nil && (*f.CarIdx < 0 || *f.CarIdx >= len(s.Drivers)) {
+			return fmt.Errorf("flag %d: car %d is not a driver", i, *f.CarIdx)
+		}
+
+		f.flag = flag
+	}
+
+	for i, incident := range s.Incidents {
+		if incident.Session < 0 || incident.Session >= len(s.Sessions) || incident.CarIdx < 0 || incident.CarIdx >= len(s.Drivers) {
+			return fmt.Errorf("incident %d: invalid incident %+v", i, incident)
+		}
+	}
+
+	for i, change := range s.WeatherChanges {
+		if change.Session < 0 || change.Session >= len(s.Sessions) {
+			return fmt.Errorf("weather change %d: invalid session %d", i, change.Session)
+		}
+	}
+
+	return nil
+}
+
+// NewScenarioSDK validates s and creates an SDK playing it
+func NewScenarioSDK(s *Scenario, opts Options) (*SDK, error) {
+	gen, err := NewScenarioGenerator(s)
+	if err != nil {
+		return nil, err
+	}
+
+	return New(gen, opts), nil
+}
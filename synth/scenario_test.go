@@ -0,0 +1,216 @@
+package synth
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/hfoxy/iracing-sdk"
+)
+
+const testScenario = `
+tickRate: 10
+track:
+  name: spa
+  length: 7.004
+sessions:
+  - type: Race
+    laps: 3
+drivers:
+  - name: Alice Smith
+    lapTime: 60
+  - name: Bob Jones
+    lapTime: 61
+    pitStops:
+      - {session: 0, lap: 2, duration: 20}
+    swaps:
+      - {session: 0, lap: 3, name: Carol White}
+  - name: Dan Brown
+    lapTime: 62
+flags:
+  - {session: 0, start: 150, end: 170, flag: caution|caution waving}
+incidents:
+  - {session: 0, time: 30, carIdx: 0, points: 2}
+`
+
+func intValue(t *testing.T, sdk irsdk.SDK, name string) int {
+	t.Helper()
+
+	v, err := sdk.GetVarValue(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return v.(int)
+}
+
+func intValues(t *testing.T, sdk irsdk.SDK, name string) []int {
+	t.Helper()
+
+	v, err := sdk.GetVarValues(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	values := make([]int, 0)
+	for _, value := range v.([]any) {
+		values = append(values, value.(int))
+	}
+
+	return values
+}
+
+// stepTo steps sdk until SessionTime reaches seconds
+func stepTo(t *testing.T, sdk *SDK, seconds float64) {
+	t.Helper()
+
+	for {
+		v, err := sdk.GetVarValue("SessionTime")
+		if err == nil && v.(float64) >= seconds {
+			return
+		}
+
+		if !sdk.Step() {
+			t.Fatalf("scenario ended before %.1fs", seconds)
+		}
+	}
+}
+
+func TestScenarioRace(t *testing.T) {
+	s, err := ParseScenario([]byte(testScenario))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	sdk, err := NewScenarioSDK(s, Options{Clock: irsdk.NewManualClock(time.Unix(0, 0))})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	flags := func() irsdk.Flag {
+		return irsdk.Flag(intValue(t, sdk, "SessionFlags"))
+	}
+
+	stepTo(t, sdk, 30)
+	if f := flags(); f != irsdk.FlagGreen {
+		t.Errorf("expected green at 30s, got %s", f)
+	}
+
+	if lap := intValue(t, sdk, "Lap"); lap != 1 {
+		t.Errorf("expected lap 1, got %d", lap)
+	}
+
+	if n := intValue(t, sdk, "PlayerCarMyIncidentCount"); n != 2 {
+		t.Errorf("expected 2 incidents, got %d", n)
+	}
+
+	// bob stops in his stall 0.95 of the way through lap 2
+	stepTo(t, sdk, 61+61*pitStallPct+1)
+	if surface := intValues(t, sdk, "CarIdxTrackSurface")[1]; surface != trackInPitStall {
+		t.Errorf("expected car 1 in its pit stall, got track surface %d", surface)
+	}
+
+	if !strings.Contains(sdk.GetYaml(), "UserName: Bob Jones") {
+		t.Errorf("expected bob to drive before the swap")
+	}
+
+	version := sdk.GetSessionInfoVersion()
+
+	stepTo(t, sdk, 125)
+	if f := flags(); f != irsdk.FlagGreen|irsdk.FlagWhite {
+		t.Errorf("expected green and white on the last lap, got %s", f)
+	}
+
+	stepTo(t, sdk, 155)
+	if f := flags(); f != irsdk.FlagWhite|irsdk.FlagCaution|irsdk.FlagCautionWaving {
+		t.Errorf("expected a caution on the last lap, got %s", f)
+	}
+
+	// bob starts lap 3 after his pit stop at 142s
+	if !strings.Contains(sdk.GetYaml(), "UserName: Carol White") {
+		t.Errorf("expected carol to drive after the swap")
+	}
+
+	if sdk.GetSessionInfoVersion() <= version {
+		t.Errorf("expected the session info version to change after the swap")
+	}
+
+	stepTo(t, sdk, 180)
+	if f := flags(); f != irsdk.FlagCheckered {
+		t.Errorf("expected checkered once the leader finished, got %s", f)
+	}
+
+	// bob loses second place to dan with his pit stop
+	stepTo(t, sdk, 210)
+	positions := intValues(t, sdk, "CarIdxPosition")
+	if positions[0] != 1 || positions[1] != 3 || positions[2] != 2 {
+		t.Errorf("unexpected finishing positions %v", positions[:3])
+	}
+
+	for sdk.Step() {
+	}
+
+	if sdk.IsConnected() {
+		t.Errorf("expected the sdk to disconnect at the end of the scenario")
+	}
+}
+
+func TestScenarioBuilder(t *testing.T) {
+	s, err := NewScenario("spa", 7.004).
+		TickRate(10).
+		Practice(120).
+		Race(2).
+		Driver(Driver{Name: "Alice Smith", LapTime: 60, LapTimes: []float64{58, 59}}).
+		Driver(Driver{Name: "Bob Jones", LapTime: 61}).
+		CarFlag(1, 1, irsdk.FlagBlue, 10, 20).
+		Incident(0, 10, 0, 4).
+		Incident(1, 5, 0, 1).
+		Build()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	gen, err := NewScenarioGenerator(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ticks := 0
+	for gen.Step() {
+		ticks++
+	}
+
+	// practice, then a race won by alice in 117s and finished by bob at 122s plus the cooldown
+	if expected := (120 + 122 + cooldownTime) * 10; ticks != int(expected) {
+		t.Errorf("expected %d ticks, got %d", int(expected), ticks)
+	}
+
+	// incident counts start over with the race
+	sdk, err := NewScenarioSDK(s, Options{Clock: irsdk.NewManualClock(time.Unix(0, 0))})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for sdk.Step() {
+		if intValue(t, sdk, "SessionNum") == 1 {
+			break
+		}
+	}
+
+	stepTo(t, sdk, 10)
+	if n := intValue(t, sdk, "PlayerCarMyIncidentCount"); n != 1 {
+		t.Errorf("expected 1 incident in the race, got %d", n)
+	}
+
+	if !strings.Contains(sdk.GetYaml(), "CurDriverIncidentCount: 1\n") {
+		t.Errorf("expected 1 driver incident in the race")
+	}
+
+	if _, err = NewScenario("spa", 7.004).Race(2).Build(); err == nil {
+		t.Errorf("expected a scenario without drivers to be rejected")
+	}
+
+	if _, err = ParseScenario([]byte(strings.Replace(testScenario, "caution waving", "purple", 1))); err == nil {
+		t.Errorf("expected an unknown flag to be rejected")
+	}
+}
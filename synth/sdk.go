@@ -0,0 +1,255 @@
+// Package synth generates synthetic telemetry and session info and serves it through the irsdk.SDK
+// interface, for testing without a simulator or a recording.
+package synth
+
+import (
+	"fmt"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/hfoxy/iracing-sdk"
+)
+
+// Frame is the telemetry and session info of a single tick
+type Frame struct {
+	Variables []irsdk.Variable
+	Yaml      string
+}
+
+// Generator produces consecutive ticks of synthetic data
+type Generator interface {
+	// TickRate returns the number of ticks per second, usually 60 or 360
+	TickRate() int
+
+	// Step advances the simulation by one tick, returning false once it has finished
+	Step() bool
+
+	// Frame returns the data of the current tick, it is only called after Step returned true
+	Frame() Frame
+}
+
+// Options configures an SDK
+type Options struct {
+	Logger Logger
+
+	// Clock drives the tick rate, defaults to irsdk.SystemClock. Use an irsdk.ManualClock or Step for
+	// deterministic tests.
+	Clock irsdk.Clock
+}
+
+// Logger is the logger interface used by the irsdk package
+type Logger = irsdk.Logger
+
+// SDK serves the frames of a Generator at its tick rate. It disconnects once the generator has finished.
+// WaitForData, RefreshSession, Step and Close must be called from a single goroutine, every other
+// method may be called concurrently with them.
+type SDK struct {
+	gen    Generator
+	logger Logger
+	clock  irsdk.Clock
+
+	mux      sync.RWMutex
+	openTime time.Time
+	ticks    int // ticks taken from the generator
+	frame    *Frame
+	byName   map[string]int
+	ended    bool
+
+	sessionVersion int
+	sessionYaml    string
+}
+
+// New creates an SDK serving the frames of gen
+func New(gen Generator, opts Options) *SDK {
+	if opts.Logger == nil {
+		opts.Logger = slog.Default()
+	}
+
+	if opts.Clock == nil {
+		opts.Clock = irsdk.SystemClock
+	}
+
+	return &SDK{
+		gen:      gen,
+		logger:   opts.Logger,
+		clock:    opts.Clock,
+		openTime: opts.Clock.Now(),
+	}
+}
+
+// due returns the number of ticks that should have been generated by now
+func (s *SDK) due() int {
+	return int(s.clock.Now().Sub(s.openTime) * time.Duration(s.gen.TickRate()) / time.Second)
+}
+
+// advance steps the generator to tick n and loads its frame, it must be called with s.mux held
+func (s *SDK) advance(n int) bool {
+	if s.ended || n <= s.ticks {
+		return false
+	}
+
+	for s.ticks < n {
+		if !s.gen.Step() {
+			s.ended = true
+			s.frame = nil
+			s.byName = nil
+			s.logger.Info("synthetic session finished", "ticks", s.ticks)
+			return true
+		}
+
+		s.ticks++
+	}
+
+	frame := s.gen.Frame()
+	s.frame = &frame
+	s.byName = make(map[string]int, len(frame.Variables))
+	for i, v := range frame.Variables {
+		s.byName[v.Name] = i
+	}
+
+	if frame.Yaml != s.sessionYaml {
+		s.sessionYaml = frame.Yaml
+		s.sessionVersion++
+	}
+
+	return true
+}
+
+// WaitForData blocks for up to timeout until the next tick is due
+func (s *SDK) WaitForData(timeout time.Duration) (bool, error) {
+	deadline := s.clock.Now().Add(timeout)
+	for {
+		s.mux.Lock()
+		updated := s.advance(s.due())
+		ok := updated && s.frame != nil
+		ended := s.ended
+		next := s.openTime.Add(time.Duration(s.ticks+1) * time.Second / time.Duration(s.gen.TickRate()))
+		s.mux.Unlock()
+
+		if updated {
+			return ok, nil
+		}
+
+		remaining := deadline.Sub(s.clock.Now())
+		if remaining <= 0 {
+			return false, nil
+		}
+
+		wait := next.Sub(s.clock.Now())
+		if ended || wait > remaining {
+			wait = remaining
+		}
+
+		<-s.clock.After(wait)
+	}
+}
+
+// Step generates the next tick immediately, moving the SDK's time base so it stays in step with the clock
+func (s *SDK) Step() bool {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+
+	if d := s.ticks + 1 - s.due(); d > 0 {
+		s.openTime = s.openTime.Add(-time.Duration(d) * time.Second / time.Duration(s.gen.TickRate()))
+	}
+
+	return s.advance(s.ticks+1) && s.frame != nil
+}
+
+func (s *SDK) GetVars() ([]irsdk.Variable, error) {
+	s.mux.RLock()
+	defer s.mux.RUnlock()
+
+	if s.frame == nil {
+		return make([]irsdk.Variable, 0), nil
+	}
+
+	return s.frame.Variables, nil
+}
+
+func (s *SDK) GetVar(name string) (irsdk.Variable, error) {
+	s.mux.RLock()
+	defer s.mux.RUnlock()
+
+	if i, ok := s.byName[name]; ok {
+		return s.frame.Variables[i], nil
+	}
+
+	return irsdk.Variable{}, fmt.Errorf("variable not found: %s", name)
+}
+
+func (s *SDK) GetVarValue(name string) (interface{}, error) {
+	v, err := s.GetVar(name)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(v.Values) > 0 {
+		return v.Values[0], nil
+	}
+
+	return nil, irsdk.ErrNoValue
+}
+
+func (s *SDK) GetVarValues(name string) (interface{}, error) {
+	v, err := s.GetVar(name)
+	if err != nil {
+		return nil, err
+	}
+
+	return v.Values, nil
+}
+
+// RefreshSession is a no-op, every tick already carries the current session info
+func (s *SDK) RefreshSession() error {
+	return nil
+}
+
+func (s *SDK) GetLastVersion() int {
+	s.mux.RLock()
+	defer s.mux.RUnlock()
+
+	if s.frame == nil {
+		return -1
+	}
+
+	return s.ticks
+}
+
+func (s *SDK) GetSessionInfoVersion() int {
+	s.mux.RLock()
+	defer s.mux.RUnlock()
+
+	if s.frame == nil {
+		return -1
+	}
+
+	return s.sessionVersion
+}
+
+func (s *SDK) IsConnected() bool {
+	s.mux.RLock()
+	defer s.mux.RUnlock()
+	return s.frame != nil
+}
+
+func (s *SDK) GetYaml() string {
+	s.mux.RLock()
+	defer s.mux.RUnlock()
+
+	if s.frame == nil {
+		return ""
+	}
+
+	return s.frame.Yaml
+}
+
+// BroadcastMsg is not supported by synthetic sources
+func (s *SDK) BroadcastMsg(msg irsdk.Msg) error {
+	return irsdk.ErrNotImplemented
+}
+
+func (s *SDK) Close() error {
+	return nil
+}
@@ -0,0 +1,84 @@
+package synth
+
+import (
+	"math"
+	"math/rand/v2"
+)
+
+const (
+	trackSamples = 2000 // speed profile resolution per lap
+
+	topSpeed     = 80.0 // m/s
+	brakeDecel   = 12.0 // m/s²
+	acceleration = 5.0  // m/s²
+)
+
+type corner struct {
+	pct   float64
+	speed float64 // apex speed in m/s
+	dir   float64 // 1 for a left hander, -1 for a right hander
+}
+
+// trackProfile is the speed a car at full pace can carry around a lap: top speed on the straights,
+// braking into and accelerating out of every corner
+type trackProfile struct {
+	length float64 // m
+	speed  []float64
+	steer  []float64 // rad
+	lap    float64   // lap time at full pace in seconds
+}
+
+// newTrackProfile lays out corners randomly around a track of length km
+func newTrackProfile(length float64, corners int, rng *rand.Rand) *trackProfile {
+	t := &trackProfile{
+		length: length * 1000,
+		speed:  make([]float64, trackSamples),
+		steer:  make([]float64, trackSamples),
+	}
+
+	cs := make([]corner, corners)
+	for i := range cs {
+		cs[i] = corner{
+			pct:   (float64(i) + 0.2 + 0.6*rng.Float64()) / float64(corners),
+			speed: 18 + 30*rng.Float64(),
+			dir:   float64(1 - 2*rng.IntN(2)),
+		}
+	}
+
+	for i := range t.speed {
+		pct := float64(i) / trackSamples
+		v := topSpeed
+		for _, c := range cs {
+			ahead := math.Mod(c.pct-pct+1, 1) * t.length
+			behind := math.Mod(pct-c.pct+1, 1) * t.length
+			braking := math.Sqrt(c.speed*c.speed + 2*brakeDecel*ahead)
+			exit := math.Sqrt(c.speed*c.speed + 2*acceleration*behind)
+			if limit := min(braking, exit); limit < v {
+				v = limit
+				t.steer[i] = c.dir * 0.6 * (1 - limit/topSpeed)
+			}
+		}
+
+		t.speed[i] = v
+	}
+
+	for _, v := range t.speed {
+		t.lap += t.length / trackSamples / v
+	}
+
+	return t
+}
+
+// at interpolates the profile at pct of the lap
+func (t *trackProfile) at(pct float64) (speed float64, steer float64) {
+	pct = math.Mod(pct, 1)
+	if pct < 0 {
+		pct++
+	}
+
+	x := pct * trackSamples
+	i := int(x) % trackSamples
+	j := (i + 1) % trackSamples
+	f := x - math.Floor(x)
+	return t.speed[i]*(1-f) + t.speed[j]*f, t.steer[i]*(1-f) + t.steer[j]*f
+}
@@ -0,0 +1,123 @@
+package synth
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/hfoxy/iracing-sdk"
+)
+
+func TestTrafficFullField(t *testing.T) {
+	opts := TrafficOptions{Cars: maxCars, TickRate: 360, Seed: 7, Duration: 5 * time.Second}
+	sdk, err := NewTrafficSDK(opts, Options{Clock: irsdk.NewManualClock(time.Unix(0, 0))})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ticks := 0
+	for sdk.Step() {
+		ticks++
+	}
+
+	if ticks != 5*360 {
+		t.Errorf("expected %d ticks, got %d", 5*360, ticks)
+	}
+
+	// replay the same seed and inspect the last frame
+	gen, err := NewTraffic(opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for i := 0; i < ticks; i++ {
+		gen.Step()
+	}
+
+	frame := gen.Frame()
+	if n := strings.Count(frame.Yaml, "UserName:"); n != maxCars {
+		t.Errorf("expected %d drivers in the session info, got %d", maxCars, n)
+	}
+
+	vars := make(map[string]irsdk.Variable)
+	for _, v := range frame.Variables {
+		vars[v.Name] = v
+	}
+
+	for _, name := range []string{"CarIdxLapDistPct", "CarIdxGear", "CarIdxRPM", "CarIdxPosition"} {
+		if vars[name].Count != maxCars {
+			t.Errorf("expected %d values for %s, got %d", maxCars, name, vars[name].Count)
+		}
+	}
+
+	positions := make(map[any]bool)
+	for i, v := range vars["CarIdxPosition"].Values {
+		positions[v] = true
+		if gear := vars["CarIdxGear"].Values[i].(int); gear < 1 || gear > gears {
+			t.Errorf("car %d: unexpected gear %d", i, gear)
+		}
+	}
+
+	if len(positions) != maxCars {
+		t.Errorf("expected unique positions, got %d distinct", len(positions))
+	}
+
+	again, _ := NewTraffic(opts)
+	for i := 0; i < ticks; i++ {
+		again.Step()
+	}
+
+	if !reflect.DeepEqual(again.Frame(), frame) {
+		t.Errorf("expected equal seeds to produce equal frames")
+	}
+}
+
+func TestTrafficPitStop(t *testing.T) {
+	gen, err := NewTraffic(TrafficOptions{Cars: 2, TrackLength: 1, Corners: 2, PitEvery: 1, PitDuration: 5})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	g := gen.(*trafficGenerator)
+	stalled, pitRoad := false, false
+	for i := 0; i < 60*120 && gen.Step(); i++ {
+		stalled = stalled || g.cars[0].surface() == trackInPitStall
+		pitRoad = pitRoad || g.cars[0].pitRoad
+	}
+
+	if !stalled || !pitRoad {
+		t.Errorf("expected car 0 to stop in its pit stall, stalled=%v pitRoad=%v", stalled, pitRoad)
+	}
+
+	if g.cars[0].pitRoad && g.cars[0].pct > pitExit && g.cars[0].pct < pitEntryPct {
+		t.Errorf("expected car 0 to leave the pit lane")
+	}
+}
+
+func TestTrafficShortTrack(t *testing.T) {
+	gen, err := NewTraffic(TrafficOptions{Cars: 64, TrackLength: 0.5, Seed: 3})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for i := 0; i < 600; i++ {
+		gen.Step()
+	}
+
+	for _, v := range gen.Frame().Variables {
+		if v.Name != "CarIdxLapDistPct" {
+			continue
+		}
+
+		for i, pct := range v.Values[:64] {
+			if p := pct.(float32); p < 0 || p >= 1 {
+				t.Errorf("car %d: lap distance %v out of range", i, p)
+			}
+		}
+	}
+
+	if speed, _ := gen.(*trafficGenerator).profile.at(-0.25); speed <= 0 {
+		t.Errorf("expected a speed for a negative lap distance, got %v", speed)
+	}
+}
@@ -0,0 +1,84 @@
+package synth
+
+import (
+	"github.com/hfoxy/iracing-sdk"
+)
+
+// maxCars is the length of the CarIdx* arrays
+const maxCars = 64
+
+// varBuilder lays variables out as consecutive fields of a telemetry row, like the simulator does
+type varBuilder struct {
+	vars   []irsdk.Variable
+	offset int
+}
+
+func (b *varBuilder) add(t irsdk.VarType, name, desc, unit string, values []any) {
+	b.vars = append(b.vars, irsdk.Variable{
+		VarType: t,
+		Offset:  b.offset,
+		Count:   len(values),
+		Name:    name,
+		Desc:    desc,
+		Unit:    unit,
+		Values:  values,
+	})
+
+	b.offset += t.Size() * len(values)
+}
+
+func (b *varBuilder) int(name, desc, unit string, v int) {
+	b.add(irsdk.VarTypeInt, name, desc, unit, []any{v})
+}
+
+func (b *varBuilder) bitField(name, desc string, v irsdk.Flag) {
+	b.add(irsdk.VarTypeBitField, name, desc, "irsdk_Flags", []any{int(v)})
+}
+
+func (b *varBuilder) bool(name, desc string, v bool) {
+	b.add(irsdk.VarTypeBool, name, desc, "", []any{v})
+}
+
+func (b *varBuilder) float(name, desc, unit string, v float64) {
+	b.add(irsdk.VarTypeFloat, name, desc, unit, []any{float32(v)})
+}
+
+func (b *varBuilder) double(name, desc, unit string, v float64) {
+	b.add(irsdk.VarTypeDouble, name, desc, unit, []any{v})
+}
+
+func (b *varBuilder) ints(name, desc, unit string, v []int) {
+	values := make([]any, len(v))
+	for i := range v {
+		values[i] = v[i]
+	}
+
+	b.add(irsdk.VarTypeInt, name, desc, unit, values)
+}
+
+func (b *varBuilder) bitFields(name, desc string, v []irsdk.Flag) {
+	values := make([]any, len(v))
+	for i := range v {
+		values[i] = int(v[i])
+	}
+
+	b.add(irsdk.VarTypeBitField, name, desc, "irsdk_Flags", values)
+}
+
+func (b *varBuilder) bools(name, desc string, v []bool) {
+	values := make([]any, len(v))
+	for i := range v {
+		values[i] = v[i]
+	}
+
+	b.add(irsdk.VarTypeBool, name, desc, "", values)
+}
+
+func (b *varBuilder) floats(name, desc, unit string, v []float64) {
+	values := make([]any, len(v))
+	for i := range v {
+		values[i] = float32(v[i])
+	}
+
+	b.add(irsdk.VarTypeFloat, name, desc, unit, values)
+}
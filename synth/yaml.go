@@ -0,0 +1,148 @@
+package synth
+
+import (
+	"fmt"
+
+	"github.com/go-yaml/yaml"
+)
+
+// the structs below mirror the layout of the session info YAML written by the simulator
+
+type sessionInfoYaml struct {
+	WeekendInfo weekendInfoYaml `yaml:"WeekendInfo"`
+	SessionInfo sessionListYaml `yaml:"SessionInfo"`
+	DriverInfo  driverInfoYaml  `yaml:"DriverInfo"`
+}
+
+type weekendInfoYaml struct {
+	TrackName             string `yaml:"TrackName"`
+	TrackID               int    `yaml:"TrackID"`
+	TrackLength           string `yaml:"TrackLength"`
+	TrackDisplayName      string `yaml:"TrackDisplayName"`
+	TrackConfigName       string `yaml:"TrackConfigName"`
+	TrackAirTemp          string `yaml:"TrackAirTemp"`
+	TrackSurfaceTemp      string `yaml:"TrackSurfaceTemp"`
+	TrackSkies            string `yaml:"TrackSkies"`
+	TrackWindVel          string `yaml:"TrackWindVel"`
+	TrackRelativeHumidity string `yaml:"TrackRelativeHumidity"`
+	SeriesID              int    `yaml:"SeriesID"`
+	SeasonID              int    `yaml:"SeasonID"`
+	SessionID             int    `yaml:"SessionID"`
+	SubSessionID          int    `yaml:"SubSessionID"`
+	EventType             string `yaml:"EventType"`
+	Category              string `yaml:"Category"`
+	SimMode               string `yaml:"SimMode"`
+}
+
+type sessionListYaml struct {
+	Sessions []sessionYaml `yaml:"Sessions"`
+}
+
+type sessionYaml struct {
+	SessionNum       int                 `yaml:"SessionNum"`
+	SessionLaps      string              `yaml:"SessionLaps"`
+	SessionTime      string              `yaml:"SessionTime"`
+	SessionType      string              `yaml:"SessionType"`
+	SessionName      string              `yaml:"SessionName"`
+	ResultsPositions []resultPosYaml     `yaml:"ResultsPositions"`
+	ResultsLapsDone  int                 `yaml:"ResultsLapsComplete"`
+	ResultsOfficial  int                 `yaml:"ResultsOfficial"`
+	ResultsFastest   []resultFastestYaml `yaml:"ResultsFastestLap,omitempty"`
+}
+
+type resultPosYaml struct {
+	Position          int     `yaml:"Position"`
+	ClassPosition     int     `yaml:"ClassPosition"`
+	CarIdx            int     `yaml:"CarIdx"`
+	Lap               int     `yaml:"Lap"`
+	FastestLap        int     `yaml:"FastestLap"`
+	FastestTime       float64 `yaml:"FastestTime"`
+	LastTime          float64 `yaml:"LastTime"`
+	LapsLed           int     `yaml:"LapsLed"`
+	LapsComplete      int     `yaml:"LapsComplete"`
+	ReasonOutStr      string  `yaml:"ReasonOutStr"`
+	Incidents         int     `yaml:"Incidents"`
+	LapsDriven        float64 `yaml:"LapsDriven"`
+	ReasonOutID       int     `yaml:"ReasonOutId"`
+	JokerLapsComplete int     `yaml:"JokerLapsComplete"`
+}
+
+type resultFastestYaml struct {
+	CarIdx      int     `yaml:"CarIdx"`
+	FastestLap  int     `yaml:"FastestLap"`
+	FastestTime float64 `yaml:"FastestTime"`
+}
+
+type driverInfoYaml struct {
+	DriverCarIdx int          `yaml:"DriverCarIdx"`
+	DriverUserID int          `yaml:"DriverUserID"`
+	PaceCarIdx   int          `yaml:"PaceCarIdx"`
+	Drivers      []driverYaml `yaml:"Drivers"`
+}
+
+type driverYaml struct {
+	CarIdx                 int    `yaml:"CarIdx"`
+	UserName               string `yaml:"UserName"`
+	AbbrevName             string `yaml:"AbbrevName"`
+	Initials               string `yaml:"Initials"`
+	UserID                 int    `yaml:"UserID"`
+	TeamID                 int    `yaml:"TeamID"`
+	TeamName               string `yaml:"TeamName"`
+	CarNumber              string `yaml:"CarNumber"`
+	CarNumberRaw           int    `yaml:"CarNumberRaw"`
+	CarID                  int    `yaml:"CarID"`
+	CarScreenName          string `yaml:"CarScreenName"`
+	CarClassID             int    `yaml:"CarClassID"`
+	CarClassShortName      string `yaml:"CarClassShortName"`
+	IRating                int    `yaml:"IRating"`
+	LicString              string `yaml:"LicString"`
+	IsSpectator            int    `yaml:"IsSpectator"`
+	CarIsPaceCar           int    `yaml:"CarIsPaceCar"`
+	CurDriverIncidentCount int    `yaml:"CurDriverIncidentCount"`
+	TeamIncidentCount      int    `yaml:"TeamIncidentCount"`
+}
+
+// marshal renders the session info as a YAML document framed like the simulator's. The document only
+// holds types of this package, failing to marshal it is a bug.
+func (s *sessionInfoYaml) marshal() (string, error) {
+	b, err := yaml.Marshal(s)
+	if err != nil {
+		return "", fmt.Errorf("failed to marshal session info: %w", err)
+	}
+
+	return "---\n" + string(b) + "...\n", nil
+}
+
+func sessionLaps(laps int) string {
+	if laps <= 0 {
+		return "unlimited"
+	}
+
+	return fmt.Sprintf("%d", laps)
+}
+
+func sessionTime(seconds float64) string {
+	if seconds <= 0 {
+		return "unlimited"
+	}
+
+	return fmt.Sprintf("%.4f sec", seconds)
+}
+
+func initials(name string) string {
+	out := make([]rune, 0, 2)
+	start := true
+	for _, r := range name {
+		if r == ' ' {
+			start = true
+			continue
+		}
+
+		if start {
+			out = append(out, r)
+			start = false
+		}
+	}
+
+	return string(out)
+}
@@ -10,6 +10,11 @@ func byte4ToInt(in []byte) int {
 	return int(binary.LittleEndian.Uint32(in))
 }
 
+// byte4ToSignedInt decodes an irsdk_int, which unlike the header fields may be negative
+func byte4ToSignedInt(in []byte) int {
+	return int(int32(binary.LittleEndian.Uint32(in)))
+}
+
 func byte4ToFloat(in []byte) float32 {
 	bits := binary.LittleEndian.Uint32(in)
 	return math.Float32frombits(bits)
@@ -23,3 +28,45 @@ func byte8ToFloat(in []byte) float64 {
 func bytesToString(in []byte) string {
 	return strings.TrimRight(string(in), "\x00")
 }
+
+func toInt(v any) (int, bool) {
+	switch n := v.(type) {
+	case int:
+		return n, true
+	case int32:
+		return int(n), true
+	case int64:
+		return int(n), true
+	case uint32:
+		return int(n), true
+	case float32:
+		return int(n), true
+	case float64:
+		return int(n), true
+	case bool:
+		if n {
+			return 1, true
+		}
+
+		return 0, true
+	default:
+		return 0, false
+	}
+}
+
+func toFloat64(v any) (float64, bool) {
+	switch n := v.(type) {
+	case float64:
+		return n, true
+	case float32:
+		return float64(n), true
+	case int:
+		return float64(n), true
+	case int32:
+		return float64(n), true
+	case int64:
+		return float64(n), true
+	default:
+		return 0, false
+	}
+}
@@ -0,0 +1,192 @@
+package irsdk
+
+import (
+	"cmp"
+	"encoding/binary"
+	"fmt"
+	"math"
+	"slices"
+
+	"github.com/hfoxy/iracing-sdk/replay"
+)
+
+// varHeaderSize is the size of an irsdk_varHeader
+const varHeaderSize = replay.VarHeaderSize
+
+// readVarHeaders reads the variable headers in the order they are stored
+func readVarHeaders(r reader, h *header) ([]Variable, error) {
+	vars := make([]Variable, 0, h.numVars)
+	rbuf := make([]byte, varHeaderSize)
+	for i := 0; i < h.numVars; i++ {
+		_, err := r.ReadAt(rbuf, int64(h.headerOffset+i*varHeaderSize))
+		if err != nil {
+			return nil, err
+		}
+
+		vars = append(vars, parseVarHeader(rbuf))
+	}
+
+	return vars, nil
+}
+
+func parseVarHeader(b []byte) Variable {
+	return variableFromHeader(replay.ParseVarHeader(b))
+}
+
+func variableFromHeader(h replay.VarHeader) Variable {
+	return Variable{
+		VarType:     VarType(h.Type),
+		Offset:      h.Offset,
+		Count:       h.Count,
+		CountAsTime: h.CountAsTime,
+		Name:        h.Name,
+		Desc:        h.Desc,
+		Unit:        h.Unit,
+	}
+}
+
+// appendVarHeader appends v as an irsdk_varHeader, it fails when a string does not fit its field
+func appendVarHeader(dst []byte, v Variable) ([]byte, error) {
+	if len(v.Name) > 32 || len(v.Desc) > 64 || len(v.Unit) > 32 {
+		return dst, fmt.Errorf("variable %s does not fit in a var header", v.Name)
+	}
+
+	h := make([]byte, varHeaderSize)
+	binary.LittleEndian.PutUint32(h[0:], uint32(v.VarType))
+	binary.LittleEndian.PutUint32(h[4:], uint32(v.Offset))
+	binary.LittleEndian.PutUint32(h[8:], uint32(v.Count))
+	if v.CountAsTime {
+		h[12] = 1
+	}
+
+	copy(h[16:48], v.Name)
+	copy(h[48:112], v.Desc)
+	copy(h[112:144], v.Unit)
+	return append(dst, h...), nil
+}
+
+// encodeRow returns the var headers of vars and a telemetry row holding their values. Variables must
+// not overlap and must have Count values of their type.
+func encodeRow(vars []Variable) (schema []byte, row []byte, err error) {
+	sorted := slices.Clone(vars)
+	slices.SortFunc(sorted, func(a, b Variable) int {
+		return cmp.Or(cmp.Compare(a.Offset, b.Offset), cmp.Compare(a.Name, b.Name))
+	})
+
+	end := 0
+	schema = make([]byte, 0, len(sorted)*varHeaderSize)
+	for _, v := range sorted {
+		size := v.VarType.Size()
+		if size == 0 {
+			return nil, nil, fmt.Errorf("unknown var type %d", v.VarType)
+		}
+
+		if v.Offset < end || len(v.Values) != v.Count {
+			return nil, nil, fmt.Errorf("variable %s does not fit in a row", v.Name)
+		}
+
+		end = v.Offset + size*v.Count
+		if schema, err = appendVarHeader(schema, v); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	row = make([]byte, end)
+	for _, v := range sorted {
+		size := v.VarType.Size()
+		for j, value := range v.Values {
+			if err = putValue(row[v.Offset+size*j:], v.VarType, value); err != nil {
+				return nil, nil, fmt.Errorf("variable %s: %w", v.Name, err)
+			}
+		}
+	}
+
+	return schema, row, nil
+}
+
+func putValue(b []byte, t VarType, value any) error {
+	switch t {
+	case VarTypeChar:
+		switch c := value.(type) {
+		case string:
+			if len(c) > 0 {
+				b[0] = c[0]
+			}
+		case byte:
+			b[0] = c
+		default:
+			return fmt.Errorf("unexpected char value %T", value)
+		}
+	case VarTypeBool:
+		v, ok := value.(bool)
+		if !ok {
+			return fmt.Errorf("unexpected bool value %T", value)
+		}
+
+		if v {
+			b[0] = 1
+		}
+	case VarTypeInt, VarTypeBitField:
+		v, ok := toInt(value)
+		if !ok {
+			return fmt.Errorf("unexpected int value %T", value)
+		}
+
+		binary.LittleEndian.PutUint32(b, uint32(v))
+	case VarTypeFloat:
+		v, ok := value.(float32)
+		if !ok {
+			return fmt.Errorf("unexpected float value %T", value)
+		}
+
+		binary.LittleEndian.PutUint32(b, math.Float32bits(v))
+	case VarTypeDouble:
+		v, ok := toFloat64(value)
+		if !ok {
+			return fmt.Errorf("unexpected double value %T", value)
+		}
+
+		binary.LittleEndian.PutUint64(b, math.Float64bits(v))
+	}
+
+	return nil
+}
+
+// decodeRow returns a copy of vars with the values read from a telemetry row
+func decodeRow(row []byte, vars []Variable) ([]Variable, error) {
+	out := make([]Variable, len(vars))
+	for i, v := range vars {
+		size := v.VarType.Size()
+		if size == 0 {
+			return nil, fmt.Errorf("unknown var type %d", v.VarType)
+		}
+
+		if v.Offset < 0 || v.Offset+size*v.Count > len(row) {
+			return nil, fmt.Errorf("variable %s does not fit in a row of %d bytes", v.Name, len(row))
+		}
+
+		values := make([]any, v.Count)
+		for j := range values {
+			b := row[v.Offset+size*j:]
+			switch v.VarType {
+			case VarTypeChar:
+				values[j] = string(b[0])
+			case VarTypeBool:
+				values[j] = b[0] > 0
+			case VarTypeInt:
+				values[j] = byte4ToSignedInt(b)
+			case VarTypeBitField:
+				values[j] = int(binary.LittleEndian.Uint32(b))
+			case VarTypeFloat:
+				values[j] = math.Float32frombits(binary.LittleEndian.Uint32(b))
+			case VarTypeDouble:
+				values[j] = math.Float64frombits(binary.LittleEndian.Uint64(b))
+			}
+		}
+
+		v.Values = values
+		out[i] = v
+	}
+
+	return out, nil
+}
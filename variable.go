@@ -1,5 +1,15 @@
 package irsdk
 
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/gob"
+	"fmt"
+	"sync"
+
+	"github.com/hfoxy/iracing-sdk/replay"
+)
+
 type Variable struct {
 	VarType     VarType // irsdk_VarType
 	Offset      int     // offset fron start of buffer row
@@ -10,3 +20,73 @@ type Variable struct {
 	Unit        string
 	Values      []any
 }
+
+// EncodeVariables encodes variables for replay.Entry.VariableData as their var headers and a raw
+// telemetry row. Variables that cannot be stored in a row, e.g. overlapping ones, are encoded as base64 gob.
+func EncodeVariables(vars []Variable) (string, error) {
+	if schema, row, err := encodeRow(vars); err == nil {
+		return replay.EncodeRowData(schema, row), nil
+	}
+
+	var b bytes.Buffer
+	if err := gob.NewEncoder(&b).Encode(vars); err != nil {
+		return "", fmt.Errorf("failed to encode variables: %w", err)
+	}
+
+	return base64.StdEncoding.EncodeToString(b.Bytes()), nil
+}
+
+// schemaCache holds the var headers of the last row decoded, they rarely change between rows
+var schemaCache struct {
+	sync.Mutex
+	schema string
+	vars   []Variable
+}
+
+// DecodeVariables decodes replay.Entry.VariableData back into variables
+func DecodeVariables(data string) ([]Variable, error) {
+	if schema, row, ok := replay.DecodeRowData(data); ok {
+		vars, err := decodeSchema(schema)
+		if err != nil {
+			return nil, err
+		}
+
+		return decodeRow([]byte(row), vars)
+	}
+
+	vd, err := base64.StdEncoding.DecodeString(data)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode variable data: %w", err)
+	}
+
+	var vars []Variable
+	err = gob.NewDecoder(bytes.NewBuffer(vd)).Decode(&vars)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode variables: %w", err)
+	}
+
+	return vars, nil
+}
+
+func decodeSchema(schema string) ([]Variable, error) {
+	schemaCache.Lock()
+	defer schemaCache.Unlock()
+
+	if schemaCache.vars != nil && schemaCache.schema == schema {
+		return schemaCache.vars, nil
+	}
+
+	headers, err := replay.ParseVarHeaders(schema)
+	if err != nil {
+		return nil, err
+	}
+
+	vars := make([]Variable, len(headers))
+	for i, h := range headers {
+		vars[i] = variableFromHeader(h)
+	}
+
+	schemaCache.schema = schema
+	schemaCache.vars = vars
+	return vars, nil
+}
@@ -0,0 +1,89 @@
+package irsdk
+
+import (
+	"encoding/base64"
+	"math"
+	"reflect"
+	"testing"
+
+	"github.com/hfoxy/iracing-sdk/replay"
+)
+
+func TestEncodeVariables(t *testing.T) {
+	vars := []Variable{
+		{VarType: VarTypeFloat, Offset: 8, Count: 1, Name: "Speed", Desc: "GPS vehicle speed", Unit: "m/s", Values: []any{float32(42.5)}},
+		{VarType: VarTypeInt, Offset: 0, Count: 2, Name: "CarIdxLap", Values: []any{3, -1}},
+		{VarType: VarTypeBool, Offset: 12, Count: 1, Name: "OnPitRoad", Values: []any{true}},
+		{VarType: VarTypeBitField, Offset: 16, Count: 1, Name: "SessionFlags", Values: []any{int(FlagGreen | FlagStartGo)}},
+		{VarType: VarTypeDouble, Offset: 20, Count: 1, Name: "SessionTime", Unit: "s", Values: []any{12.25}},
+		{VarType: VarTypeChar, Offset: 28, Count: 1, Name: "Char", Values: []any{"x"}},
+	}
+
+	data, err := EncodeVariables(vars)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, _, ok := replay.DecodeRowData(data); !ok || len(data) != 4+2+6*varHeaderSize+29 {
+		t.Errorf("expected a raw row, got %d bytes", len(data))
+	}
+
+	decoded, err := DecodeVariables(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// variables are stored in row order
+	want := []Variable{vars[1], vars[0], vars[2], vars[3], vars[4], vars[5]}
+	if !reflect.DeepEqual(decoded, want) {
+		t.Errorf("expected %+v, got %+v", want, decoded)
+	}
+
+	// overlapping variables and files written by older versions use base64 gob
+	overlapping := []Variable{
+		{VarType: VarTypeInt, Count: 1, Name: "Gear", Values: []any{3}},
+		{VarType: VarTypeInt, Count: 1, Name: "Lap", Values: []any{7}},
+	}
+
+	data, err = EncodeVariables(overlapping)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err = base64.StdEncoding.DecodeString(data); err != nil {
+		t.Errorf("expected base64 gob, got %q", data)
+	}
+
+	if decoded, err = DecodeVariables(data); err != nil || !reflect.DeepEqual(decoded, overlapping) {
+		t.Errorf("expected %+v, got %+v (%v)", overlapping, decoded, err)
+	}
+}
+
+func TestDecodeNegativeInt(t *testing.T) {
+	vars := []Variable{
+		{VarType: VarTypeInt, Offset: 0, Count: 3, Name: "CarIdxPosition", Values: []any{-1, math.MinInt32, math.MaxInt32}},
+		{VarType: VarTypeBitField, Offset: 12, Count: 1, Name: "SessionFlags", Values: []any{int(FlagGreen | FlagStartGo)}},
+	}
+
+	data, err := EncodeVariables(vars)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	decoded, err := DecodeVariables(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !reflect.DeepEqual(decoded, vars) {
+		t.Errorf("expected %+v, got %+v", vars, decoded)
+	}
+
+	// the live path reads the same row bytes and must agree with the replay path
+	_, row, _ := replay.DecodeRowData(data)
+	for i, want := range vars[0].Values {
+		if got := byte4ToSignedInt([]byte(row[4*i:])); got != want {
+			t.Errorf("expected %d at %d, got %d", want, i, got)
+		}
+	}
+}
@@ -15,7 +15,7 @@ type VarBuffer struct {
 type TelemetryVars struct {
 	lastVersion int
 	vars        map[string]Variable
-	mux         sync.Mutex
+	mux         sync.RWMutex
 }
 
 func findLatestBuffer(r reader, h *header) (VarBuffer, error) {
@@ -43,23 +43,13 @@ func findLatestBuffer(r reader, h *header) (VarBuffer, error) {
 }
 
 func readVariableHeaders(r reader, h *header) (*TelemetryVars, error) {
-	vars := TelemetryVars{vars: make(map[string]Variable, h.numVars)}
-	for i := 0; i < h.numVars; i++ {
-		rbuf := make([]byte, 144)
-		_, err := r.ReadAt(rbuf, int64(h.headerOffset+i*144))
-		if err != nil {
-			return nil, err
-		}
+	headers, err := readVarHeaders(r, h)
+	if err != nil {
+		return nil, err
+	}
 
-		v := Variable{
-			VarType:     VarType(byte4ToInt(rbuf[0:4])),
-			Offset:      byte4ToInt(rbuf[4:8]),
-			Count:       byte4ToInt(rbuf[8:12]),
-			CountAsTime: int(rbuf[12]) > 0,
-			Name:        bytesToString(rbuf[16:48]),
-			Desc:        bytesToString(rbuf[48:112]),
-			Unit:        bytesToString(rbuf[112:144]),
-		}
+	vars := TelemetryVars{vars: make(map[string]Variable, len(headers))}
+	for _, v := range headers {
 		vars.vars[v.Name] = v
 	}
 
@@ -68,19 +58,26 @@ func readVariableHeaders(r reader, h *header) (*TelemetryVars, error) {
 
 func (sdk *IRSDK) readVariableValues() (bool, error) {
 	newData := false
-	if sdk.sessionStatusOK() {
+	h, tVars := sdk.state()
+	if tVars != nil {
 		// find latest buffer for variables
-		vb, err := findLatestBuffer(sdk.r, sdk.h)
+		vb, err := findLatestBuffer(sdk.r, h)
 		if err != nil {
 			return false, err
 		}
 
-		sdk.tVars.mux.Lock()
-		if sdk.tVars.lastVersion < vb.TickCount {
+		tVars.mux.Lock()
+		defer tVars.mux.Unlock()
+
+		if tVars.lastVersion < vb.TickCount {
 			newData = true
-			sdk.tVars.lastVersion = vb.TickCount
-			sdk.lastValidData = time.Now().Unix()
-			for varName, v := range sdk.tVars.vars {
+			tVars.lastVersion = vb.TickCount
+
+			sdk.mux.Lock()
+			sdk.lastValidData = time.Now()
+			sdk.mux.Unlock()
+
+			for varName, v := range tVars.vars {
 				var rbuf []byte
 				switch v.VarType {
 				case VarTypeChar:
@@ -118,7 +115,7 @@ func (sdk *IRSDK) readVariableValues() (bool, error) {
 							return false, err
 						}
 
-						values[i] = byte4ToInt(rbuf)
+						values[i] = byte4ToSignedInt(rbuf)
 					}
 
 					v.Values = values
@@ -165,11 +162,9 @@ func (sdk *IRSDK) readVariableValues() (bool, error) {
 					return false, fmt.Errorf("unknown var type %d", v.VarType)
 				}
 
-				sdk.tVars.vars[varName] = v
+				tVars.vars[varName] = v
 			}
 		}
-
-		sdk.tVars.mux.Unlock()
 	}
 
 	return newData, nil
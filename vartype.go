@@ -11,3 +11,17 @@ const (
 	VarTypeDouble   VarType = 5
 	VarTypeETCount  VarType = 6
 )
+
+// Size returns the size in bytes of a single value of type t
+func (t VarType) Size() int {
+	switch t {
+	case VarTypeChar, VarTypeBool:
+		return 1
+	case VarTypeInt, VarTypeBitField, VarTypeFloat:
+		return 4
+	case VarTypeDouble:
+		return 8
+	default:
+		return 0
+	}
+}